@@ -0,0 +1,295 @@
+// Package dash описывает MPD манифест MPEG-DASH (ISO/IEC 23009-1)
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Namespace пространство имен MPD
+	Namespace = "urn:mpeg:dash:schema:mpd:2011"
+	// ProfileLive профиль isoff-live: сегменты по SegmentTemplate
+	ProfileLive = "urn:mpeg:dash:profile:isoff-live:2011"
+	// ProfileOnDemand профиль isoff-on-demand: один файл на представление
+	ProfileOnDemand = "urn:mpeg:dash:profile:isoff-on-demand:2011"
+
+	// TypeStatic манифест VOD
+	TypeStatic = "static"
+	// TypeDynamic манифест live стрима
+	TypeDynamic = "dynamic"
+)
+
+// Типы контента AdaptationSet
+const (
+	ContentVideo = "video"
+	ContentAudio = "audio"
+	ContentText  = "text"
+)
+
+// MPD корневой элемент манифеста
+type MPD struct {
+	XMLName                   xml.Name `xml:"urn:mpeg:dash:schema:mpd:2011 MPD"`
+	Profiles                  string   `xml:"profiles,attr,omitempty"`
+	Type                      string   `xml:"type,attr,omitempty"`
+	MediaPresentationDuration Duration `xml:"mediaPresentationDuration,attr,omitempty"`
+	MinBufferTime             Duration `xml:"minBufferTime,attr,omitempty"`
+	MinimumUpdatePeriod       Duration `xml:"minimumUpdatePeriod,attr,omitempty"`
+	AvailabilityStartTime     string   `xml:"availabilityStartTime,attr,omitempty"`
+	BaseURL                   string   `xml:"BaseURL,omitempty"`
+	Periods                   []Period `xml:"Period"`
+}
+
+// Period период презентации
+type Period struct {
+	ID              string           `xml:"id,attr,omitempty"`
+	Start           Duration         `xml:"start,attr,omitempty"`
+	Duration        Duration         `xml:"duration,attr,omitempty"`
+	BaseURL         string           `xml:"BaseURL,omitempty"`
+	SegmentBase     *SegmentBase     `xml:"SegmentBase"`
+	SegmentList     *SegmentList     `xml:"SegmentList"`
+	SegmentTemplate *SegmentTemplate `xml:"SegmentTemplate"`
+	AdaptationSets  []AdaptationSet  `xml:"AdaptationSet"`
+}
+
+// AdaptationSet набор взаимозаменяемых представлений одного контента
+type AdaptationSet struct {
+	ID                string           `xml:"id,attr,omitempty"`
+	ContentType       string           `xml:"contentType,attr,omitempty"`
+	MimeType          string           `xml:"mimeType,attr,omitempty"`
+	Codecs            string           `xml:"codecs,attr,omitempty"`
+	Lang              string           `xml:"lang,attr,omitempty"`
+	SegmentAlignment  bool             `xml:"segmentAlignment,attr,omitempty"`
+	StartWithSAP      int              `xml:"startWithSAP,attr,omitempty"`
+	MaxWidth          int              `xml:"maxWidth,attr,omitempty"`
+	MaxHeight         int              `xml:"maxHeight,attr,omitempty"`
+	MaxFrameRate      string           `xml:"maxFrameRate,attr,omitempty"`
+	ContentProtection []Descriptor     `xml:"ContentProtection"`
+	Roles             []Descriptor     `xml:"Role"`
+	Label             string           `xml:"Label,omitempty"`
+	BaseURL           string           `xml:"BaseURL,omitempty"`
+	SegmentBase       *SegmentBase     `xml:"SegmentBase"`
+	SegmentList       *SegmentList     `xml:"SegmentList"`
+	SegmentTemplate   *SegmentTemplate `xml:"SegmentTemplate"`
+	Representations   []Representation `xml:"Representation"`
+}
+
+// Representation одно качество внутри AdaptationSet
+type Representation struct {
+	ID                        string           `xml:"id,attr"`
+	Bandwidth                 int64            `xml:"bandwidth,attr"`
+	Codecs                    string           `xml:"codecs,attr,omitempty"`
+	MimeType                  string           `xml:"mimeType,attr,omitempty"`
+	Width                     int              `xml:"width,attr,omitempty"`
+	Height                    int              `xml:"height,attr,omitempty"`
+	FrameRate                 string           `xml:"frameRate,attr,omitempty"`
+	SAR                       string           `xml:"sar,attr,omitempty"`
+	AudioSamplingRate         string           `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannelConfiguration *Descriptor      `xml:"AudioChannelConfiguration"`
+	ContentProtection         []Descriptor     `xml:"ContentProtection"`
+	BaseURL                   string           `xml:"BaseURL,omitempty"`
+	SegmentBase               *SegmentBase     `xml:"SegmentBase"`
+	SegmentList               *SegmentList     `xml:"SegmentList"`
+	SegmentTemplate           *SegmentTemplate `xml:"SegmentTemplate"`
+}
+
+// Descriptor дескриптор вида schemeIdUri/value (Role, AudioChannelConfiguration)
+type Descriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr,omitempty"`
+}
+
+// SegmentTemplate шаблон адресов сегментов ($RepresentationID$, $Number$, $Time$)
+type SegmentTemplate struct {
+	Timescale              uint64           `xml:"timescale,attr,omitempty"`
+	Initialization         string           `xml:"initialization,attr,omitempty"`
+	Media                  string           `xml:"media,attr,omitempty"`
+	StartNumber            *int64           `xml:"startNumber,attr"` // nil = 1
+	Duration               uint64           `xml:"duration,attr,omitempty"`
+	PresentationTimeOffset uint64           `xml:"presentationTimeOffset,attr,omitempty"`
+	SegmentTimeline        *SegmentTimeline `xml:"SegmentTimeline"`
+}
+
+// SegmentBase представление одним файлом (профиль on-demand)
+type SegmentBase struct {
+	Timescale      uint64   `xml:"timescale,attr,omitempty"`
+	IndexRange     string   `xml:"indexRange,attr,omitempty"`
+	Initialization *URLType `xml:"Initialization"`
+}
+
+// SegmentList явный список адресов сегментов
+type SegmentList struct {
+	Timescale       uint64           `xml:"timescale,attr,omitempty"`
+	Duration        uint64           `xml:"duration,attr,omitempty"`
+	StartNumber     *int64           `xml:"startNumber,attr"`
+	Initialization  *URLType         `xml:"Initialization"`
+	SegmentTimeline *SegmentTimeline `xml:"SegmentTimeline"`
+	SegmentURLs     []SegmentURL     `xml:"SegmentURL"`
+}
+
+// SegmentURL адрес сегмента в SegmentList
+type SegmentURL struct {
+	Media      string `xml:"media,attr,omitempty"`
+	MediaRange string `xml:"mediaRange,attr,omitempty"`
+}
+
+// URLType адрес секции инициализации: файл и/или диапазон байт
+type URLType struct {
+	SourceURL string `xml:"sourceURL,attr,omitempty"`
+	Range     string `xml:"range,attr,omitempty"`
+}
+
+// SegmentTimeline явная временная шкала сегментов
+type SegmentTimeline struct {
+	S []TimelineSegment `xml:"S"`
+}
+
+// TimelineSegment элемент S: сегмент длительностью D, повторенный еще R раз
+// (R = -1 - до конца периода)
+type TimelineSegment struct {
+	T *uint64 `xml:"t,attr"`
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+}
+
+// NewTimeline строит SegmentTimeline из длительностей сегментов. Границы
+// округляются к timescale от начала, поэтому ошибка не накапливается;
+// подряд идущие сегменты одинаковой длительности объединяются через r.
+func NewTimeline(durations []time.Duration, timescale uint64) *SegmentTimeline {
+	timeline := &SegmentTimeline{}
+
+	var elapsed time.Duration
+	var start uint64
+	for i, duration := range durations {
+		elapsed += duration
+		end := uint64(math.Round(elapsed.Seconds() * float64(timescale)))
+		d := end - start
+
+		if n := len(timeline.S); n > 0 && timeline.S[n-1].D == d {
+			timeline.S[n-1].R++
+		} else {
+			segment := TimelineSegment{D: d}
+			if i == 0 {
+				t := start
+				segment.T = &t
+			}
+			timeline.S = append(timeline.S, segment)
+		}
+		start = end
+	}
+
+	return timeline
+}
+
+// Duration длительность в формате ISO 8601 (PT1H2M3.5S)
+type Duration time.Duration
+
+// String возвращает длительность в формате ISO 8601
+func (d Duration) String() string {
+	remaining := time.Duration(d)
+
+	prefix := "PT"
+	if remaining < 0 {
+		prefix = "-PT"
+		remaining = -remaining
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+
+	if hours := remaining / time.Hour; hours > 0 {
+		fmt.Fprintf(&b, "%dH", hours)
+		remaining -= hours * time.Hour
+	}
+	if minutes := remaining / time.Minute; minutes > 0 {
+		fmt.Fprintf(&b, "%dM", minutes)
+		remaining -= minutes * time.Minute
+	}
+	if remaining > 0 || b.Len() == len(prefix) {
+		b.WriteString(strconv.FormatFloat(remaining.Seconds(), 'f', -1, 64) + "S")
+	}
+
+	return b.String()
+}
+
+// ParseDuration разбирает длительность ISO 8601. Годы и месяцы
+// не поддерживаются, так как их длительность не определена.
+func ParseDuration(value string) (Duration, error) {
+	s := strings.TrimSpace(value)
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 2 {
+		return 0, fmt.Errorf("неверная длительность ISO 8601: %q", value)
+	}
+	s = s[1:]
+
+	var total time.Duration
+	inTime := false
+	for s != "" {
+		if s[0] == 'T' {
+			inTime = true
+			s = s[1:]
+			continue
+		}
+
+		end := strings.IndexAny(s, "YMWDHS")
+		if end <= 0 {
+			return 0, fmt.Errorf("неверная длительность ISO 8601: %q", value)
+		}
+		number, err := strconv.ParseFloat(s[:end], 64)
+		if err != nil {
+			return 0, fmt.Errorf("неверная длительность ISO 8601: %q", value)
+		}
+
+		var unit time.Duration
+		switch {
+		case s[end] == 'W' && !inTime:
+			unit = 7 * 24 * time.Hour
+		case s[end] == 'D' && !inTime:
+			unit = 24 * time.Hour
+		case s[end] == 'H' && inTime:
+			unit = time.Hour
+		case s[end] == 'M' && inTime:
+			unit = time.Minute
+		case s[end] == 'S' && inTime:
+			unit = time.Second
+		default:
+			return 0, fmt.Errorf("неподдерживаемая длительность ISO 8601: %q", value)
+		}
+
+		total += time.Duration(number * float64(unit))
+		s = s[end+1:]
+	}
+
+	return Duration(sign * total), nil
+}
+
+// MarshalXMLAttr записывает длительность атрибутом в формате ISO 8601
+func (d Duration) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: d.String()}, nil
+}
+
+// UnmarshalXMLAttr читает атрибут длительности в формате ISO 8601
+func (d *Duration) UnmarshalXMLAttr(attr xml.Attr) error {
+	parsed, err := ParseDuration(attr.Value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// FormatFrameRate записывает частоту кадров в виде FrameRateType (целое или дробь)
+func FormatFrameRate(fps float64) string {
+	if fps == math.Trunc(fps) {
+		return strconv.Itoa(int(fps))
+	}
+	return fmt.Sprintf("%d/1000", int64(math.Round(fps*1000)))
+}
@@ -0,0 +1,468 @@
+package dash
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Stream представление вместе с содержащим его AdaptationSet
+type Stream struct {
+	AdaptationSet  *AdaptationSet
+	Representation *Representation
+}
+
+// Segment адрес сегмента представления
+type Segment struct {
+	URL      string
+	Range    *ByteRange // nil - ресурс целиком
+	Duration time.Duration
+}
+
+// ByteRange диапазон байт First-Last включительно
+type ByteRange struct {
+	First int64
+	Last  int64
+}
+
+// Parse разбирает MPD манифест
+func Parse(data []byte) (*MPD, error) {
+	var mpd MPD
+	if err := xml.Unmarshal(data, &mpd); err != nil {
+		return nil, fmt.Errorf("ошибка разбора MPD: %w", err)
+	}
+	if len(mpd.Periods) == 0 {
+		return nil, fmt.Errorf("MPD не содержит периодов")
+	}
+	return &mpd, nil
+}
+
+// IsMPD сообщает, похоже ли содержимое на MPD манифест
+func IsMPD(content string) bool {
+	return strings.Contains(content, "<MPD")
+}
+
+// IsLive сообщает, описывает ли манифест live презентацию
+func (m *MPD) IsLive() bool {
+	return m.Type == TypeDynamic
+}
+
+// PeriodDuration возвращает длительность периода: атрибут duration, иначе
+// до начала следующего периода, иначе до конца презентации (0 - неизвестна)
+func (m *MPD) PeriodDuration(index int) time.Duration {
+	period := m.Periods[index]
+	if period.Duration > 0 {
+		return time.Duration(period.Duration)
+	}
+	if index+1 < len(m.Periods) && m.Periods[index+1].Start > 0 {
+		return time.Duration(m.Periods[index+1].Start - period.Start)
+	}
+	if m.MediaPresentationDuration > 0 {
+		return time.Duration(m.MediaPresentationDuration - period.Start)
+	}
+	return 0
+}
+
+// Type возвращает тип контента набора: contentType, иначе по mimeType
+// набора или первого представления
+func (a *AdaptationSet) Type() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+
+	mimeType := a.MimeType
+	if mimeType == "" && len(a.Representations) > 0 {
+		mimeType = a.Representations[0].MimeType
+	}
+	switch {
+	case strings.HasPrefix(mimeType, "video/"):
+		return ContentVideo
+	case strings.HasPrefix(mimeType, "audio/"):
+		return ContentAudio
+	case strings.HasPrefix(mimeType, "text/"), strings.HasPrefix(mimeType, "application/"):
+		return ContentText
+	}
+	return ""
+}
+
+// Streams возвращает представления периода с указанным типом контента в порядке манифеста
+func (p *Period) Streams(contentType string) []Stream {
+	var streams []Stream
+	for i := range p.AdaptationSets {
+		set := &p.AdaptationSets[i]
+		if set.Type() != contentType {
+			continue
+		}
+		for j := range set.Representations {
+			streams = append(streams, Stream{AdaptationSet: set, Representation: &set.Representations[j]})
+		}
+	}
+	return streams
+}
+
+// Codecs возвращает кодеки представления с учетом AdaptationSet
+func (s Stream) Codecs() string {
+	if s.Representation.Codecs != "" {
+		return s.Representation.Codecs
+	}
+	return s.AdaptationSet.Codecs
+}
+
+// MimeType возвращает MIME тип представления с учетом AdaptationSet
+func (s Stream) MimeType() string {
+	if s.Representation.MimeType != "" {
+		return s.Representation.MimeType
+	}
+	return s.AdaptationSet.MimeType
+}
+
+// Resolution возвращает разрешение в виде WIDTHxHEIGHT или пустую строку
+func (s Stream) Resolution() string {
+	if s.Representation.Width == 0 || s.Representation.Height == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", s.Representation.Width, s.Representation.Height)
+}
+
+// FrameRate возвращает частоту кадров представления (целое или дробь вида 30000/1001)
+func (s Stream) FrameRate() float64 {
+	value := s.Representation.FrameRate
+	if value == "" {
+		value = s.AdaptationSet.MaxFrameRate
+	}
+
+	numerator, denominator, isFraction := strings.Cut(value, "/")
+	fps, err := strconv.ParseFloat(numerator, 64)
+	if err != nil {
+		return 0
+	}
+	if isFraction {
+		d, err := strconv.ParseFloat(denominator, 64)
+		if err != nil || d == 0 {
+			return 0
+		}
+		fps /= d
+	}
+	return fps
+}
+
+// Protected сообщает, зашифровано ли представление (ContentProtection)
+func (s Stream) Protected() bool {
+	return len(s.AdaptationSet.ContentProtection) > 0 || len(s.Representation.ContentProtection) > 0
+}
+
+// Segments возвращает секцию инициализации (nil, если она не нужна) и
+// медиасегменты представления периода. Адреса разрешаются относительно
+// mpdURL с учетом BaseURL всех уровней; SegmentTemplate, SegmentList и
+// SegmentBase наследуются с уровней периода и AdaptationSet.
+func (m *MPD) Segments(mpdURL string, periodIndex int, stream Stream) (*Segment, []Segment, error) {
+	period := &m.Periods[periodIndex]
+	set, rep := stream.AdaptationSet, stream.Representation
+
+	base := mpdURL
+	for _, ref := range []string{m.BaseURL, period.BaseURL, set.BaseURL, rep.BaseURL} {
+		base = resolveURL(base, ref)
+	}
+	duration := m.PeriodDuration(periodIndex)
+
+	if template := mergeTemplates(period.SegmentTemplate, set.SegmentTemplate, rep.SegmentTemplate); template != nil {
+		return templateSegments(template, base, rep, duration)
+	}
+	if list := mergeLists(period.SegmentList, set.SegmentList, rep.SegmentList); list != nil {
+		return listSegments(list, base, duration)
+	}
+
+	// SegmentBase или просто BaseURL: представление одним файлом с секцией инициализации внутри
+	return nil, []Segment{{URL: base, Duration: duration}}, nil
+}
+
+// templateSegments разворачивает SegmentTemplate в список сегментов
+func templateSegments(template *SegmentTemplate, base string, rep *Representation, periodDuration time.Duration) (*Segment, []Segment, error) {
+	timescale := template.Timescale
+	if timescale == 0 {
+		timescale = 1
+	}
+	number := int64(1)
+	if template.StartNumber != nil {
+		number = *template.StartNumber
+	}
+
+	var init *Segment
+	if template.Initialization != "" {
+		init = &Segment{URL: resolveURL(base, expandTemplate(template.Initialization, rep, 0, 0))}
+	}
+
+	newSegment := func(number int64, t, d uint64) Segment {
+		return Segment{
+			URL:      resolveURL(base, expandTemplate(template.Media, rep, number, t)),
+			Duration: scaleDuration(d, timescale),
+		}
+	}
+
+	// Конец периода в единицах timescale
+	end := template.PresentationTimeOffset + uint64(math.Round(periodDuration.Seconds()*float64(timescale)))
+
+	var segments []Segment
+	if template.SegmentTimeline != nil {
+		var t uint64
+		timeline := template.SegmentTimeline.S
+		for i, s := range timeline {
+			if s.T != nil {
+				t = *s.T
+			}
+			if s.D == 0 {
+				return nil, nil, fmt.Errorf("нулевая длительность сегмента в SegmentTimeline")
+			}
+
+			repeat := s.R
+			if repeat < 0 {
+				// Повтор до следующего S с явным t или до конца периода
+				until := end
+				if i+1 < len(timeline) && timeline[i+1].T != nil {
+					until = *timeline[i+1].T
+				} else if periodDuration == 0 {
+					return nil, nil, fmt.Errorf("r=-1 без известной длительности периода")
+				}
+				repeat = 0
+				if until > t {
+					repeat = int((until-t+s.D-1)/s.D) - 1
+				}
+			}
+
+			for k := 0; k <= repeat; k++ {
+				segments = append(segments, newSegment(number, t, s.D))
+				t += s.D
+				number++
+			}
+		}
+		return init, segments, nil
+	}
+
+	if template.Duration == 0 {
+		return nil, nil, fmt.Errorf("SegmentTemplate без duration и SegmentTimeline")
+	}
+	if periodDuration == 0 {
+		return nil, nil, fmt.Errorf("длительность периода неизвестна")
+	}
+
+	for t := template.PresentationTimeOffset; t < end; t += template.Duration {
+		segments = append(segments, newSegment(number, t, min(template.Duration, end-t)))
+		number++
+	}
+	return init, segments, nil
+}
+
+// listSegments разворачивает SegmentList в список сегментов
+func listSegments(list *SegmentList, base string, periodDuration time.Duration) (*Segment, []Segment, error) {
+	timescale := list.Timescale
+	if timescale == 0 {
+		timescale = 1
+	}
+
+	var init *Segment
+	if list.Initialization != nil {
+		segment, err := urlSegment(base, list.Initialization.SourceURL, list.Initialization.Range)
+		if err != nil {
+			return nil, nil, err
+		}
+		init = &segment
+	}
+
+	// Длительности берутся из SegmentTimeline, иначе из duration
+	var durations []time.Duration
+	if list.SegmentTimeline != nil {
+		for _, s := range list.SegmentTimeline.S {
+			for k := 0; k <= max(s.R, 0); k++ {
+				durations = append(durations, scaleDuration(s.D, timescale))
+			}
+		}
+	}
+
+	segments := make([]Segment, 0, len(list.SegmentURLs))
+	for i, segmentURL := range list.SegmentURLs {
+		segment, err := urlSegment(base, segmentURL.Media, segmentURL.MediaRange)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case i < len(durations):
+			segment.Duration = durations[i]
+		case list.Duration > 0:
+			segment.Duration = scaleDuration(list.Duration, timescale)
+		case len(list.SegmentURLs) == 1:
+			segment.Duration = periodDuration
+		}
+		segments = append(segments, segment)
+	}
+	return init, segments, nil
+}
+
+// urlSegment строит сегмент из адреса (пустой - BaseURL) и диапазона байт
+func urlSegment(base, ref, byteRange string) (Segment, error) {
+	segment := Segment{URL: resolveURL(base, ref)}
+	if byteRange != "" {
+		parsed, err := parseByteRange(byteRange)
+		if err != nil {
+			return segment, err
+		}
+		segment.Range = parsed
+	}
+	return segment, nil
+}
+
+// parseByteRange разбирает диапазон вида "first-last"
+func parseByteRange(value string) (*ByteRange, error) {
+	first, last, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("неверный диапазон байт: %q", value)
+	}
+
+	var byteRange ByteRange
+	var err1, err2 error
+	byteRange.First, err1 = strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	byteRange.Last, err2 = strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+	if err1 != nil || err2 != nil || byteRange.Last < byteRange.First {
+		return nil, fmt.Errorf("неверный диапазон байт: %q", value)
+	}
+	return &byteRange, nil
+}
+
+// mergeTemplates объединяет SegmentTemplate уровней: заданные атрибуты
+// более вложенного уровня переопределяют унаследованные
+func mergeTemplates(levels ...*SegmentTemplate) *SegmentTemplate {
+	var merged *SegmentTemplate
+	for _, level := range levels {
+		if level == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &SegmentTemplate{}
+		}
+		if level.Timescale != 0 {
+			merged.Timescale = level.Timescale
+		}
+		if level.Initialization != "" {
+			merged.Initialization = level.Initialization
+		}
+		if level.Media != "" {
+			merged.Media = level.Media
+		}
+		if level.StartNumber != nil {
+			merged.StartNumber = level.StartNumber
+		}
+		if level.Duration != 0 {
+			merged.Duration = level.Duration
+		}
+		if level.PresentationTimeOffset != 0 {
+			merged.PresentationTimeOffset = level.PresentationTimeOffset
+		}
+		if level.SegmentTimeline != nil {
+			merged.SegmentTimeline = level.SegmentTimeline
+		}
+	}
+	return merged
+}
+
+// mergeLists объединяет SegmentList уровней аналогично mergeTemplates
+func mergeLists(levels ...*SegmentList) *SegmentList {
+	var merged *SegmentList
+	for _, level := range levels {
+		if level == nil {
+			continue
+		}
+		if merged == nil {
+			merged = &SegmentList{}
+		}
+		if level.Timescale != 0 {
+			merged.Timescale = level.Timescale
+		}
+		if level.Duration != 0 {
+			merged.Duration = level.Duration
+		}
+		if level.StartNumber != nil {
+			merged.StartNumber = level.StartNumber
+		}
+		if level.Initialization != nil {
+			merged.Initialization = level.Initialization
+		}
+		if level.SegmentTimeline != nil {
+			merged.SegmentTimeline = level.SegmentTimeline
+		}
+		if len(level.SegmentURLs) > 0 {
+			merged.SegmentURLs = level.SegmentURLs
+		}
+	}
+	return merged
+}
+
+// expandTemplate подставляет идентификаторы $RepresentationID$, $Number$,
+// $Bandwidth$ и $Time$ (с необязательным форматом вида $Number%05d$)
+func expandTemplate(template string, rep *Representation, number int64, t uint64) string {
+	var b strings.Builder
+
+	for {
+		start := strings.IndexByte(template, '$')
+		if start < 0 {
+			b.WriteString(template)
+			break
+		}
+		end := strings.IndexByte(template[start+1:], '$')
+		if end < 0 {
+			b.WriteString(template)
+			break
+		}
+		end += start + 1
+
+		b.WriteString(template[:start])
+		identifier, format, _ := strings.Cut(template[start+1:end], "%")
+		if format == "" {
+			format = "d"
+		}
+
+		switch identifier {
+		case "":
+			b.WriteByte('$')
+		case "RepresentationID":
+			b.WriteString(rep.ID)
+		case "Number":
+			fmt.Fprintf(&b, "%"+format, number)
+		case "Bandwidth":
+			fmt.Fprintf(&b, "%"+format, rep.Bandwidth)
+		case "Time":
+			fmt.Fprintf(&b, "%"+format, t)
+		default:
+			b.WriteString(template[start : end+1])
+		}
+		template = template[end+1:]
+	}
+
+	return b.String()
+}
+
+// scaleDuration переводит длительность из единиц timescale
+func scaleDuration(value, timescale uint64) time.Duration {
+	return time.Duration(float64(value) / float64(timescale) * float64(time.Second))
+}
+
+// resolveURL разрешает относительный адрес; пустой адрес возвращает base
+func resolveURL(base, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return base
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil || base == "" {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
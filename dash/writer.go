@@ -0,0 +1,25 @@
+package dash
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// WriteTo записывает манифест в XML с заголовком. Адреса сегментов
+// записываются как есть (обычно относительно манифеста).
+func (m *MPD) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&b)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		return 0, fmt.Errorf("ошибка сериализации MPD: %w", err)
+	}
+	b.WriteByte('\n')
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
@@ -0,0 +1,208 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// isMPDURL сообщает, указывает ли URL на MPD манифест
+func isMPDURL(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(parsed.Path), ".mpd")
+}
+
+// DownloadDASH загружает VOD презентацию MPEG-DASH. Видео представление
+// выбирается по тем же правилам, что и вариант HLS (utils.SelectVariant),
+// аудио - по config.AudioLanguages, иначе основной (Role main) набор;
+// субтитры одним файлом - по config.SubtitleLanguages. Сегменты загружаются
+// средствами Go и собираются FFmpeg без перекодирования.
+func (h *HLSDownloader) DownloadDASH(ctx context.Context, config dto.HLSConfig) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("ошибка валидации HLS конфигурации: %w", err)
+	}
+
+	info, err := h.GetPlaylistInfoWithConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("ошибка получения информации о манифесте: %w", err)
+	}
+	if info.MPD == nil {
+		return fmt.Errorf("%s не является MPD манифестом", config.URL)
+	}
+
+	return h.downloadMPD(ctx, info, config)
+}
+
+// downloadMPD загружает выбранные представления первого периода
+func (h *HLSDownloader) downloadMPD(ctx context.Context, info *dto.PlaylistInfo, config dto.HLSConfig) error {
+	if info.MPD.IsLive() {
+		return fmt.Errorf("загрузка live DASH (type=dynamic) не поддерживается")
+	}
+	if len(info.MPD.Periods) > 1 {
+		h.transcoder.logger.Warn("MPD содержит %d периодов, загружается только первый", len(info.MPD.Periods))
+	}
+
+	tracks, err := selectDASHTracks(info, config)
+	if err != nil {
+		return err
+	}
+	return h.downloadNative(ctx, tracks, config)
+}
+
+// selectDASHTracks выбирает видео, аудио и субтитры первого периода
+// и разворачивает их сегменты в медиаплейлисты для нативной загрузки
+func selectDASHTracks(info *dto.PlaylistInfo, config dto.HLSConfig) ([]hlsTrack, error) {
+	mpd := info.MPD
+	period := &mpd.Periods[0]
+
+	var tracks []hlsTrack
+	if video := period.Streams(dash.ContentVideo); len(video) > 0 {
+		index, err := utils.SelectVariantIndex(info.Streams, config)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка выбора потока: %w", err)
+		}
+		track, err := dashTrack(mpd, info.URL, video[index], nil)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+
+	// Выбор языков использует те же правила, что и для EXT-X-MEDIA
+	audio := matchRenditions(dashRenditions(period, dash.ContentAudio), config.AudioLanguages)
+	if len(audio) == 0 {
+		if def := defaultRendition(dashRenditions(period, dash.ContentAudio)); def != nil {
+			audio = []m3u8.Rendition{*def}
+		}
+	}
+	for i := range audio {
+		set := dashRenditionSet(period, audio[i])
+		track, err := dashTrack(mpd, info.URL, bestRepresentation(set, config.Quality), &audio[i])
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+
+	if len(config.SubtitleLanguages) > 0 {
+		for _, rendition := range matchRenditions(dashRenditions(period, dash.ContentText), config.SubtitleLanguages) {
+			rendition := rendition
+			set := dashRenditionSet(period, rendition)
+
+			init, segments, err := mpd.Segments(info.URL, 0, bestRepresentation(set, "best"))
+			if err != nil || init != nil || len(segments) != 1 || segments[0].Range != nil {
+				// Сегментированные субтитры (stpp/wvtt в fMP4) не собираются
+				continue
+			}
+			rendition.URI = segments[0].URL
+			tracks = append(tracks, hlsTrack{URL: rendition.URI, Rendition: &rendition})
+		}
+	}
+
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("MPD не содержит видео или аудио представлений")
+	}
+	// Первая дорожка - основной вход сборки
+	tracks[0].Rendition = nil
+	return tracks, nil
+}
+
+// dashRenditions описывает наборы периода как представления EXT-X-MEDIA,
+// чтобы выбирать языки по тем же правилам, что и в HLS. URI - индекс набора.
+func dashRenditions(period *dash.Period, contentType string) []m3u8.Rendition {
+	renditionType := m3u8.RenditionAudio
+	if contentType == dash.ContentText {
+		renditionType = m3u8.RenditionSubtitles
+	}
+
+	var renditions []m3u8.Rendition
+	for i, set := range period.AdaptationSets {
+		if set.Type() != contentType || len(set.Representations) == 0 {
+			continue
+		}
+
+		rendition := m3u8.Rendition{
+			Type:     renditionType,
+			GroupID:  contentType,
+			Name:     set.Label,
+			Language: set.Lang,
+			URI:      strconv.Itoa(i),
+		}
+		for _, role := range set.Roles {
+			switch role.Value {
+			case "main":
+				rendition.Default = true
+			case "forced-subtitle":
+				rendition.Forced = true
+			}
+		}
+		renditions = append(renditions, rendition)
+	}
+	return renditions
+}
+
+// dashRenditionSet возвращает набор, описанный представлением из dashRenditions
+func dashRenditionSet(period *dash.Period, rendition m3u8.Rendition) *dash.AdaptationSet {
+	index, _ := strconv.Atoi(rendition.URI)
+	return &period.AdaptationSets[index]
+}
+
+// bestRepresentation выбирает представление набора по битрейту:
+// минимальное для качества worst, иначе максимальное
+func bestRepresentation(set *dash.AdaptationSet, quality string) dash.Stream {
+	streams := make([]dto.StreamInfo, len(set.Representations))
+	for i := range set.Representations {
+		streams[i] = utils.StreamInfoFromRepresentation(dash.Stream{AdaptationSet: set, Representation: &set.Representations[i]})
+	}
+
+	if quality != "worst" {
+		quality = "best"
+	}
+	index, _ := utils.SelectStreamIndex(streams, quality)
+	return dash.Stream{AdaptationSet: set, Representation: &set.Representations[index]}
+}
+
+// dashTrack разворачивает сегменты представления в медиаплейлист:
+// секция инициализации становится первым сегментом, поэтому склейка
+// сегментов дает корректный fMP4
+func dashTrack(mpd *dash.MPD, mpdURL string, stream dash.Stream, rendition *m3u8.Rendition) (hlsTrack, error) {
+	id := stream.Representation.ID
+	if stream.Protected() {
+		return hlsTrack{}, fmt.Errorf("представление %s зашифровано (ContentProtection), загрузка не поддерживается", id)
+	}
+
+	init, segments, err := mpd.Segments(mpdURL, 0, stream)
+	if err != nil {
+		return hlsTrack{}, fmt.Errorf("ошибка разбора сегментов представления %s: %w", id, err)
+	}
+
+	playlist := &m3u8.MediaPlaylist{URL: mpdURL, PlaylistType: "VOD", EndList: true}
+	if init != nil {
+		segments = append([]dash.Segment{*init}, segments...)
+	}
+	for i, segment := range segments {
+		converted := m3u8.Segment{URI: segment.URL, Duration: segment.Duration, Sequence: int64(i)}
+		if segment.Range != nil {
+			converted.ByteRange = &m3u8.ByteRange{
+				Length: segment.Range.Last - segment.Range.First + 1,
+				Offset: segment.Range.First,
+			}
+		}
+		playlist.Segments = append(playlist.Segments, converted)
+	}
+
+	if rendition != nil {
+		rendition.URI = mpdURL + "#" + id
+	}
+	return hlsTrack{URL: mpdURL + "#" + id, Rendition: rendition, Playlist: playlist}, nil
+}
@@ -0,0 +1,104 @@
+package transcoder
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// audioChannelScheme схема AudioChannelConfiguration (ISO/IEC 23001-8)
+const audioChannelScheme = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+
+// buildMPD описывает в MPD те же сегменты fMP4, что и HLS плейлисты:
+// AdaptationSet видео с качествами лестницы и AdaptationSet аудио.
+// Сегменты адресуются через SegmentTemplate с SegmentTimeline,
+// построенной по длительностям из медиаплейлистов.
+func buildMPD(config dto.HLSPackageConfig, layout ladderLayout, video, audio []streamStats) *dash.MPD {
+	var duration time.Duration
+	for _, stats := range append(append([]streamStats{}, video...), audio...) {
+		duration = max(duration, stats.media.TotalDuration())
+	}
+
+	videoSet := dash.AdaptationSet{
+		ID:               "0",
+		ContentType:      dash.ContentVideo,
+		MimeType:         "video/mp4",
+		SegmentAlignment: true,
+		StartWithSAP:     1,
+	}
+	var maxFrameRate float64
+	for i, rung := range layout.rungs {
+		videoSet.MaxWidth = max(videoSet.MaxWidth, rung.width)
+		videoSet.MaxHeight = max(videoSet.MaxHeight, rung.height)
+		maxFrameRate = max(maxFrameRate, rung.frameRate)
+
+		videoSet.Representations = append(videoSet.Representations, dash.Representation{
+			ID:              fmt.Sprintf("video_%d", i),
+			Bandwidth:       video[i].bandwidth,
+			Codecs:          videoCodecString(rung),
+			Width:           rung.width,
+			Height:          rung.height,
+			FrameRate:       dash.FormatFrameRate(rung.frameRate),
+			SAR:             "1:1",
+			SegmentTemplate: segmentTemplate(video[i]),
+		})
+	}
+	videoSet.MaxFrameRate = dash.FormatFrameRate(maxFrameRate)
+
+	period := dash.Period{ID: "0", AdaptationSets: []dash.AdaptationSet{videoSet}}
+
+	if len(audio) > 0 {
+		audioSet := dash.AdaptationSet{
+			ID:               "1",
+			ContentType:      dash.ContentAudio,
+			MimeType:         "audio/mp4",
+			SegmentAlignment: true,
+			StartWithSAP:     1,
+		}
+		for k, stats := range audio {
+			audioSet.Representations = append(audioSet.Representations, dash.Representation{
+				ID:                        fmt.Sprintf("audio_%d", k),
+				Bandwidth:                 stats.bandwidth,
+				Codecs:                    audioCodecString(layout.audio[k].codec),
+				AudioChannelConfiguration: &dash.Descriptor{SchemeIDURI: audioChannelScheme, Value: "2"},
+				SegmentTemplate:           segmentTemplate(stats),
+			})
+		}
+		period.AdaptationSets = append(period.AdaptationSets, audioSet)
+	}
+
+	return &dash.MPD{
+		Profiles:                  dash.ProfileLive,
+		Type:                      dash.TypeStatic,
+		MediaPresentationDuration: dash.Duration(duration),
+		MinBufferTime:             dash.Duration(config.SegmentDuration),
+		Periods:                   []dash.Period{period},
+	}
+}
+
+// segmentTemplate строит SegmentTemplate варианта: номера сегментов FFmpeg
+// начинаются с MEDIA-SEQUENCE, секция инициализации берется из EXT-X-MAP
+func segmentTemplate(stats streamStats) *dash.SegmentTemplate {
+	dir := path.Dir(stats.path)
+
+	durations := make([]time.Duration, len(stats.media.Segments))
+	initialization := ""
+	for i, segment := range stats.media.Segments {
+		durations[i] = segment.Duration
+		if segment.Map != nil && initialization == "" {
+			initialization = path.Join(dir, segment.Map.URI)
+		}
+	}
+
+	startNumber := stats.media.MediaSequence
+	return &dash.SegmentTemplate{
+		Timescale:       dashTimescale,
+		Initialization:  initialization,
+		Media:           path.Join(dir, dashSegmentMedia),
+		StartNumber:     &startNumber,
+		SegmentTimeline: dash.NewTimeline(durations, dashTimescale),
+	}
+}
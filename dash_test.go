@@ -0,0 +1,199 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+const testMPD = `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT8S"
+     profiles="urn:mpeg:dash:profile:isoff-live:2011">
+  <Period id="0">
+    <AdaptationSet contentType="video" mimeType="video/mp4" segmentAlignment="true">
+      <SegmentTemplate timescale="1000" startNumber="1"
+          initialization="video/$RepresentationID$/init.mp4" media="video/$RepresentationID$/$Number%03d$.m4s">
+        <SegmentTimeline><S t="0" d="4000" r="1"/></SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="hi" bandwidth="2500000" width="1280" height="720" codecs="avc1.64001f" frameRate="25"/>
+      <Representation id="low" bandwidth="800000" width="640" height="360" codecs="avc1.64001e" frameRate="30000/1001"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4" lang="en">
+      <Role schemeIdUri="urn:mpeg:dash:role:2011" value="main"/>
+      <Representation id="en" bandwidth="128000">
+        <BaseURL>audio/en.mp4</BaseURL>
+        <SegmentList timescale="1" duration="4">
+          <Initialization range="0-9"/>
+          <SegmentURL mediaRange="10-19"/>
+          <SegmentURL mediaRange="20-29"/>
+        </SegmentList>
+      </Representation>
+    </AdaptationSet>
+    <AdaptationSet contentType="audio" mimeType="audio/mp4" lang="ru">
+      <Label>Русский</Label>
+      <SegmentTemplate timescale="1" duration="4" startNumber="0"
+          initialization="audio/$RepresentationID$/init.mp4" media="audio/$RepresentationID$/$Number$.m4s"/>
+      <Representation id="ru_low" bandwidth="64000"/>
+      <Representation id="ru" bandwidth="128000"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="text" mimeType="text/vtt" lang="ru">
+      <Representation id="sub_ru" bandwidth="256"><BaseURL>subs/ru.vtt</BaseURL></Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+// newDASHTestServer отдает testMPD и записывает запрошенные адреса
+func newDASHTestServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		entry := r.URL.Path
+		if byteRange := r.Header.Get("Range"); byteRange != "" {
+			entry += " " + byteRange
+		}
+		requests = append(requests, entry)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vod/manifest.mpd", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, testMPD)
+	})
+	mux.HandleFunc("/vod/audio/en.mp4", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		http.ServeContent(w, r, "en.mp4", time.Time{}, bytes.NewReader([]byte("0123456789abcdefghijABCDEFGHIJ")))
+	})
+	mux.HandleFunc("/vod/subs/", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Субтитры должны загружаться FFmpeg, а не Go клиентом")
+	})
+	mux.HandleFunc("/vod/", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestParseMPD(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server, _ := newDASHTestServer(t)
+
+	info, err := tc.GetHLSInfo(server.URL + "/vod/manifest.mpd")
+	if err != nil {
+		t.Fatalf("Ошибка разбора MPD: %v", err)
+	}
+	if info.MPD == nil || info.IsLive || info.Duration != "8s" {
+		t.Fatalf("Неверная информация о манифесте: %+v", info)
+	}
+	if len(info.Streams) != 2 || info.Streams[1].Resolution != "640x360" || info.Streams[1].FrameRate < 29.97 || info.Streams[1].FrameRate > 29.98 {
+		t.Errorf("Неверные видео представления: %+v", info.Streams)
+	}
+
+	period := &info.MPD.Periods[0]
+	init, segments, err := info.MPD.Segments(info.URL, 0, period.Streams(dash.ContentVideo)[0])
+	if err != nil {
+		t.Fatalf("Ошибка разворачивания SegmentTemplate: %v", err)
+	}
+	if init == nil || init.URL != server.URL+"/vod/video/hi/init.mp4" {
+		t.Errorf("Неверная секция инициализации: %+v", init)
+	}
+	if len(segments) != 2 || segments[1].URL != server.URL+"/vod/video/hi/002.m4s" || segments[1].Duration != 4*time.Second {
+		t.Errorf("Неверные сегменты: %+v", segments)
+	}
+
+	if duration, err := dash.ParseDuration("PT1H2M3.5S"); err != nil || duration.String() != "PT1H2M3.5S" {
+		t.Errorf("Неверный разбор длительности: %v %v", duration, err)
+	}
+}
+
+func TestDownloadDASH(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	server, requests := newDASHTestServer(t)
+
+	output := filepath.Join(t.TempDir(), "out.mkv")
+	err := tc.DownloadHLSWithConfig(context.Background(), dto.HLSConfig{
+		URL:               server.URL + "/vod/manifest.mpd",
+		OutputPath:        output,
+		Quality:           "640x360",
+		AudioLanguages:    []string{"ru"},
+		SubtitleLanguages: []string{"ru"},
+		Concurrency:       1,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки DASH: %v", err)
+	}
+
+	got := strings.Join(requests(), "\n")
+	for _, want := range []string{
+		"/vod/video/low/init.mp4", "/vod/video/low/001.m4s", "/vod/video/low/002.m4s",
+		"/vod/audio/ru/init.mp4", "/vod/audio/ru/0.m4s", "/vod/audio/ru/1.m4s",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Не запрошен %s, запросы:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "/hi/") || strings.Contains(got, "en.mp4") || strings.Contains(got, "ru_low") {
+		t.Errorf("Загружены лишние представления:\n%s", got)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+	for _, want := range []string{
+		"track_0.ts", "track_1.ts", server.URL + "/vod/subs/ru.vtt",
+		"-map 0:v? -map 1:a -map 2:s",
+		"-metadata:s:a:0 language=rus -metadata:s:a:0 title=Русский",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("В аргументах нет %q: %s", want, args)
+		}
+	}
+}
+
+func TestDownloadDASHSegmentList(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server, requests := newDASHTestServer(t)
+
+	err := tc.DownloadDASH(context.Background(), dto.HLSConfig{
+		URL:         server.URL + "/vod/manifest.mpd",
+		OutputPath:  filepath.Join(t.TempDir(), "out.mp4"),
+		Concurrency: 1,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки DASH: %v", err)
+	}
+
+	// По умолчанию: лучшее видео и основной (Role main) аудио набор с диапазонами байт
+	got := strings.Join(requests(), "\n")
+	for _, want := range []string{
+		"/vod/video/hi/init.mp4",
+		"/vod/audio/en.mp4 bytes=0-9",
+		"/vod/audio/en.mp4 bytes=10-19",
+		"/vod/audio/en.mp4 bytes=20-29",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Не запрошен %s, запросы:\n%s", want, got)
+		}
+	}
+}
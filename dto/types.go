@@ -2,6 +2,9 @@ package dto
 
 import (
 	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
 )
 
 // Config содержит настройки для транскодирования
@@ -26,6 +29,8 @@ const (
 	StatusRunning
 	StatusCompleted
 	StatusFailed
+	StatusCancelled
+	StatusPaused
 )
 
 // Job представляет задачу транскодирования
@@ -33,23 +38,116 @@ type Job struct {
 	ID        string
 	Config    Config
 	Status    JobStatus
+	Priority  int // Приоритет в очереди (больше = раньше)
 	Progress  float64
+	Speed     string        // Текущая скорость обработки (например "1.5x")
+	ETA       time.Duration // Оценка оставшегося времени
 	Error     error
+	Attempts  int            // Количество выполненных попыток
+	History   []AttemptError // Ошибки предыдущих попыток
 	StartTime time.Time
 	EndTime   time.Time
+
+	// OnProgress вызывается при каждом обновлении прогресса (опционально)
+	OnProgress func(progress float64, speed string, eta time.Duration)
+}
+
+// AttemptError ошибка одной попытки выполнения задачи
+type AttemptError struct {
+	Attempt int
+	Error   string
+	Time    time.Time
+}
+
+// StreamSelector выбирает вариант из списка и возвращает его индекс
+type StreamSelector func(streams []StreamInfo) (int, error)
+
+// RequestOptions параметры HTTP запросов к источнику, общие для загрузки
+// и проверки плейлистов
+type RequestOptions struct {
+	Headers   map[string]string // Дополнительные HTTP заголовки
+	Cookies   string            // Cookies для авторизации
+	UserAgent string            // User-Agent
+	Referer   string            // Referer
+	Proxy     string            // Прокси: http://, https:// или socks5:// (FFmpeg поддерживает только http://)
+	CABundle  string            // PEM файл с дополнительными корневыми сертификатами
+
+	// Ограничения нагрузки на источник: применяются к каждому хосту отдельно
+	// для плейлистов, ключей и сегментов, загружаемых средствами Go
+	RateLimit         int64         // Скорость загрузки, байт/с (0 = без ограничения)
+	RequestsPerSecond float64       // Частота запросов (0 = без ограничения)
+	MaxConnections    int           // Одновременных соединений (0 = без ограничения)
+	MaxRetryAfter     time.Duration // Предел ожидания по Retry-After на 429/503 (0 = 1 минута)
 }
 
 // HLSConfig конфигурация для работы с HLS
 type HLSConfig struct {
-	URL            string            // URL плейлиста или стрима
-	OutputPath     string            // Путь для сохранения
-	Quality        string            // Качество (best, worst, или конкретное разрешение)
-	Duration       time.Duration     // Максимальная длительность записи (0 = без ограничений)
-	Headers        map[string]string // Дополнительные HTTP заголовки
-	Cookies        string            // Cookies для авторизации
-	UserAgent      string            // User-Agent
-	RetryAttempts  int               // Количество попыток при ошибках
-	SegmentTimeout time.Duration     // Таймаут для загрузки сегментов
+	URL            string        // URL плейлиста или стрима
+	OutputPath     string        // Путь для сохранения
+	Quality        string        // Качество (best, worst, или конкретное разрешение)
+	Duration       time.Duration // Максимальная длительность записи (0 = без ограничений)
+	RequestOptions               // Заголовки, прокси и ограничения нагрузки для HTTP запросов
+	RetryAttempts  int           // Количество попыток при ошибках
+	SegmentTimeout time.Duration // Таймаут для загрузки сегментов
+	Concurrency    int           // Количество параллельных загрузок сегментов (0 = 4)
+	StartOffset    time.Duration // Live запись: начать на указанное время раньше live-края (DVR окно)
+	Resume         bool          // Возобновляемая загрузка: сегменты и манифест хранятся рядом с выходным файлом
+
+	// Политики выбора варианта: ограничения и предпочтения сужают список
+	// вариантов, после чего среди оставшихся применяется Quality
+	MaxWidth          int            // Максимальная ширина кадра (0 = без ограничения)
+	MaxHeight         int            // Максимальная высота кадра (0 = без ограничения)
+	MaxBandwidth      int64          // Максимальный BANDWIDTH, бит/с (0 = без ограничения)
+	PreferCodecs      []string       // Видеокодеки в порядке предпочтения: avc1, hvc1, av01
+	PreferFrameRate   float64        // Предпочитаемая частота кадров: берутся варианты с ближайшей
+	NearestResolution bool           // Если разрешения из Quality нет, взять ближайшее по площади кадра
+	StreamSelector    StreamSelector // Собственный выбор варианта, заменяет правила выше и Quality
+
+	// Альтернативные представления (EXT-X-MEDIA) по языкам в порядке предпочтения,
+	// например []string{"ru", "en"}. Без AudioLanguages берется DEFAULT дорожка группы.
+	AudioLanguages    []string
+	SubtitleLanguages []string
+}
+
+// HLSPackageConfig настройки упаковки локального файла в HLS (и DASH)
+type HLSPackageConfig struct {
+	InputPath       string
+	OutputDir       string        // Директория для плейлистов и сегментов
+	Renditions      []Config      // Лестница качеств: Resolution и VideoBitrate обязательны, InputPath/OutputPath не используются
+	SegmentDuration time.Duration // Длительность сегмента (0 = 6s)
+	SegmentFormat   string        // Формат сегментов: ts (по умолчанию) или fmp4
+	MasterPlaylist  string        // Имя мастер-плейлиста (по умолчанию master.m3u8)
+	DASH            bool          // Дополнительно записать MPD по тем же сегментам (требует fmp4)
+	DASHManifest    string        // Имя MPD манифеста (по умолчанию manifest.mpd)
+}
+
+// HLSPackageResult итог упаковки в HLS (и DASH)
+type HLSPackageResult struct {
+	MasterPlaylist string       // Путь к мастер-плейлисту
+	DASHManifest   string       // Путь к MPD манифесту (если DASH)
+	Variants       []StreamInfo // Варианты; URL - путь медиаплейлиста относительно OutputDir
+}
+
+// LiveRecordResult итог записи live стрима
+type LiveRecordResult struct {
+	OutputPath    string
+	Segments      int           // Количество записанных сегментов
+	Duration      time.Duration // Суммарная длительность записанных сегментов
+	FirstSequence int64         // MEDIA-SEQUENCE первого записанного сегмента
+	LastSequence  int64         // MEDIA-SEQUENCE последнего записанного сегмента
+	Gaps          []SequenceGap // Пропущенные сегменты
+	EndList       bool          // Запись остановлена по EXT-X-ENDLIST
+	Polls         int           // Количество обновлений плейлиста
+	Resets        int           // Сбросы MEDIA-SEQUENCE (перезапуск энкодера): запись продолжена с нового окна
+	Parts         int           // Количество частей, записанных до завершения сегмента (LL-HLS)
+	LowLatency    bool          // Использовались блокирующие обновления плейлиста (LL-HLS)
+}
+
+// SequenceGap диапазон пропущенных сегментов (включительно)
+type SequenceGap struct {
+	From   int64
+	To     int64
+	Reason string // Причина: сегменты выпали из окна плейлиста или не загрузились
 }
 
 // PlaylistInfo информация о плейлисте
@@ -60,15 +158,122 @@ type PlaylistInfo struct {
 	IsLive    bool
 	Title     string
 	Bandwidth int64
+	Keys      []KeyInfo // Ключи шифрования (EXT-X-KEY) в порядке появления
+
+	// Полная модель плейлиста: заполнено ровно одно из полей
+	Master *m3u8.MasterPlaylist
+	Media  *m3u8.MediaPlaylist
+	MPD    *dash.MPD // Манифест MPEG-DASH; Streams - видео представления первого периода
+}
+
+// KeyInfo параметры шифрования сегментов из тега EXT-X-KEY
+type KeyInfo struct {
+	Method            string // NONE, AES-128 или SAMPLE-AES
+	URI               string // Абсолютный URL ключа
+	IV                string // Вектор инициализации (0x...), пусто - номер сегмента
+	KeyFormat         string // Формат ключа (по умолчанию identity)
+	KeyFormatVersions string
 }
 
 // StreamInfo информация о потоке
 type StreamInfo struct {
-	URL        string
-	Resolution string
-	Bandwidth  int64
-	Codecs     string
-	FrameRate  float64
+	URL              string
+	Resolution       string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	FrameRate        float64
+	HDCPLevel        string
+	VideoRange       string
+	Audio            string // Группа аудио представлений (EXT-X-MEDIA)
+	Subtitles        string // Группа субтитров
+	ClosedCaptions   string // Группа скрытых субтитров
+}
+
+// Типы манифестов, найденных на странице
+const (
+	ManifestHLS  = "hls"
+	ManifestDASH = "dash"
+)
+
+// Источники ссылок на манифест (PlaylistCandidate.Source) в порядке убывания надежности
+const (
+	SourceSourceTag = "source"    // <source src> с типом или расширением манифеста
+	SourceVideoTag  = "video"     // <video src>
+	SourceAttribute = "attribute" // href, data-src и другие атрибуты
+	SourceScript    = "script"    // Строка в скрипте или JSON, в том числе с экранированием \/
+	SourceText      = "text"      // Абсолютный URL в тексте страницы
+)
+
+// PlaylistCandidate манифест, найденный на странице
+type PlaylistCandidate struct {
+	URL    string // Абсолютный URL манифеста
+	Kind   string // ManifestHLS или ManifestDASH
+	Source string // Где найдена ссылка: одно из Source*
+	Page   string // Страница или iframe, на которой найдена ссылка
+	Score  int    // Ранг: чем больше, тем вероятнее основной манифест
+}
+
+// Уровни замечаний проверки плейлиста
+const (
+	SeverityError   = "error"   // Нарушение спецификации (RFC 8216)
+	SeverityWarning = "warning" // Допустимо, но может мешать воспроизведению
+)
+
+// Правила проверки плейлиста (ConformanceIssue.Rule)
+const (
+	RuleSyntax             = "syntax"              // Плейлист не разбирается
+	RuleTargetDuration     = "target-duration"     // EXTINF больше EXT-X-TARGETDURATION
+	RuleMediaSequence      = "media-sequence"      // MEDIA-SEQUENCE уменьшился или сегмент изменился при обновлении
+	RuleEndList            = "endlist"             // VOD плейлист без EXT-X-ENDLIST
+	RuleSegmentDuration    = "segment-duration"    // Длительности сегментов или вариантов не согласованы
+	RulePartDuration       = "part-duration"       // Часть длиннее PART-TARGET (LL-HLS)
+	RuleBandwidth          = "bandwidth"           // Нет BANDWIDTH или AVERAGE-BANDWIDTH больше него
+	RuleCodecs             = "codecs"              // CODECS отсутствует или не согласован с вариантом
+	RuleRenditionGroup     = "rendition-group"     // Ссылка на несуществующую группу или несколько DEFAULT
+	RuleVariantConsistency = "variant-consistency" // Варианты одновременно live и VOD
+	RuleUnreachable        = "unreachable"         // URI недоступен
+)
+
+// ConformanceIssue замечание проверки плейлиста
+type ConformanceIssue struct {
+	Severity string // SeverityError или SeverityWarning
+	Rule     string // Одно из правил Rule*
+	URI      string // Плейлист или ресурс, к которому относится замечание
+	Message  string
+}
+
+// ConformanceReport итог проверки плейлиста
+type ConformanceReport struct {
+	URL         string
+	Issues      []ConformanceIssue
+	Playlists   int // Проверено медиаплейлистов
+	CheckedURIs int // Проверено URI на доступность
+}
+
+// Valid сообщает, что в отчете нет ошибок (предупреждения допустимы)
+func (r *ConformanceReport) Valid() bool {
+	return len(r.Errors()) == 0
+}
+
+// Errors возвращает замечания уровня SeverityError
+func (r *ConformanceReport) Errors() []ConformanceIssue {
+	var errors []ConformanceIssue
+	for _, issue := range r.Issues {
+		if issue.Severity == SeverityError {
+			errors = append(errors, issue)
+		}
+	}
+	return errors
+}
+
+// ConformanceConfig настройки проверки плейлиста
+type ConformanceConfig struct {
+	RequestOptions        // Заголовки, прокси и ограничения нагрузки для запросов проверки
+	Concurrency      int  // Количество параллельных проверок доступности (0 = 4)
+	SkipReachability bool // Не проверять доступность сегментов, ключей и секций инициализации
+	SegmentSample    int  // Сколько сегментов каждого плейлиста проверять, включая первый и последний (0 = все)
+	ReloadCheck      bool // Для live плейлистов загрузить обновление и проверить MEDIA-SEQUENCE
 }
 
 // Preset представляет предустановленную конфигурацию
@@ -2,9 +2,11 @@ package dto
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -207,6 +209,74 @@ func (h *HLSConfig) Validate() error {
 		})
 	}
 
+	// Проверка параметров запросов
+	errors = append(errors, validateRequestOptions(h.RequestOptions)...)
+
+	// Проверка количества параллельных загрузок
+	if h.Concurrency < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "Concurrency",
+			Message: "количество параллельных загрузок не может быть отрицательным",
+		})
+	}
+
+	// Проверка смещения DVR окна
+	if h.StartOffset < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "StartOffset",
+			Message: "смещение начала записи не может быть отрицательным",
+		})
+	}
+
+	// Проверка политик выбора варианта
+	if h.MaxWidth < 0 || h.MaxHeight < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "MaxWidth/MaxHeight",
+			Message: "ограничение разрешения не может быть отрицательным",
+		})
+	}
+	if h.MaxBandwidth < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "MaxBandwidth",
+			Message: "ограничение битрейта не может быть отрицательным",
+		})
+	}
+	if h.PreferFrameRate < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "PreferFrameRate",
+			Message: "частота кадров не может быть отрицательной",
+		})
+	}
+	for _, codec := range h.PreferCodecs {
+		if strings.TrimSpace(codec) == "" {
+			errors = append(errors, ValidationError{
+				Field:   "PreferCodecs",
+				Message: "кодек не может быть пустым",
+			})
+			break
+		}
+	}
+
+	// Проверка языков представлений
+	for _, language := range h.AudioLanguages {
+		if strings.TrimSpace(language) == "" {
+			errors = append(errors, ValidationError{
+				Field:   "AudioLanguages",
+				Message: "язык аудио не может быть пустым",
+			})
+			break
+		}
+	}
+	for _, language := range h.SubtitleLanguages {
+		if strings.TrimSpace(language) == "" {
+			errors = append(errors, ValidationError{
+				Field:   "SubtitleLanguages",
+				Message: "язык субтитров не может быть пустым",
+			})
+			break
+		}
+	}
+
 	if errors.HasErrors() {
 		return errors
 	}
@@ -216,6 +286,212 @@ func (h *HLSConfig) Validate() error {
 
 // Вспомогательные функции валидации
 
+// Validate валидирует конфигурацию упаковки в HLS
+func (p *HLSPackageConfig) Validate() error {
+	var errors ValidationErrors
+
+	// Проверка входного файла
+	if p.InputPath == "" {
+		errors = append(errors, ValidationError{
+			Field:   "InputPath",
+			Message: "путь к входному файлу не может быть пустым",
+		})
+	} else if !fileExists(p.InputPath) {
+		errors = append(errors, ValidationError{
+			Field:   "InputPath",
+			Message: fmt.Sprintf("файл '%s' не существует", p.InputPath),
+		})
+	}
+
+	// Проверка выходной директории
+	if p.OutputDir == "" {
+		errors = append(errors, ValidationError{
+			Field:   "OutputDir",
+			Message: "выходная директория не может быть пустой",
+		})
+	}
+
+	// Проверка лестницы качеств
+	if len(p.Renditions) == 0 {
+		errors = append(errors, ValidationError{
+			Field:   "Renditions",
+			Message: "необходимо указать хотя бы одно качество",
+		})
+	}
+	for i, rendition := range p.Renditions {
+		field := fmt.Sprintf("Renditions[%d]", i)
+
+		if err := validateResolution(rendition.Resolution); err != nil {
+			errors = append(errors, ValidationError{Field: field + ".Resolution", Message: err.Error()})
+		}
+		if err := validateBitrate(rendition.VideoBitrate); err != nil {
+			errors = append(errors, ValidationError{Field: field + ".VideoBitrate", Message: err.Error()})
+		}
+		if rendition.AudioBitrate != "" {
+			if err := validateBitrate(rendition.AudioBitrate); err != nil {
+				errors = append(errors, ValidationError{Field: field + ".AudioBitrate", Message: err.Error()})
+			}
+		}
+		if rendition.FrameRate != "" {
+			if err := validateFrameRate(rendition.FrameRate); err != nil {
+				errors = append(errors, ValidationError{Field: field + ".FrameRate", Message: err.Error()})
+			}
+		}
+		switch rendition.VideoCodec {
+		case "", "libx264", "h264", "libx265", "hevc":
+		default:
+			errors = append(errors, ValidationError{
+				Field:   field + ".VideoCodec",
+				Message: fmt.Sprintf("видео кодек '%s' не поддерживается для HLS (используйте libx264 или libx265)", rendition.VideoCodec),
+			})
+		}
+		switch rendition.AudioCodec {
+		case "", "aac", "libmp3lame", "mp3":
+		default:
+			errors = append(errors, ValidationError{
+				Field:   field + ".AudioCodec",
+				Message: fmt.Sprintf("аудио кодек '%s' не поддерживается для HLS (используйте aac или mp3)", rendition.AudioCodec),
+			})
+		}
+	}
+
+	// Проверка сегментов
+	if p.SegmentDuration < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "SegmentDuration",
+			Message: "длительность сегмента не может быть отрицательной",
+		})
+	}
+	if p.SegmentFormat != "" && p.SegmentFormat != "ts" && p.SegmentFormat != "fmp4" {
+		errors = append(errors, ValidationError{
+			Field:   "SegmentFormat",
+			Message: fmt.Sprintf("неизвестный формат сегментов '%s' (используйте ts или fmp4)", p.SegmentFormat),
+		})
+	}
+	if p.DASH && p.SegmentFormat == "ts" {
+		errors = append(errors, ValidationError{
+			Field:   "SegmentFormat",
+			Message: "DASH требует сегменты fmp4",
+		})
+	}
+
+	if errors.HasErrors() {
+		return errors
+	}
+
+	return nil
+}
+
+// Validate валидирует настройки проверки плейлиста
+func (c *ConformanceConfig) Validate() error {
+	var errors ValidationErrors
+
+	errors = append(errors, validateRequestOptions(c.RequestOptions)...)
+
+	if c.Concurrency < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "Concurrency",
+			Message: "количество параллельных проверок не может быть отрицательным",
+		})
+	}
+	if c.SegmentSample < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "SegmentSample",
+			Message: "количество проверяемых сегментов не может быть отрицательным",
+		})
+	}
+
+	if errors.HasErrors() {
+		return errors
+	}
+
+	return nil
+}
+
+// headerNameRe допустимое имя HTTP заголовка (token по RFC 7230)
+var headerNameRe = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// validateRequestOptions проверяет заголовки, адрес прокси, файл корневых
+// сертификатов и ограничения нагрузки
+func validateRequestOptions(r RequestOptions) ValidationErrors {
+	var errors ValidationErrors
+
+	// Значения передаются FFmpeg одной строкой -headers: перевод строки
+	// позволил бы подставить произвольные заголовки
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !headerNameRe.MatchString(name) {
+			errors = append(errors, ValidationError{
+				Field:   "Headers",
+				Message: fmt.Sprintf("некорректное имя заголовка '%s'", name),
+			})
+		} else if hasLineBreak(r.Headers[name]) {
+			errors = append(errors, ValidationError{
+				Field:   "Headers",
+				Message: fmt.Sprintf("значение заголовка '%s' содержит перевод строки", name),
+			})
+		}
+	}
+	for _, field := range []struct{ name, value string }{
+		{"Cookies", r.Cookies},
+		{"UserAgent", r.UserAgent},
+		{"Referer", r.Referer},
+	} {
+		if hasLineBreak(field.value) {
+			errors = append(errors, ValidationError{
+				Field:   field.name,
+				Message: "значение содержит перевод строки",
+			})
+		}
+	}
+
+	if r.Proxy != "" {
+		parsed, err := url.Parse(r.Proxy)
+		if err != nil || parsed.Host == "" {
+			errors = append(errors, ValidationError{
+				Field:   "Proxy",
+				Message: "некорректный адрес прокси",
+			})
+		} else if scheme := strings.ToLower(parsed.Scheme); scheme != "http" && scheme != "https" && scheme != "socks5" {
+			errors = append(errors, ValidationError{
+				Field:   "Proxy",
+				Message: fmt.Sprintf("неподдерживаемая схема прокси '%s' (используйте http, https или socks5)", parsed.Scheme),
+			})
+		}
+	}
+
+	if r.CABundle != "" && !fileExists(r.CABundle) {
+		errors = append(errors, ValidationError{
+			Field:   "CABundle",
+			Message: fmt.Sprintf("файл '%s' не существует", r.CABundle),
+		})
+	}
+
+	if r.RateLimit < 0 || r.RequestsPerSecond < 0 || r.MaxConnections < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "RateLimit/RequestsPerSecond/MaxConnections",
+			Message: "ограничения нагрузки не могут быть отрицательными",
+		})
+	}
+	if r.MaxRetryAfter < 0 {
+		errors = append(errors, ValidationError{
+			Field:   "MaxRetryAfter",
+			Message: "предел ожидания Retry-After не может быть отрицательным",
+		})
+	}
+
+	return errors
+}
+
+// hasLineBreak сообщает, содержит ли значение заголовка CR или LF
+func hasLineBreak(value string) bool {
+	return strings.ContainsAny(value, "\r\n")
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
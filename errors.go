@@ -0,0 +1,179 @@
+package transcoder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrorCause категория причины ошибки FFmpeg
+type ErrorCause string
+
+const (
+	CauseUnknown          ErrorCause = "unknown"
+	CauseCodecNotFound    ErrorCause = "codec not found"
+	CauseInvalidArgument  ErrorCause = "invalid argument"
+	CauseNoSuchFile       ErrorCause = "no such file"
+	CausePermissionDenied ErrorCause = "permission denied"
+	CauseNoSpace          ErrorCause = "no space left"
+	CauseNetwork          ErrorCause = "network error"
+)
+
+// stderrTailLines количество последних строк stderr, сохраняемых в ошибке
+const stderrTailLines = 20
+
+// causePatterns сопоставляет фрагменты вывода FFmpeg с категориями ошибок.
+// Порядок важен: более специфичные причины проверяются первыми.
+var causePatterns = []struct {
+	cause    ErrorCause
+	patterns []string
+}{
+	{CauseCodecNotFound, []string{
+		"unknown encoder",
+		"unknown decoder",
+		"encoder not found",
+		"decoder not found",
+		"codec not currently supported",
+		"no codec could be found",
+	}},
+	{CauseNoSuchFile, []string{"no such file or directory"}},
+	{CausePermissionDenied, []string{"permission denied", "operation not permitted"}},
+	{CauseNoSpace, []string{"no space left on device", "disk quota exceeded"}},
+	{CauseNetwork, []string{
+		"connection refused",
+		"connection reset",
+		"connection timed out",
+		"network is unreachable",
+		"server returned 5",
+		"i/o error",
+		"end of file",
+	}},
+	{CauseInvalidArgument, []string{
+		"invalid argument",
+		"unrecognized option",
+		"option not found",
+		"error parsing",
+		"invalid data found",
+	}},
+}
+
+// FFmpegError ошибка выполнения FFmpeg с сохраненным выводом stderr
+type FFmpegError struct {
+	ExitCode int        // Код завершения процесса (-1 если процесс не завершился сам)
+	Args     []string   // Полный список аргументов
+	Stderr   string     // Последние строки stderr
+	Cause    ErrorCause // Определенная причина ошибки
+	Err      error      // Исходная ошибка запуска/ожидания процесса
+}
+
+func (e *FFmpegError) Error() string {
+	msg := fmt.Sprintf("ffmpeg завершился с кодом %d", e.ExitCode)
+	if e.Cause != CauseUnknown {
+		msg += fmt.Sprintf(" (%s)", e.Cause)
+	}
+	if line := lastLine(e.Stderr); line != "" {
+		msg += ": " + line
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// newFFmpegError создает FFmpegError по ошибке процесса и его stderr.
+// Возвращает nil, если ошибки не было.
+func newFFmpegError(args []string, err error, stderr string) error {
+	if err == nil {
+		return nil
+	}
+
+	exitCode := -1
+	var coder interface{ ExitCode() int }
+	if errors.As(err, &coder) {
+		exitCode = coder.ExitCode()
+	}
+
+	return &FFmpegError{
+		ExitCode: exitCode,
+		Args:     append([]string(nil), args...),
+		Stderr:   stderr,
+		Cause:    detectCause(stderr + "\n" + err.Error()),
+		Err:      err,
+	}
+}
+
+// detectCause определяет причину ошибки по выводу FFmpeg
+func detectCause(output string) ErrorCause {
+	lower := strings.ToLower(output)
+	for _, entry := range causePatterns {
+		for _, pattern := range entry.patterns {
+			if strings.Contains(lower, pattern) {
+				return entry.cause
+			}
+		}
+	}
+	return CauseUnknown
+}
+
+// lastLine возвращает последнюю непустую строку текста
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// tailBuffer io.Writer, который хранит только последние строки вывода
+type tailBuffer struct {
+	mu       sync.Mutex
+	maxLines int
+	lines    []string
+	partial  bytes.Buffer
+}
+
+// newTailBuffer создает буфер для последних maxLines строк
+func newTailBuffer(maxLines int) *tailBuffer {
+	return &tailBuffer{maxLines: maxLines}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, c := range p {
+		// FFmpeg обновляет строку статистики через \r
+		if c == '\n' || c == '\r' {
+			b.flushLine()
+			continue
+		}
+		b.partial.WriteByte(c)
+	}
+	return len(p), nil
+}
+
+// flushLine переносит накопленную строку в список последних строк
+func (b *tailBuffer) flushLine() {
+	if b.partial.Len() == 0 {
+		return
+	}
+	b.lines = append(b.lines, b.partial.String())
+	b.partial.Reset()
+	if len(b.lines) > b.maxLines {
+		b.lines = b.lines[len(b.lines)-b.maxLines:]
+	}
+}
+
+// String возвращает сохраненные строки
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := b.lines
+	if b.partial.Len() > 0 {
+		lines = append(append([]string(nil), lines...), b.partial.String())
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,59 @@
+package transcoder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type exitCodeError struct{ code int }
+
+func (e exitCodeError) Error() string { return fmt.Sprintf("exit status %d", e.code) }
+func (e exitCodeError) ExitCode() int { return e.code }
+
+func TestDetectCause(t *testing.T) {
+	cases := map[string]ErrorCause{
+		"Unknown encoder 'libfoo'":                           CauseCodecNotFound,
+		"input.mp4: No such file or directory":               CauseNoSuchFile,
+		"/root/out.mp4: Permission denied":                   CausePermissionDenied,
+		"Unrecognized option 'foo'.\nError splitting the ar": CauseInvalidArgument,
+		"Conversion failed!":                                 CauseUnknown,
+	}
+
+	for output, expected := range cases {
+		if cause := detectCause(output); cause != expected {
+			t.Errorf("Для %q ожидалась причина %q, получена %q", output, expected, cause)
+		}
+	}
+}
+
+func TestFFmpegErrorWrapping(t *testing.T) {
+	tail := newTailBuffer(2)
+	fmt.Fprint(tail, "line 1\nline 2\rframe=10\ninput.mp4: No such file or directory\n")
+
+	err := newFFmpegError([]string{"-i", "input.mp4"}, exitCodeError{1}, tail.String())
+	wrapped := fmt.Errorf("ошибка транскодирования: %w", err)
+
+	var ffErr *FFmpegError
+	if !errors.As(wrapped, &ffErr) {
+		t.Fatal("Ожидалась ошибка типа *FFmpegError")
+	}
+
+	if ffErr.ExitCode != 1 {
+		t.Errorf("Ожидался код 1, получен %d", ffErr.ExitCode)
+	}
+	if ffErr.Cause != CauseNoSuchFile {
+		t.Errorf("Ожидалась причина %q, получена %q", CauseNoSuchFile, ffErr.Cause)
+	}
+	if strings.Contains(ffErr.Stderr, "line 1") || !strings.Contains(ffErr.Stderr, "frame=10") {
+		t.Errorf("Неожиданный хвост stderr: %q", ffErr.Stderr)
+	}
+	if !strings.Contains(ffErr.Error(), "No such file or directory") {
+		t.Errorf("Сообщение должно содержать последнюю строку stderr: %s", ffErr.Error())
+	}
+
+	if newFFmpegError(nil, nil, "") != nil {
+		t.Error("Без ошибки процесса должен возвращаться nil")
+	}
+}
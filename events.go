@@ -0,0 +1,158 @@
+package transcoder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// EventType тип события жизненного цикла задачи
+type EventType string
+
+const (
+	EventJobQueued    EventType = "job_queued"
+	EventJobStarted   EventType = "job_started"
+	EventJobProgress  EventType = "job_progress"
+	EventJobCompleted EventType = "job_completed"
+	EventJobFailed    EventType = "job_failed"
+	EventJobCancelled EventType = "job_cancelled"
+	EventJobPaused    EventType = "job_paused"
+	EventJobResumed   EventType = "job_resumed"
+	EventJobRetrying  EventType = "job_retrying"
+)
+
+// Event событие жизненного цикла задачи
+type Event struct {
+	Type     EventType
+	JobID    string
+	Time     time.Time
+	Status   dto.JobStatus
+	Progress float64
+	Speed    string
+	ETA      time.Duration
+	Attempt  int
+	Error    error
+}
+
+// newJobEvent создает событие по текущему состоянию задачи
+func newJobEvent(eventType EventType, job *dto.Job) Event {
+	return Event{
+		Type:     eventType,
+		JobID:    job.ID,
+		Time:     time.Now(),
+		Status:   job.Status,
+		Progress: job.Progress,
+		Speed:    job.Speed,
+		ETA:      job.ETA,
+		Attempt:  job.Attempts,
+		Error:    job.Error,
+	}
+}
+
+// subscriber получатель событий: канал или функция
+type subscriber struct {
+	ch chan Event
+	fn func(Event)
+
+	mu     sync.Mutex // Защищает отправку в ch от закрытия при отписке
+	closed bool
+}
+
+// deliver передает событие подписчику
+func (s *subscriber) deliver(event Event) {
+	if s.fn != nil {
+		s.fn(event)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- event:
+	default:
+		// Подписчик не успевает - не блокируем выполнение задач
+	}
+}
+
+// EventBus рассылает события подписчикам
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*subscriber
+	nextID      int
+}
+
+// NewEventBus создает шину событий
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]*subscriber),
+	}
+}
+
+// Subscribe возвращает канал событий с буфером указанного размера и функцию отписки.
+// Если подписчик не успевает читать и буфер заполнен, события для него отбрасываются.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	id := b.add(&subscriber{ch: ch})
+	return ch, func() { b.remove(id) }
+}
+
+// SubscribeFunc регистрирует функцию-обработчик и возвращает функцию отписки.
+// Обработчик вызывается синхронно в горутине, публикующей событие, и должен быть быстрым.
+// Из обработчика можно отписываться и публиковать события; событие, публикация
+// которого началась до отписки, еще может быть доставлено.
+func (b *EventBus) SubscribeFunc(fn func(Event)) func() {
+	id := b.add(&subscriber{fn: fn})
+	return func() { b.remove(id) }
+}
+
+// Publish рассылает событие всем подписчикам. Подписчики вызываются
+// без блокировки шины.
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subscribers := make([]*subscriber, 0, len(b.subscribers))
+	for _, sub := range b.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range subscribers {
+		sub.deliver(event)
+	}
+}
+
+// add регистрирует подписчика
+func (b *EventBus) add(sub *subscriber) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	b.subscribers[b.nextID] = sub
+	return b.nextID
+}
+
+// remove удаляет подписчика и закрывает его канал
+func (b *EventBus) remove(id int) {
+	b.mu.Lock()
+	sub, exists := b.subscribers[id]
+	delete(b.subscribers, id)
+	b.mu.Unlock()
+
+	if !exists || sub.ch == nil {
+		return
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.closed = true
+	close(sub.ch)
+}
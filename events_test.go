@@ -0,0 +1,145 @@
+package transcoder
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+)
+
+func TestQueueEvents(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Stdout: "out_time_us=0\nprogress=end\n"})
+
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+
+	events, unsubscribe := queue.Subscribe(16)
+	defer unsubscribe()
+
+	input := newTestInput(t)
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "out.mp4")})
+	jobID := job.ID
+	queue.AddJob(job)
+	queue.Start()
+
+	expected := []EventType{EventJobQueued, EventJobStarted, EventJobProgress, EventJobCompleted}
+	for _, want := range expected {
+		select {
+		case event := <-events:
+			if event.Type != want || event.JobID != jobID {
+				t.Fatalf("Ожидалось событие %s, получено %s для %s", want, event.Type, event.JobID)
+			}
+			if event.Time.IsZero() {
+				t.Error("Событие должно содержать время")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Не дождались события %s", want)
+		}
+	}
+}
+
+func TestQueueEventOrderManyWorkers(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Stdout: "out_time_us=0\nprogress=end\n"})
+
+	queue := NewQueue(tc, 8)
+	defer queue.Stop()
+
+	var (
+		mu     sync.Mutex
+		events = make(map[string][]EventType)
+	)
+	unsubscribe := queue.SubscribeFunc(func(event Event) {
+		// Медленная доставка JobQueued расширяет окно, в котором воркер мог бы
+		// опубликовать JobStarted раньше
+		if event.Type == EventJobQueued {
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		events[event.JobID] = append(events[event.JobID], event.Type)
+	})
+	defer unsubscribe()
+
+	// Воркеры уже ждут задач, когда задачи добавляются из нескольких горутин
+	queue.Start()
+	input := newTestInput(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), fmt.Sprintf("out%d.mp4", i))})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			queue.AddJob(job)
+		}()
+	}
+	wg.Wait()
+	waitForJobs(t, queue)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for jobID, types := range events {
+		if len(types) < 2 || types[0] != EventJobQueued || types[1] != EventJobStarted {
+			t.Errorf("Задача %s: JobQueued должно предшествовать JobStarted, получено %v", jobID, types)
+		}
+	}
+}
+
+func TestEventBusUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+
+	var received int
+	unsubscribeFunc := bus.SubscribeFunc(func(Event) { received++ })
+	events, unsubscribe := bus.Subscribe(0)
+
+	// Канал без буфера и без читателя не должен блокировать публикацию
+	bus.Publish(Event{Type: EventJobQueued})
+
+	unsubscribeFunc()
+	unsubscribe()
+	bus.Publish(Event{Type: EventJobQueued})
+
+	if received != 1 {
+		t.Errorf("Ожидалось 1 событие до отписки, получено %d", received)
+	}
+	if _, open := <-events; open {
+		t.Error("Канал должен закрываться при отписке")
+	}
+}
+
+func TestEventBusUnsubscribeFromHandler(t *testing.T) {
+	bus := NewEventBus()
+
+	var (
+		received    int
+		unsubscribe func()
+	)
+	unsubscribe = bus.SubscribeFunc(func(Event) {
+		received++
+		unsubscribe()
+		// Публикация из обработчика не должна блокироваться
+		bus.Publish(Event{Type: EventJobProgress})
+	})
+
+	done := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Type: EventJobQueued})
+		bus.Publish(Event{Type: EventJobQueued})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Отписка из обработчика привела к взаимоблокировке")
+	}
+	if received != 1 {
+		t.Errorf("Ожидалось 1 событие до отписки, получено %d", received)
+	}
+}
@@ -56,14 +56,6 @@ func main() {
 			progress, speed, eta.Round(time.Second))
 	}
 
-	// Создаем трекер прогресса
-	progressTracker := transcoder.NewProgressTracker(progressCallback)
-
-	// Устанавливаем продолжительность для расчета прогресса
-	if mediaInfo != nil {
-		progressTracker.SetDuration(mediaInfo.Duration)
-	}
-
 	// Используем пресет для высокого качества
 	preset, exists := presets.GetPreset("high-quality")
 	if !exists {
@@ -75,6 +67,7 @@ func main() {
 	config.OutputPath = "output_hq.mp4"
 
 	job := tc.CreateJob(config)
+	job.OnProgress = progressCallback // продолжительность определяется автоматически
 	fmt.Printf("Создана задача: %s\n", job.ID)
 
 	// Выполняем транскодирование
@@ -196,9 +189,11 @@ func main() {
 			OutputPath: "stream_custom.mp4",
 			Quality:    "best",
 			Duration:   5 * time.Minute,
-			Headers: map[string]string{
-				"Referer":    "https://example.com",
-				"User-Agent": "Custom Transcoder Bot 1.0",
+			RequestOptions: dto.RequestOptions{
+				Headers: map[string]string{
+					"Referer":    "https://example.com",
+					"User-Agent": "Custom Transcoder Bot 1.0",
+				},
 			},
 			RetryAttempts:  3,
 			SegmentTimeout: 15 * time.Second,
@@ -71,9 +71,11 @@ func main() {
 		OutputPath: "stream_hd.mp4",
 		Quality:    "1920x1080",      // Конкретное разрешение
 		Duration:   30 * time.Minute, // Ограничение по времени
-		Headers: map[string]string{
-			"Referer":    "https://example.com",
-			"User-Agent": "Custom User Agent",
+		RequestOptions: dto.RequestOptions{
+			Headers: map[string]string{
+				"Referer":    "https://example.com",
+				"User-Agent": "Custom User Agent",
+			},
 		},
 		RetryAttempts:  3,
 		SegmentTimeout: 10 * time.Second,
@@ -0,0 +1,420 @@
+package transcoder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PadKind тип потока на входе или выходе узла графа
+type PadKind int
+
+const (
+	PadVideo PadKind = iota
+	PadAudio
+)
+
+// Pad поток графа фильтров: поток входного файла (0:v:0) или именованный
+// выход узла ([v1]). Выход узла можно использовать только один раз: как вход
+// другого узла или в Map. Для нескольких потребителей используйте Split.
+type Pad struct {
+	name   string
+	stream bool // Спецификатор потока входа, а не метка графа
+	kind   PadKind
+}
+
+// Kind возвращает тип потока
+func (p Pad) Kind() PadKind {
+	return p.kind
+}
+
+// String возвращает обозначение потока в filter_complex
+func (p Pad) String() string {
+	return "[" + p.name + "]"
+}
+
+// GraphInput вход графа фильтров. Вход 0 - основной файл задачи (InputPath),
+// дополнительные входы добавляются AddInput, AddImage и AddLavfi.
+type GraphInput struct {
+	index int
+}
+
+// Video возвращает первый видеопоток входа
+func (i GraphInput) Video() Pad {
+	return Pad{name: fmt.Sprintf("%d:v:0", i.index), stream: true, kind: PadVideo}
+}
+
+// Audio возвращает первый аудиопоток входа
+func (i GraphInput) Audio() Pad {
+	return Pad{name: fmt.Sprintf("%d:a:0", i.index), stream: true, kind: PadAudio}
+}
+
+// graphNode цепочка фильтров с именованными входами и выходами
+type graphNode struct {
+	inputs  []Pad
+	filters []Filter
+	outputs []Pad
+}
+
+// FilterGraph граф фильтров для -filter_complex с несколькими входами,
+// разветвлением и сведением потоков. В отличие от FilterChain позволяет
+// накладывать изображения и видео (overlay), смешивать звук (amix) и
+// склеивать фрагменты (concat). Ошибки построения накапливаются и
+// возвращаются Build.
+type FilterGraph struct {
+	inputs [][]string // Аргументы дополнительных входов, начиная с входа 1
+	nodes  []graphNode
+	maps   []Pad
+	labels int
+	err    error
+}
+
+// NewFilterGraph создает пустой граф фильтров
+func NewFilterGraph() *FilterGraph {
+	return &FilterGraph{}
+}
+
+// Main возвращает основной вход - файл InputPath задачи
+func (g *FilterGraph) Main() GraphInput {
+	return GraphInput{index: 0}
+}
+
+// AddInput добавляет входной файл или URL. options (например, -ss, -t)
+// ставятся перед его -i.
+func (g *FilterGraph) AddInput(path string, options ...string) GraphInput {
+	args := append(append([]string(nil), options...), "-i", path)
+	g.inputs = append(g.inputs, args)
+	return GraphInput{index: len(g.inputs)}
+}
+
+// AddImage добавляет изображение, повторяемое бесконечно. Граф должен
+// завершаться по основному потоку (overlay с shortest=1, как в Watermark).
+func (g *FilterGraph) AddImage(path string) GraphInput {
+	return g.AddInput(path, "-loop", "1")
+}
+
+// AddLavfi добавляет источник libavfilter, например "color=c=black:s=1280x720"
+// или "anullsrc=r=48000:cl=stereo"
+func (g *FilterGraph) AddLavfi(source string) GraphInput {
+	return g.AddInput(source, "-f", "lavfi")
+}
+
+// Apply применяет к потоку линейную цепочку фильтров и возвращает ее выход
+func (g *FilterGraph) Apply(in Pad, filters ...Filter) Pad {
+	if len(filters) == 0 {
+		g.fail(fmt.Errorf("пустая цепочка фильтров для %s", in))
+		return in
+	}
+	return g.addNode([]Pad{in}, filters, in.kind)[0]
+}
+
+// Node добавляет фильтр с несколькими входами и выходами заданных типов
+func (g *FilterGraph) Node(filter Filter, inputs []Pad, outputs ...PadKind) []Pad {
+	if len(outputs) == 0 {
+		g.fail(fmt.Errorf("у фильтра %s нет выходов", filter.Name))
+		return nil
+	}
+	return g.addNode(inputs, []Filter{filter}, outputs...)
+}
+
+// Split разветвляет поток на n копий (split или asplit)
+func (g *FilterGraph) Split(in Pad, n int) []Pad {
+	if n < 2 {
+		g.fail(fmt.Errorf("split требует не меньше 2 выходов, получено %d", n))
+	}
+
+	name := "split"
+	if in.kind == PadAudio {
+		name = "asplit"
+	}
+	outputs := make([]PadKind, max(n, 1))
+	for i := range outputs {
+		outputs[i] = in.kind
+	}
+	return g.addNode([]Pad{in}, []Filter{{Name: name, Params: map[string]string{"outputs": fmt.Sprint(n)}}}, outputs...)
+}
+
+// Overlay накладывает overlay на main в позиции x, y (выражения FFmpeg,
+// например "main_w-overlay_w-10")
+func (g *FilterGraph) Overlay(main, overlay Pad, x, y string) Pad {
+	return g.overlay(main, overlay, map[string]string{"x": x, "y": y})
+}
+
+// Watermark накладывает изображение с прозрачностью opacity (0-1).
+// Результат заканчивается вместе с main.
+func (g *FilterGraph) Watermark(main, image Pad, x, y string, opacity float64) Pad {
+	if opacity < 0 || opacity > 1 {
+		g.fail(fmt.Errorf("прозрачность водяного знака должна быть от 0 до 1, получено %g", opacity))
+	}
+
+	mark := g.Apply(image,
+		Filter{Name: "format", Params: map[string]string{"pix_fmts": "rgba"}},
+		Filter{Name: "colorchannelmixer", Params: map[string]string{"aa": fmt.Sprintf("%.2f", opacity)}},
+	)
+	return g.overlay(main, mark, map[string]string{"x": x, "y": y, "shortest": "1"})
+}
+
+// PictureInPicture уменьшает inset до ширины width с сохранением пропорций
+// и накладывает на main в позиции x, y
+func (g *FilterGraph) PictureInPicture(main, inset Pad, width int, x, y string) Pad {
+	if width <= 0 {
+		g.fail(fmt.Errorf("ширина врезки должна быть больше 0, получено %d", width))
+	}
+
+	scaled := g.Apply(inset, Filter{Name: "scale", Params: map[string]string{"w": fmt.Sprint(width), "h": "-2"}})
+	return g.overlay(main, scaled, map[string]string{"x": x, "y": y})
+}
+
+// Amix смешивает аудиопотоки; длительность результата - по самому длинному
+func (g *FilterGraph) Amix(inputs ...Pad) Pad {
+	if len(inputs) < 2 {
+		g.fail(fmt.Errorf("amix требует не меньше 2 входов, получено %d", len(inputs)))
+	}
+	for _, in := range inputs {
+		g.expectKind(in, PadAudio, "amix")
+	}
+
+	filter := Filter{Name: "amix", Params: map[string]string{"inputs": fmt.Sprint(len(inputs)), "duration": "longest"}}
+	return g.addNode(inputs, []Filter{filter}, PadAudio)[0]
+}
+
+// Concat склеивает фрагменты. Каждый фрагмент - потоки одного состава:
+// сначала видео, затем аудио, например {video, audio}. Возвращает склеенные
+// потоки в том же порядке.
+func (g *FilterGraph) Concat(segments ...[]Pad) []Pad {
+	if len(segments) < 2 {
+		g.fail(fmt.Errorf("concat требует не меньше 2 фрагментов, получено %d", len(segments)))
+		return nil
+	}
+
+	layout := padKinds(segments[0])
+	if len(layout) == 0 {
+		g.fail(fmt.Errorf("пустой фрагмент concat"))
+		return nil
+	}
+
+	videos, audios := 0, 0
+	for _, kind := range layout {
+		if kind == PadAudio {
+			audios++
+			continue
+		}
+		if audios > 0 {
+			g.fail(fmt.Errorf("во фрагменте concat видео должно идти перед аудио"))
+			return nil
+		}
+		videos++
+	}
+
+	var inputs []Pad
+	for i, segment := range segments {
+		if !equalKinds(padKinds(segment), layout) {
+			g.fail(fmt.Errorf("фрагмент concat %d отличается по составу потоков от первого", i))
+			return nil
+		}
+		inputs = append(inputs, segment...)
+	}
+
+	filter := Filter{Name: "concat", Params: map[string]string{
+		"n": fmt.Sprint(len(segments)),
+		"v": fmt.Sprint(videos),
+		"a": fmt.Sprint(audios),
+	}}
+	return g.addNode(inputs, []Filter{filter}, layout...)
+}
+
+// Map добавляет потоки в выходной файл в порядке вызова
+func (g *FilterGraph) Map(pads ...Pad) *FilterGraph {
+	g.maps = append(g.maps, pads...)
+	return g
+}
+
+// Build проверяет граф и возвращает строку -filter_complex
+func (g *FilterGraph) Build() (string, error) {
+	if g.err != nil {
+		return "", g.err
+	}
+	if len(g.nodes) == 0 {
+		return "", fmt.Errorf("граф фильтров пуст")
+	}
+	if len(g.maps) == 0 {
+		return "", fmt.Errorf("в графе фильтров не выбраны выходные потоки (Map)")
+	}
+
+	produced := make(map[string]bool)
+	for _, node := range g.nodes {
+		for _, out := range node.outputs {
+			produced[out.name] = true
+		}
+	}
+
+	used := make(map[string]bool)
+	use := func(pad Pad) error {
+		if pad.name == "" {
+			return fmt.Errorf("пустой поток в графе фильтров")
+		}
+		if pad.stream {
+			var index int
+			if _, err := fmt.Sscanf(pad.name, "%d:", &index); err != nil || index > len(g.inputs) {
+				return fmt.Errorf("поток %s ссылается на несуществующий вход", pad)
+			}
+			return nil
+		}
+		if !produced[pad.name] {
+			return fmt.Errorf("поток %s не принадлежит графу", pad)
+		}
+		if used[pad.name] {
+			return fmt.Errorf("поток %s используется повторно, разветвите его Split", pad)
+		}
+		used[pad.name] = true
+		return nil
+	}
+
+	chains := make([]string, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		var chain strings.Builder
+		for _, in := range node.inputs {
+			if err := use(in); err != nil {
+				return "", err
+			}
+			chain.WriteString(in.String())
+		}
+		for i, filter := range node.filters {
+			if i > 0 {
+				chain.WriteString(",")
+			}
+			chain.WriteString(formatGraphFilter(filter))
+		}
+		for _, out := range node.outputs {
+			chain.WriteString(out.String())
+		}
+		chains = append(chains, chain.String())
+	}
+
+	for _, pad := range g.maps {
+		if err := use(pad); err != nil {
+			return "", err
+		}
+	}
+	for _, node := range g.nodes {
+		for _, out := range node.outputs {
+			if !used[out.name] {
+				return "", fmt.Errorf("выход %s не использован: передайте его другому фильтру или в Map", out)
+			}
+		}
+	}
+
+	return strings.Join(chains, ";"), nil
+}
+
+// Args возвращает аргументы FFmpeg для дополнительных входов,
+// -filter_complex и -map. Аргументы основного входа (-i InputPath)
+// должны стоять перед ними.
+func (g *FilterGraph) Args() ([]string, error) {
+	graph, err := g.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, input := range g.inputs {
+		args = append(args, input...)
+	}
+	args = append(args, "-filter_complex", graph)
+
+	for _, pad := range g.maps {
+		if pad.stream {
+			args = append(args, "-map", pad.name)
+		} else {
+			args = append(args, "-map", pad.String())
+		}
+	}
+	return args, nil
+}
+
+// addNode добавляет узел и создает метки его выходов
+func (g *FilterGraph) addNode(inputs []Pad, filters []Filter, outputs ...PadKind) []Pad {
+	node := graphNode{inputs: inputs, filters: filters}
+	for _, kind := range outputs {
+		prefix := "v"
+		if kind == PadAudio {
+			prefix = "a"
+		}
+		g.labels++
+		node.outputs = append(node.outputs, Pad{name: fmt.Sprintf("%s%d", prefix, g.labels), kind: kind})
+	}
+	g.nodes = append(g.nodes, node)
+	return node.outputs
+}
+
+// overlay добавляет фильтр overlay над двумя видеопотоками
+func (g *FilterGraph) overlay(main, overlay Pad, params map[string]string) Pad {
+	g.expectKind(main, PadVideo, "overlay")
+	g.expectKind(overlay, PadVideo, "overlay")
+	return g.addNode([]Pad{main, overlay}, []Filter{{Name: "overlay", Params: params}}, PadVideo)[0]
+}
+
+// expectKind запоминает ошибку, если поток не того типа
+func (g *FilterGraph) expectKind(pad Pad, kind PadKind, filter string) {
+	if pad.kind != kind {
+		g.fail(fmt.Errorf("фильтр %s не принимает поток %s этого типа", filter, pad))
+	}
+}
+
+// fail запоминает первую ошибку построения
+func (g *FilterGraph) fail(err error) {
+	if g.err == nil {
+		g.err = err
+	}
+}
+
+// padKinds возвращает типы потоков
+func padKinds(pads []Pad) []PadKind {
+	kinds := make([]PadKind, len(pads))
+	for i, pad := range pads {
+		kinds[i] = pad.kind
+	}
+	return kinds
+}
+
+// equalKinds сравнивает составы потоков
+func equalKinds(a, b []PadKind) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatGraphFilter записывает фильтр для filter_complex: параметры по
+// алфавиту, значения экранированы на уровне опций и на уровне графа
+func formatGraphFilter(filter Filter) string {
+	if len(filter.Params) == 0 {
+		return filter.Name
+	}
+
+	keys := make([]string, 0, len(filter.Params))
+	for key := range filter.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if value := filter.Params[key]; value == "" {
+			params = append(params, key)
+		} else {
+			params = append(params, key+"="+graphEscaper.Replace(optionEscaper.Replace(value)))
+		}
+	}
+	return filter.Name + "=" + strings.Join(params, ":")
+}
+
+var (
+	optionEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`)
+	graphEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`)
+)
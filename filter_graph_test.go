@@ -0,0 +1,139 @@
+package transcoder
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+)
+
+func TestFilterGraphBuild(t *testing.T) {
+	g := NewFilterGraph()
+	logo := g.AddImage("logo.png")
+	camera := g.AddInput("camera.mp4")
+	tone := g.AddLavfi("sine=frequency=440")
+
+	video := g.Watermark(g.Main().Video(), logo.Video(), "main_w-overlay_w-10", "10", 0.5)
+	video = g.PictureInPicture(video, camera.Video(), 320, "10", "main_h-overlay_h-10")
+	audio := g.Amix(g.Main().Audio(), tone.Audio())
+	g.Map(video, audio)
+
+	args, err := g.Args()
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	graph := strings.Join([]string{
+		"[1:v:0]format=pix_fmts=rgba,colorchannelmixer=aa=0.50[v1]",
+		"[0:v:0][v1]overlay=shortest=1:x=main_w-overlay_w-10:y=10[v2]",
+		"[2:v:0]scale=h=-2:w=320[v3]",
+		"[v2][v3]overlay=x=10:y=main_h-overlay_h-10[v4]",
+		"[0:a:0][3:a:0]amix=duration=longest:inputs=2[a5]",
+	}, ";")
+	want := []string{
+		"-loop", "1", "-i", "logo.png",
+		"-i", "camera.mp4",
+		"-f", "lavfi", "-i", "sine=frequency=440",
+		"-filter_complex", graph,
+		"-map", "[v4]", "-map", "[a5]",
+	}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Errorf("Неожиданные аргументы:\n%v\nожидалось:\n%v", args, want)
+	}
+}
+
+func TestFilterGraphSplitConcatAndEscaping(t *testing.T) {
+	g := NewFilterGraph()
+	copies := g.Split(g.Main().Video(), 2)
+	titled := g.Apply(copies[1], Filter{Name: "drawtext", Params: map[string]string{"text": "a:b", "x": "if(gt(t,2),10,20)"}})
+	joined := g.Concat([]Pad{copies[0], g.Main().Audio()}, []Pad{titled, g.Main().Audio()})
+	g.Map(joined...)
+
+	graph, err := g.Build()
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	want := `[0:v:0]split=outputs=2[v1][v2];` +
+		`[v2]drawtext=text=a\\:b:x=if(gt(t\,2)\,10\,20)[v3];` +
+		`[v1][0:a:0][v3][0:a:0]concat=a=1:n=2:v=1[v4][a5]`
+	if graph != want {
+		t.Errorf("Неожиданный граф:\n%s\nожидалось:\n%s", graph, want)
+	}
+}
+
+func TestFilterGraphErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(g *FilterGraph)
+	}{
+		{"повторное использование выхода", func(g *FilterGraph) {
+			scaled := g.Apply(g.Main().Video(), ScaleFilter(640, 360))
+			g.Map(g.Overlay(scaled, scaled, "0", "0"))
+		}},
+		{"неиспользованный выход", func(g *FilterGraph) {
+			copies := g.Split(g.Main().Video(), 2)
+			g.Map(copies[0])
+		}},
+		{"amix с видео", func(g *FilterGraph) {
+			g.Map(g.Amix(g.Main().Audio(), g.Main().Video()))
+		}},
+		{"несуществующий вход", func(g *FilterGraph) {
+			g.Map(g.Apply(GraphInput{index: 3}.Video(), ScaleFilter(640, 360)))
+		}},
+		{"без Map", func(g *FilterGraph) {
+			g.Apply(g.Main().Video(), ScaleFilter(640, 360))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewFilterGraph()
+			tt.build(g)
+			if _, err := g.Build(); err == nil {
+				t.Error("Ожидалась ошибка построения графа")
+			}
+		})
+	}
+}
+
+func TestExecuteWithGraph(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffprobe", runner.FakeResponse{
+		Stdout: `{"format": {"duration": "10.0"}, "streams": []}`,
+	})
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Stdout: "progress=end\n"})
+
+	input := newTestInput(t)
+	output := filepath.Join(filepath.Dir(input), "output.mp4")
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: output, VideoCodec: "libx264"})
+
+	g := NewFilterGraph()
+	logo := g.AddImage("logo.png")
+	g.Map(g.Watermark(g.Main().Video(), logo.Video(), "10", "10", 0.3), g.Main().Audio())
+
+	if err := tc.ExecuteWithGraph(context.Background(), job, g); err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+	want := "-i " + input + " -loop 1 -i logo.png -filter_complex " +
+		"[1:v:0]format=pix_fmts=rgba,colorchannelmixer=aa=0.30[v1];[0:v:0][v1]overlay=shortest=1:x=10:y=10[v2] " +
+		"-map [v2] -map 0:a:0 -y -c:v libx264 " + output
+	if !strings.HasSuffix(args, want) {
+		t.Errorf("Неожиданные аргументы FFmpeg:\n%s\nожидалось окончание:\n%s", args, want)
+	}
+
+	// Ошибка графа завершает задачу без запуска FFmpeg
+	job = tc.CreateJob(dto.Config{InputPath: input, OutputPath: output})
+	if err := tc.ExecuteWithGraph(context.Background(), job, NewFilterGraph()); err == nil || job.Status != dto.StatusFailed {
+		t.Errorf("Ожидалась ошибка пустого графа, статус %d, ошибка %v", job.Status, err)
+	}
+	if len(fake.CallsTo("ffmpeg")) != len(calls) {
+		t.Error("FFmpeg не должен запускаться для некорректного графа")
+	}
+}
@@ -3,7 +3,6 @@ package transcoder
 import (
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -205,7 +204,11 @@ func FadeOutFilter(startTime, duration float64) Filter {
 	}
 }
 
-// WatermarkFilter водяной знак
+// WatermarkFilter водяной знак.
+//
+// Deprecated: overlay требует второго входа, поэтому в FilterChain фильтр
+// накладывает пустой поток, а overlayPath и opacity не применяются.
+// Используйте FilterGraph.Watermark.
 func WatermarkFilter(overlayPath string, x, y int, opacity float64) Filter {
 	return Filter{
 		Name: "overlay",
@@ -283,36 +286,61 @@ func NoiseReductionFilter(strength float64) Filter {
 
 // ExecuteWithFilters выполняет транскодирование с фильтрами
 func (t *Transcoder) ExecuteWithFilters(ctx context.Context, job *dto.Job, filterChain *FilterChain) error {
+	return t.executeFiltered(ctx, job, func() ([]string, error) {
+		return t.buildFFmpegArgsWithFilters(job.Config, filterChain), nil
+	})
+}
+
+// ExecuteWithGraph выполняет транскодирование с графом фильтров
+// (-filter_complex). Основной вход графа - job.Config.InputPath, в выходной
+// файл попадают только потоки из FilterGraph.Map.
+func (t *Transcoder) ExecuteWithGraph(ctx context.Context, job *dto.Job, graph *FilterGraph) error {
+	return t.executeFiltered(ctx, job, func() ([]string, error) {
+		return t.buildFFmpegArgsWithGraph(job.Config, graph)
+	})
+}
+
+// executeFiltered выполняет задачу с аргументами FFmpeg от buildArgs
+func (t *Transcoder) executeFiltered(ctx context.Context, job *dto.Job, buildArgs func() ([]string, error)) error {
 	// Валидируем конфигурацию
 	if err := job.Config.Validate(); err != nil {
 		job.Status = dto.StatusFailed
 		job.Error = err
 		t.logger.Error("Ошибка валидации конфигурации: %v", err)
+		t.emit(EventJobFailed, job)
 		return fmt.Errorf("ошибка валидации конфигурации: %w", err)
 	}
 
+	// Строим аргументы с фильтрами
+	args, err := buildArgs()
+	if err != nil {
+		job.Status = dto.StatusFailed
+		job.Error = err
+		t.logger.Error("Ошибка построения графа фильтров: %v", err)
+		t.emit(EventJobFailed, job)
+		return fmt.Errorf("ошибка построения графа фильтров: %w", err)
+	}
+
 	job.Status = dto.StatusRunning
 	job.StartTime = time.Now()
+	t.emit(EventJobStarted, job)
 
 	t.logger.Info("Начало транскодирования с фильтрами: %s -> %s", job.Config.InputPath, job.Config.OutputPath)
-
-	// Строим аргументы с фильтрами
-	args := t.buildFFmpegArgsWithFilters(job.Config, filterChain)
 	t.logger.Debug("FFmpeg аргументы с фильтрами: %v", args)
 
-	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
-
-	if err := cmd.Run(); err != nil {
-		job.Status = dto.StatusFailed
+	if err := t.runJob(ctx, job, args); err != nil {
+		job.Status = failureStatus(ctx)
 		job.Error = err
 		job.EndTime = time.Now()
 		t.logger.Error("Ошибка выполнения FFmpeg с фильтрами: %v", err)
+		t.emit(finishEvent(job.Status), job)
 		return fmt.Errorf("ошибка транскодирования с фильтрами: %w", err)
 	}
 
 	job.Status = dto.StatusCompleted
 	job.Progress = 100.0
 	job.EndTime = time.Now()
+	t.emit(EventJobCompleted, job)
 
 	duration := job.EndTime.Sub(job.StartTime)
 	t.logger.Info("Транскодирование с фильтрами завершено за %v", duration)
@@ -337,7 +365,24 @@ func (t *Transcoder) buildFFmpegArgsWithFilters(config dto.Config, filterChain *
 		args = append(args, "-af", audioFilters)
 	}
 
-	// Остальные параметры как обычно
+	return appendOutputArgs(args, config)
+}
+
+// buildFFmpegArgsWithGraph строит аргументы FFmpeg с графом фильтров
+func (t *Transcoder) buildFFmpegArgsWithGraph(config dto.Config, graph *FilterGraph) ([]string, error) {
+	graphArgs, err := graph.Args()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"-i", config.InputPath}, graphArgs...)
+	args = append(args, "-y")
+	return appendOutputArgs(args, config), nil
+}
+
+// appendOutputArgs добавляет кодеки, битрейты, частоту кадров, качество,
+// формат и выходной файл
+func appendOutputArgs(args []string, config dto.Config) []string {
 	if config.VideoCodec != "" {
 		args = append(args, "-c:v", config.VideoCodec)
 	}
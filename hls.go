@@ -6,12 +6,15 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
 	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
 	"github.com/Mirsadikovv/ffmpeg_research/utils"
 )
 
@@ -19,7 +22,11 @@ import (
 type HLSDownloader struct {
 	transcoder *Transcoder
 	client     *http.Client
-	userAgent  string
+	// clients клиенты с прокси, CA bundle или ограничениями нагрузки
+	clientsMu sync.Mutex
+	clients   map[string]*http.Client
+	// pollInterval фиксированный период обновления live плейлиста (0 - по TARGETDURATION)
+	pollInterval time.Duration
 }
 
 // NewHLSDownloader создает новый загрузчик HLS
@@ -27,10 +34,35 @@ func NewHLSDownloader(transcoder *Transcoder) *HLSDownloader {
 	return &HLSDownloader{
 		transcoder: transcoder,
 		client:     utils.CreateHTTPClient(30 * time.Second),
-		userAgent:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+		clients:    make(map[string]*http.Client),
 	}
 }
 
+// clientFor возвращает HTTP клиент для конфигурации: общий клиент или,
+// если заданы прокси, CA bundle или ограничения нагрузки, отдельный клиент,
+// переиспользуемый между запросами с теми же настройками. Поэтому
+// ограничения на хост действуют для всех загрузок с одной конфигурацией.
+func (h *HLSDownloader) clientFor(config dto.HLSConfig) (*http.Client, error) {
+	if config.Proxy == "" && config.CABundle == "" && !utils.HasHostLimits(config) {
+		return h.client, nil
+	}
+
+	key := fmt.Sprintf("%s\n%s\n%d/%g/%d/%v", config.Proxy, config.CABundle,
+		config.RateLimit, config.RequestsPerSecond, config.MaxConnections, config.MaxRetryAfter)
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	if client, exists := h.clients[key]; exists {
+		return client, nil
+	}
+	client, err := utils.NewHTTPClient(config, h.client.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	h.clients[key] = client
+	return client, nil
+}
+
 // DownloadHLS загружает HLS стрим или плейлист
 func (h *HLSDownloader) DownloadHLS(ctx context.Context, config dto.HLSConfig) error {
 	// Валидируем конфигурацию HLS
@@ -38,69 +70,177 @@ func (h *HLSDownloader) DownloadHLS(ctx context.Context, config dto.HLSConfig) e
 		return fmt.Errorf("ошибка валидации HLS конфигурации: %w", err)
 	}
 
+	// MPD манифесты загружаются DASH загрузчиком
+	if isMPDURL(config.URL) {
+		return h.DownloadDASH(ctx, config)
+	}
+
 	// Проверяем, является ли URL плейлистом или прямой ссылкой
-	if strings.HasSuffix(config.URL, ".m3u8") || strings.Contains(config.URL, "m3u8") {
+	if isPlaylistURL(config.URL) {
 		return h.downloadPlaylist(ctx, config)
 	}
 
-	// Пытаемся найти плейлист по URL
-	playlistURL, err := utils.FindPlaylistURL(config.URL, h.client)
+	// Ищем манифест на странице и загружаем лучший найденный
+	candidates, err := h.DiscoverPlaylists(ctx, config)
 	if err != nil {
 		return fmt.Errorf("не удалось найти плейлист: %w", err)
 	}
 
-	config.URL = playlistURL
+	config.URL = candidates[0].URL
 	return h.downloadPlaylist(ctx, config)
 }
 
+// DiscoverPlaylists загружает страницу config.URL с заголовками, cookies и
+// прокси конфигурации и возвращает найденные манифесты по убыванию ранга
+func (h *HLSDownloader) DiscoverPlaylists(ctx context.Context, config dto.HLSConfig) ([]dto.PlaylistCandidate, error) {
+	fetch := func(ctx context.Context, pageURL string) (string, error) {
+		return h.fetchText(ctx, pageURL, config)
+	}
+	return utils.DiscoverPlaylists(ctx, config.URL, fetch)
+}
+
 // downloadPlaylist загружает плейлист
 func (h *HLSDownloader) downloadPlaylist(ctx context.Context, config dto.HLSConfig) error {
 	// Получаем информацию о плейлисте
-	info, err := h.GetPlaylistInfo(config.URL)
+	info, err := h.GetPlaylistInfoWithConfig(ctx, config)
 	if err != nil {
 		return fmt.Errorf("ошибка получения информации о плейлисте: %w", err)
 	}
 
+	if info.MPD != nil {
+		return h.downloadMPD(ctx, info, config)
+	}
+
 	// Выбираем поток по качеству
-	streamURL, err := utils.SelectStream(info, config.Quality)
+	streamURL, err := utils.SelectVariant(info, config)
 	if err != nil {
 		return fmt.Errorf("ошибка выбора потока: %w", err)
 	}
 
+	// Внешние аудио и субтитры выбранного варианта
+	tracks := []hlsTrack{{URL: streamURL}}
+	renditions := selectRenditions(info.Master, findVariant(info, streamURL), config)
+	if !supportsSubtitles(config.OutputPath) && hasSubtitleRenditions(renditions) {
+		h.transcoder.logger.Warn("Контейнер %s не поддерживает субтитры WebVTT, субтитры не загружаются", config.OutputPath)
+		renditions = withoutSubtitles(renditions)
+	}
+	for i := range renditions {
+		tracks = append(tracks, hlsTrack{URL: renditions[i].URI, Rendition: &renditions[i]})
+	}
+
+	// VOD плейлисты загружаются нативно, live и ограниченная по времени запись - через FFmpeg
+	if config.Duration == 0 {
+		native, err := h.loadNativeTracks(ctx, tracks, config)
+		if err != nil {
+			return err
+		}
+		if native {
+			return h.downloadNative(ctx, tracks, config)
+		}
+		h.transcoder.logger.Info("Плейлист использует SAMPLE-AES, нестандартный формат ключа, EXT-X-MAP или является live, загрузка через FFmpeg")
+	}
+
 	// Используем FFmpeg для загрузки
+	if len(tracks) > 1 {
+		return h.downloadTracksWithFFmpeg(ctx, tracks, config)
+	}
 	return h.downloadWithFFmpeg(ctx, streamURL, config)
 }
 
+// loadNativeTracks загружает медиаплейлисты видео и аудио дорожек и сообщает,
+// можно ли собрать их без FFmpeg. Субтитры всегда передаются FFmpeg по URL.
+func (h *HLSDownloader) loadNativeTracks(ctx context.Context, tracks []hlsTrack, config dto.HLSConfig) (bool, error) {
+	for i := range tracks {
+		if tracks[i].Rendition != nil && tracks[i].Rendition.Type == m3u8.RenditionSubtitles {
+			continue
+		}
+
+		content, err := h.fetchText(ctx, tracks[i].URL, config)
+		if err != nil {
+			return false, fmt.Errorf("ошибка загрузки медиаплейлиста: %w", err)
+		}
+
+		media, err := m3u8.ParseMedia(content, tracks[i].URL)
+		if err != nil || !media.EndList || len(media.Segments) == 0 || !canDownloadNatively(media) {
+			return false, nil
+		}
+		tracks[i].Playlist = media
+	}
+	return true, nil
+}
+
+// downloadTracksWithFFmpeg загружает вариант вместе с представлениями с помощью FFmpeg
+func (h *HLSDownloader) downloadTracksWithFFmpeg(ctx context.Context, tracks []hlsTrack, config dto.HLSConfig) error {
+	if err := utils.CheckFFmpegProxy(config); err != nil {
+		return err
+	}
+	h.warnFFmpegHostLimits(config)
+
+	inputs := make([]muxInput, 0, len(tracks))
+	for _, track := range tracks {
+		inputs = append(inputs, muxInput{
+			Path:      track.URL,
+			Options:   utils.BuildHTTPInputArgs(config),
+			Rendition: track.Rendition,
+		})
+	}
+	args := buildMuxArgs(inputs, config.OutputPath, config.Duration)
+
+	stderr := newTailBuffer(stderrTailLines)
+	err := runner.Run(ctx, h.transcoder.runner, runner.Command{
+		Path:   h.transcoder.ffmpegPath,
+		Args:   args,
+		Stdout: os.Stdout,
+		Stderr: io.MultiWriter(os.Stderr, stderr),
+	})
+	return newFFmpegError(args, err, stderr.String())
+}
+
+// warnFFmpegHostLimits предупреждает, что ограничения нагрузки на хост
+// не действуют на загрузку, которую выполняет FFmpeg
+func (h *HLSDownloader) warnFFmpegHostLimits(config dto.HLSConfig) {
+	if utils.HasHostLimits(config) {
+		h.transcoder.logger.Warn("Загрузка выполняется FFmpeg: RateLimit, RequestsPerSecond и MaxConnections не применяются")
+	}
+}
+
 // downloadWithFFmpeg загружает стрим с помощью FFmpeg
 func (h *HLSDownloader) downloadWithFFmpeg(ctx context.Context, streamURL string, config dto.HLSConfig) error {
-	args := utils.BuildHLSArgs(h.transcoder.ffmpegPath, streamURL, config)
-	cmd := exec.CommandContext(ctx, h.transcoder.ffmpegPath, args...)
+	if err := utils.CheckFFmpegProxy(config); err != nil {
+		return err
+	}
+	h.warnFFmpegHostLimits(config)
 
-	// Настраиваем вывод для отслеживания прогресса
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	args := utils.BuildHLSArgs(h.transcoder.ffmpegPath, streamURL, config)
 
-	return cmd.Run()
+	// Настраиваем вывод для отслеживания прогресса, сохраняя хвост stderr для ошибки
+	stderr := newTailBuffer(stderrTailLines)
+	err := runner.Run(ctx, h.transcoder.runner, runner.Command{
+		Path:   h.transcoder.ffmpegPath,
+		Args:   args,
+		Stdout: os.Stdout,
+		Stderr: io.MultiWriter(os.Stderr, stderr),
+	})
+	return newFFmpegError(args, err, stderr.String())
 }
 
-// GetPlaylistInfo получает информацию о плейлисте
+// GetPlaylistInfo получает информацию о плейлисте HLS или MPD манифесте
 func (h *HLSDownloader) GetPlaylistInfo(playlistURL string) (*dto.PlaylistInfo, error) {
-	resp, err := h.client.Get(playlistURL)
+	return h.GetPlaylistInfoWithConfig(context.Background(), dto.HLSConfig{URL: playlistURL})
+}
+
+// GetPlaylistInfoWithConfig получает информацию о плейлисте config.URL с
+// заголовками, cookies, прокси и CA bundle из конфигурации
+func (h *HLSDownloader) GetPlaylistInfoWithConfig(ctx context.Context, config dto.HLSConfig) (*dto.PlaylistInfo, error) {
+	content, err := h.fetchText(ctx, config.URL, config)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка загрузки плейлиста: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ошибка HTTP: %d", resp.StatusCode)
-	}
 
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("ошибка чтения плейлиста: %w", err)
+	if dash.IsMPD(content) {
+		return utils.ParseMPD(content, config.URL)
 	}
-
-	return utils.ParsePlaylist(string(content), playlistURL)
+	return utils.ParsePlaylist(content, config.URL)
 }
 
 // RecordLiveStream записывает live стрим с ограничением по времени
@@ -112,7 +252,19 @@ func (h *HLSDownloader) RecordLiveStream(ctx context.Context, streamURL, outputP
 		Quality:    "best",
 	}
 
-	return h.DownloadHLS(ctx, config)
+	// Страницы и MPD манифесты загружаются как прежде: с поиском манифеста
+	// и DASH загрузчиком
+	if isMPDURL(streamURL) || !isPlaylistURL(streamURL) {
+		return h.DownloadHLS(ctx, config)
+	}
+
+	_, err := h.RecordLive(ctx, config)
+	return err
+}
+
+// isPlaylistURL сообщает, похож ли URL на HLS плейлист, а не на страницу
+func isPlaylistURL(rawURL string) bool {
+	return strings.Contains(rawURL, "m3u8")
 }
 
 // ConvertHLSToFormat конвертирует загруженный HLS в другой формат
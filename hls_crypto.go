@@ -0,0 +1,175 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+)
+
+// ErrInvalidPadding ошибка PKCS#7 выравнивания после расшифровки сегмента
+var ErrInvalidPadding = errors.New("некорректное PKCS#7 выравнивание сегмента")
+
+// keyCache хранит загруженные ключи шифрования на время одной загрузки
+type keyCache struct {
+	mu   sync.Mutex
+	keys map[string]*keyFetch
+}
+
+// keyFetch загрузка одного ключа; done закрывается по ее завершении
+type keyFetch struct {
+	done chan struct{}
+	key  []byte
+	err  error
+}
+
+// newKeyCache создает пустой кэш ключей
+func newKeyCache() *keyCache {
+	return &keyCache{keys: make(map[string]*keyFetch)}
+}
+
+// get возвращает ключ по URI, загружая его при первом обращении.
+// Загрузка выполняется без блокировки кэша: параллельные запросы того же
+// ключа ждут одну загрузку, а уже загруженные ключи отдаются сразу.
+// Неудачные загрузки не кэшируются, чтобы повтор сегмента повторил и ключ.
+func (c *keyCache) get(ctx context.Context, h *HLSDownloader, uri string, config dto.HLSConfig) ([]byte, error) {
+	c.mu.Lock()
+	fetch, exists := c.keys[uri]
+	if !exists {
+		fetch = &keyFetch{done: make(chan struct{})}
+		c.keys[uri] = fetch
+	}
+	c.mu.Unlock()
+
+	if exists {
+		select {
+		case <-fetch.done:
+			return fetch.key, fetch.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	fetch.key, fetch.err = h.fetchKey(ctx, uri, config)
+	// Неустранимая ошибка (403, 404) остается в кэше, чтобы ключ не
+	// запрашивался заново для каждого сегмента
+	if fetch.err != nil && isRetryableFetchError(fetch.err) {
+		c.mu.Lock()
+		delete(c.keys, uri)
+		c.mu.Unlock()
+	}
+	close(fetch.done)
+	return fetch.key, fetch.err
+}
+
+// fetchKey загружает ключ AES-128 тем же HTTP клиентом, заголовками и cookies, что и сегменты
+func (h *HLSDownloader) fetchKey(ctx context.Context, uri string, config dto.HLSConfig) ([]byte, error) {
+	resp, err := h.get(ctx, uri, config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки ключа: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Читаем на байт больше, чтобы отличить ключ неверной длины
+	key, err := io.ReadAll(io.LimitReader(resp.Body, aes.BlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения ключа: %w", err)
+	}
+	if len(key) != aes.BlockSize {
+		return nil, fmt.Errorf("ключ %s должен быть %d байт", uri, aes.BlockSize)
+	}
+	return key, nil
+}
+
+// canDecryptNatively сообщает, может ли плейлист быть расшифрован без FFmpeg.
+// SAMPLE-AES и ключи в нестандартном формате (DRM) передаются FFmpeg.
+func canDecryptNatively(playlist *m3u8.MediaPlaylist) bool {
+	for _, segment := range playlist.Segments {
+		if segment.Key == nil {
+			continue
+		}
+		if segment.Key.Method != m3u8.KeyMethodAES128 || !segment.Key.IsIdentity() || segment.Key.URI == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentDecrypter возвращает функцию расшифровки сегмента или nil, если он не зашифрован
+func (h *HLSDownloader) segmentDecrypter(ctx context.Context, segment m3u8.Segment, config dto.HLSConfig, keys *keyCache) (func([]byte) ([]byte, error), error) {
+	if segment.Key == nil {
+		return nil, nil
+	}
+	if segment.Key.Method != m3u8.KeyMethodAES128 {
+		return nil, fmt.Errorf("метод шифрования %s не поддерживается", segment.Key.Method)
+	}
+
+	iv, err := segmentIV(segment.Key, segment.Sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keys.get(ctx, h, segment.Key.URI, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(data []byte) ([]byte, error) {
+		return decryptAES128(data, key, iv)
+	}, nil
+}
+
+// segmentIV возвращает вектор инициализации: явный IV из тега
+// или номер сегмента в виде 128-битного big-endian числа (RFC 8216, 5.2)
+func segmentIV(key *m3u8.Key, sequence int64) ([]byte, error) {
+	iv := make([]byte, aes.BlockSize)
+
+	if key.IV == "" {
+		binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+		return iv, nil
+	}
+
+	digits := strings.TrimPrefix(strings.TrimPrefix(key.IV, "0x"), "0X")
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+	decoded, err := hex.DecodeString(digits)
+	if err != nil || len(decoded) > aes.BlockSize {
+		return nil, fmt.Errorf("некорректный IV: %s", key.IV)
+	}
+
+	copy(iv[aes.BlockSize-len(decoded):], decoded)
+	return iv, nil
+}
+
+// decryptAES128 расшифровывает сегмент в режиме AES-128-CBC и снимает PKCS#7 выравнивание
+func decryptAES128(data, key, iv []byte) ([]byte, error) {
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("размер зашифрованного сегмента (%d) не кратен %d", len(data), aes.BlockSize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, ErrInvalidPadding
+	}
+	return plain[:len(plain)-padding], nil
+}
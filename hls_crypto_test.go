@@ -0,0 +1,271 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+)
+
+var (
+	testKey1 = []byte("0123456789abcdef")
+	testKey2 = []byte("fedcba9876543210")
+	testIV   = []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x12, 0x34}
+)
+
+// encryptAES128 шифрует данные как HLS упаковщик: AES-128-CBC с PKCS#7
+func encryptAES128(t *testing.T, data, key, iv []byte) []byte {
+	t.Helper()
+
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	plain := append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plain)
+	return encrypted
+}
+
+// sequenceIV возвращает IV по номеру сегмента
+func sequenceIV(sequence int64) []byte {
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+	return iv
+}
+
+// newEncryptedHLSServer отдает плейлист из трех зашифрованных сегментов
+// со сменой ключа. Ключи доступны только с cookie авторизации.
+func newEncryptedHLSServer(t *testing.T, method string) *httptest.Server {
+	t.Helper()
+
+	segments := map[string][]byte{
+		"/seg7.ts": encryptAES128(t, []byte("first segment"), testKey1, sequenceIV(7)),
+		"/seg8.ts": encryptAES128(t, []byte("second segment!!"), testKey1, sequenceIV(8)),
+		"/seg9.ts": encryptAES128(t, []byte("third segment"), testKey2, testIV),
+	}
+	keys := map[string][]byte{"/keys/1": testKey1, "/keys/2": testKey2}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:7\n"+
+			"#EXT-X-KEY:METHOD=%s,URI=\"keys/1\"\n#EXTINF:4.0,\nseg7.ts\n#EXTINF:4.0,\nseg8.ts\n"+
+			"#EXT-X-KEY:METHOD=%s,URI=\"keys/2\",IV=0x1234,KEYFORMAT=\"identity\"\n#EXTINF:4.0,\nseg9.ts\n"+
+			"#EXT-X-ENDLIST\n", method, method)
+	})
+	mux.HandleFunc("/keys/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "session=abc" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write(keys[r.URL.Path])
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		data, exists := segments[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParsePlaylistKeys(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server := newEncryptedHLSServer(t, m3u8.KeyMethodAES128)
+
+	info, err := tc.hls.GetPlaylistInfo(server.URL + "/index.m3u8")
+	if err != nil {
+		t.Fatalf("Ошибка получения информации о плейлисте: %v", err)
+	}
+
+	if len(info.Keys) != 2 {
+		t.Fatalf("Ожидалось 2 ключа, получено %d", len(info.Keys))
+	}
+	want := dto.KeyInfo{Method: "AES-128", URI: server.URL + "/keys/2", IV: "0x1234", KeyFormat: "identity"}
+	if info.Keys[1] != want {
+		t.Errorf("Ключ разобран неверно: %+v", info.Keys[1])
+	}
+}
+
+func TestFetchEncryptedSegments(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server := newEncryptedHLSServer(t, m3u8.KeyMethodAES128)
+
+	config := dto.HLSConfig{URL: server.URL + "/index.m3u8", RequestOptions: dto.RequestOptions{Cookies: "session=abc"}}
+	content, _ := tc.hls.fetchText(context.Background(), config.URL, config)
+	playlist, err := m3u8.ParseMedia(content, config.URL)
+	if err != nil {
+		t.Fatalf("Ошибка разбора плейлиста: %v", err)
+	}
+	if !canDecryptNatively(playlist) {
+		t.Fatal("AES-128 плейлист должен расшифровываться нативно")
+	}
+
+	workDir := t.TempDir()
+	if err := tc.hls.fetchSegments(context.Background(), playlist, config, workDir, nil); err != nil {
+		t.Fatalf("Ошибка загрузки сегментов: %v", err)
+	}
+
+	joined := filepath.Join(workDir, "joined.ts")
+	if err := concatSegments(playlist, workDir, joined); err != nil {
+		t.Fatalf("Ошибка склейки: %v", err)
+	}
+	data, _ := os.ReadFile(joined)
+	if string(data) != "first segmentsecond segment!!third segment" {
+		t.Errorf("Неожиданное содержимое после расшифровки: %q", data)
+	}
+
+	// Без cookie ключ недоступен, и ошибка 403 не повторяется
+	config.Cookies = ""
+	config.RetryAttempts = 3
+	err = tc.hls.fetchSegments(context.Background(), playlist, config, t.TempDir(), nil)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Ожидалась ошибка загрузки ключа, получено %v", err)
+	}
+}
+
+func TestDecryptAES128InvalidPadding(t *testing.T) {
+	encrypted := encryptAES128(t, []byte("payload"), testKey1, testIV)
+
+	if _, err := decryptAES128(encrypted, testKey2, testIV); err != ErrInvalidPadding {
+		t.Errorf("Ожидалась ErrInvalidPadding для неверного ключа, получено %v", err)
+	}
+	if isRetryableFetchError(ErrInvalidPadding) {
+		t.Error("Ошибка выравнивания не должна повторяться")
+	}
+}
+
+func TestSampleAESUsesFFmpeg(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	server := newEncryptedHLSServer(t, m3u8.KeyMethodSampleAES)
+
+	output := filepath.Join(t.TempDir(), "out.mp4")
+	err := tc.DownloadHLSWithConfig(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/index.m3u8",
+		OutputPath: output,
+		RequestOptions: dto.RequestOptions{
+			Cookies: "session=abc",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки HLS: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+	if !strings.Contains(args, server.URL+"/index.m3u8") {
+		t.Errorf("SAMPLE-AES плейлист должен загружаться FFmpeg, аргументы: %s", args)
+	}
+}
+
+func TestKeyCacheFetchesOutsideLock(t *testing.T) {
+	release := make(chan struct{})
+	var slowRequests atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fast.key", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte{1}, aes.BlockSize))
+	})
+	mux.HandleFunc("/slow.key", func(w http.ResponseWriter, r *http.Request) {
+		slowRequests.Add(1)
+		<-release
+		w.Write(bytes.Repeat([]byte{2}, aes.BlockSize))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tc, _ := newFakeTranscoder(t)
+	keys := newKeyCache()
+	ctx := context.Background()
+	config := dto.HLSConfig{}
+
+	if _, err := keys.get(ctx, tc.hls, server.URL+"/fast.key", config); err != nil {
+		t.Fatalf("Ошибка загрузки ключа: %v", err)
+	}
+
+	// Два параллельных запроса медленного ключа ждут одну загрузку
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := keys.get(ctx, tc.hls, server.URL+"/slow.key", config)
+			results <- err
+		}()
+	}
+
+	// Загруженный ключ отдается, пока медленная загрузка не завершена
+	done := make(chan error, 1)
+	go func() {
+		_, err := keys.get(ctx, tc.hls, server.URL+"/fast.key", config)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Ошибка получения ключа из кэша: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ключ из кэша ждет загрузки другого ключа")
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("Ошибка загрузки медленного ключа: %v", err)
+		}
+	}
+	if n := slowRequests.Load(); n != 1 {
+		t.Errorf("Ожидался 1 запрос медленного ключа, получено %d", n)
+	}
+}
+
+func TestKeyForbiddenFetchedOnce(t *testing.T) {
+	var keyRequests atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/forbidden.key", func(w http.ResponseWriter, r *http.Request) {
+		keyRequests.Add(1)
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	playlist := &m3u8.MediaPlaylist{}
+	for seq := int64(0); seq < 8; seq++ {
+		playlist.Segments = append(playlist.Segments, m3u8.Segment{
+			URI:      fmt.Sprintf("%s/seg%d.ts", server.URL, seq),
+			Sequence: seq,
+			Key:      &m3u8.Key{Method: m3u8.KeyMethodAES128, URI: server.URL + "/forbidden.key"},
+		})
+	}
+
+	// 403 на ключ не повторяется ни для сегмента, ни для остальных сегментов
+	tc, _ := newFakeTranscoder(t)
+	config := dto.HLSConfig{RetryAttempts: 3, Concurrency: 4}
+	err := tc.hls.fetchSegments(context.Background(), playlist, config, t.TempDir(), nil)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Ожидалась ошибка 403 загрузки ключа, получено %v", err)
+	}
+	if n := keyRequests.Load(); n != 1 {
+		t.Errorf("Ожидался 1 запрос ключа, получено %d", n)
+	}
+}
@@ -0,0 +1,83 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+func TestDiscoverPlaylists(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watch/page.html", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>
+<video controls><source src="../media/main.m3u8?token=a&amp;b=1" type="application/x-mpegURL"></video>
+<div data-dash="/media/main.mpd"></div>
+<img src="/poster.jpg">
+<video src="blob:https://example.com/123"></video>
+<script>var config = {"hls":"https:\/\/cdn.example.com\/live\/stream.m3u8"};</script>
+<iframe src="/embed/player"></iframe>
+</body></html>`)
+	})
+	mux.HandleFunc("/embed/player", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<video src="frame.m3u8"></video><source src="../media/main.m3u8?token=a&b=1">`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tc, _ := newFakeTranscoder(t)
+	pageURL := server.URL + "/watch/page.html"
+
+	candidates, err := tc.DiscoverPlaylists(context.Background(), dto.HLSConfig{URL: pageURL})
+	if err != nil {
+		t.Fatalf("DiscoverPlaylists вернул ошибку: %v", err)
+	}
+
+	want := []dto.PlaylistCandidate{
+		{URL: server.URL + "/media/main.m3u8?token=a&b=1", Kind: dto.ManifestHLS, Source: dto.SourceSourceTag, Page: pageURL, Score: 100},
+		{URL: server.URL + "/media/main.mpd", Kind: dto.ManifestDASH, Source: dto.SourceAttribute, Page: pageURL, Score: 70},
+		{URL: server.URL + "/embed/frame.m3u8", Kind: dto.ManifestHLS, Source: dto.SourceVideoTag, Page: server.URL + "/embed/player", Score: 70},
+		{URL: "https://cdn.example.com/live/stream.m3u8", Kind: dto.ManifestHLS, Source: dto.SourceScript, Page: pageURL, Score: 50},
+	}
+	if len(candidates) != len(want) {
+		t.Fatalf("ожидалось %d кандидатов, получено %d: %+v", len(want), len(candidates), candidates)
+	}
+	for i := range want {
+		if candidates[i] != want[i] {
+			t.Errorf("кандидат %d: ожидалось %+v, получено %+v", i, want[i], candidates[i])
+		}
+	}
+}
+
+func TestDiscoverPlaylistsNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><iframe src="/missing"></iframe><a href="/about">about</a></html>`)
+	}))
+	defer server.Close()
+
+	tc, _ := newFakeTranscoder(t)
+	if _, err := tc.DiscoverPlaylists(context.Background(), dto.HLSConfig{URL: server.URL}); err == nil {
+		t.Fatal("ожидалась ошибка для страницы без манифестов")
+	}
+}
+
+func TestDiscoverPlaylistsAttributeOrder(t *testing.T) {
+	pageURL := "https://example.com/watch/page.html"
+	content := `<div data-hls="a.m3u8" data-dash="b.mpd"></div>`
+
+	// Кандидаты из атрибутов одного тега идут в порядке следования атрибутов;
+	// повтор разбора ловит недетерминированный обход
+	for i := 0; i < 20; i++ {
+		candidates, _ := utils.ParsePlaylistCandidates(content, pageURL)
+		if len(candidates) < 2 ||
+			candidates[0].URL != "https://example.com/watch/a.m3u8" ||
+			candidates[1].URL != "https://example.com/watch/b.mpd" {
+			t.Fatalf("Неверный порядок кандидатов: %+v", candidates)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// liveEdgeSegments без StartOffset запись начинается за столько сегментов
+// до конца плейлиста (RFC 8216, 6.3.3)
+const liveEdgeSegments = 3
+
+// liveRecorder состояние записи одного live стрима
+type liveRecorder struct {
+	h         *HLSDownloader
+	config    dto.HLSConfig
+	streamURL string
+	workDir   string
+	output    *os.File
+	keys      *keyCache
+	nextSeq   int64
+	nextPart  int   // Следующая часть сегмента nextSeq (LL-HLS)
+	windowSeq int64 // MEDIA-SEQUENCE предыдущего обновления плейлиста
+	lastMap   string
+	result    *dto.LiveRecordResult
+}
+
+// RecordLive записывает live стрим, обновляя медиаплейлист с периодом
+// TARGETDURATION. Сегменты отслеживаются по MEDIA-SEQUENCE: повторы
+// пропускаются, пропуски попадают в результат. Запись останавливается
+// по EXT-X-ENDLIST, по достижении config.Duration или отменой ctx;
+// во всех случаях записанная часть сохраняется в config.OutputPath.
+//
+// Если сервер поддерживает Low-Latency HLS (EXT-X-PART-INF и
+// CAN-BLOCK-RELOAD=YES), плейлист запрашивается блокирующими обновлениями
+// (_HLS_msn/_HLS_part), а незавершенный сегмент дописывается по частям
+// сразу после их появления.
+func (h *HLSDownloader) RecordLive(ctx context.Context, config dto.HLSConfig) (*dto.LiveRecordResult, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("ошибка валидации HLS конфигурации: %w", err)
+	}
+
+	info, err := h.GetPlaylistInfoWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения информации о плейлисте: %w", err)
+	}
+	if info.MPD != nil {
+		return nil, fmt.Errorf("live запись MPD манифестов не поддерживается")
+	}
+
+	streamURL, err := utils.SelectVariant(info, config)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выбора потока: %w", err)
+	}
+
+	workDir, err := os.MkdirTemp(h.transcoder.tempDir, "live_")
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать рабочую директорию: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	joinedPath := filepath.Join(workDir, "live.ts")
+	output, err := os.Create(joinedPath)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать файл записи: %w", err)
+	}
+
+	recorder := &liveRecorder{
+		h:         h,
+		config:    config,
+		streamURL: streamURL,
+		workDir:   workDir,
+		output:    output,
+		keys:      newKeyCache(),
+		result:    &dto.LiveRecordResult{OutputPath: config.OutputPath},
+	}
+
+	err = recorder.run(ctx)
+	if closeErr := output.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return recorder.result, err
+	}
+
+	if recorder.result.Segments == 0 {
+		return recorder.result, fmt.Errorf("не записано ни одного сегмента")
+	}
+
+	// Ремукс выполняется и после отмены ctx, чтобы сохранить записанное
+	inputs := []muxInput{{Path: joinedPath}}
+	if err := h.remux(context.WithoutCancel(ctx), inputs, config.OutputPath); err != nil {
+		return recorder.result, err
+	}
+	return recorder.result, nil
+}
+
+// run обновляет плейлист и дописывает новые сегменты до условия остановки
+func (r *liveRecorder) run(ctx context.Context) error {
+	started := false
+
+	for {
+		playlist, err := r.poll(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		r.result.Polls++
+
+		if !started {
+			if !canDecryptNatively(playlist) {
+				return fmt.Errorf("live запись с SAMPLE-AES или нестандартным форматом ключа не поддерживается")
+			}
+			r.nextSeq = r.startSequence(playlist)
+			r.result.LowLatency = supportsBlockingReload(playlist)
+			if r.result.LowLatency {
+				r.h.transcoder.logger.Info("Стрим поддерживает LL-HLS, части по %v", playlist.PartTargetDuration)
+			}
+			started = true
+		}
+
+		added, done, err := r.record(ctx, playlist)
+		if err != nil {
+			return err
+		}
+		if done || ctx.Err() != nil {
+			return nil
+		}
+		if playlist.EndList {
+			r.result.EndList = true
+			return nil
+		}
+
+		if r.result.LowLatency && added > 0 {
+			// Следующий блокирующий запрос сам дождется новой части
+			continue
+		}
+
+		// Если плейлист не изменился, следующий запрос через половину TARGETDURATION (RFC 8216, 6.3.4)
+		wait := playlist.TargetDuration
+		if r.result.LowLatency {
+			wait = playlist.PartTargetDuration
+		}
+		if added == 0 {
+			wait /= 2
+		}
+		if wait <= 0 {
+			wait = time.Second
+		}
+		if r.h.pollInterval > 0 {
+			wait = r.h.pollInterval
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil
+		}
+	}
+}
+
+// poll загружает и разбирает медиаплейлист с повторами при ошибках
+func (r *liveRecorder) poll(ctx context.Context) (*m3u8.MediaPlaylist, error) {
+	attempts := r.config.RetryAttempts + 1
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var content string
+		if content, err = r.h.fetchText(ctx, r.reloadURL(), r.config); err == nil {
+			return m3u8.ParseMedia(content, r.streamURL)
+		}
+
+		if ctx.Err() != nil || !isRetryableFetchError(err) || attempt == attempts {
+			break
+		}
+		if sleepErr := sleepContext(ctx, retryDelay(err, attempt, r.config)); sleepErr != nil {
+			return nil, sleepErr
+		}
+	}
+	return nil, fmt.Errorf("ошибка обновления плейлиста: %w", err)
+}
+
+// reloadURL возвращает адрес обновления плейлиста. В режиме LL-HLS запрос
+// блокируется сервером до появления следующей нужной части.
+func (r *liveRecorder) reloadURL() string {
+	if !r.result.LowLatency {
+		return r.streamURL
+	}
+
+	parsed, err := url.Parse(r.streamURL)
+	if err != nil {
+		return r.streamURL
+	}
+	query := parsed.Query()
+	query.Set("_HLS_msn", strconv.FormatInt(r.nextSeq, 10))
+	query.Set("_HLS_part", strconv.Itoa(r.nextPart))
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// supportsBlockingReload проверяет, можно ли записывать стрим по частям.
+// Части зашифрованных сегментов не расшифровываются по отдельности,
+// поэтому такие стримы записываются целыми сегментами.
+func supportsBlockingReload(playlist *m3u8.MediaPlaylist) bool {
+	if playlist.ServerControl == nil || !playlist.ServerControl.CanBlockReload || playlist.PartTargetDuration <= 0 {
+		return false
+	}
+	for _, segment := range playlist.Segments {
+		if segment.Key != nil {
+			return false
+		}
+	}
+	for _, part := range playlist.PendingParts {
+		if part.Key != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// startSequence выбирает первый сегмент записи: за StartOffset до конца
+// плейлиста (DVR окно) или за liveEdgeSegments сегментов до live-края.
+// Завершенный (EXT-X-ENDLIST) или VOD плейлист записывается целиком.
+func (r *liveRecorder) startSequence(playlist *m3u8.MediaPlaylist) int64 {
+	segments := playlist.Segments
+	if len(segments) == 0 {
+		return playlist.MediaSequence
+	}
+	if playlist.EndList || playlist.PlaylistType == "VOD" {
+		return segments[0].Sequence
+	}
+
+	start := len(segments) - liveEdgeSegments
+	if r.config.StartOffset > 0 {
+		var rewind time.Duration
+		for start = len(segments) - 1; start >= 0; start-- {
+			rewind += segments[start].Duration
+			if rewind >= r.config.StartOffset {
+				break
+			}
+		}
+		if rewind < r.config.StartOffset {
+			r.h.transcoder.logger.Warn("DVR окно (%v) короче запрошенного смещения %v", playlist.TotalDuration(), r.config.StartOffset)
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+
+	return segments[start].Sequence
+}
+
+// record дописывает новые сегменты плейлиста, а в режиме LL-HLS - и части
+// незавершенного сегмента. Возвращает количество новых сегментов и частей
+// и признак достижения config.Duration.
+func (r *liveRecorder) record(ctx context.Context, playlist *m3u8.MediaPlaylist) (int, bool, error) {
+	added := 0
+
+	if r.sequenceReset(playlist) {
+		r.result.Resets++
+		r.h.transcoder.logger.Warn("MEDIA-SEQUENCE сброшен с %d на %d, запись продолжается с нового окна",
+			r.windowSeq, playlist.MediaSequence)
+		r.nextSeq = playlist.Segments[0].Sequence
+		r.nextPart = 0
+	}
+	r.windowSeq = playlist.MediaSequence
+
+	for _, segment := range playlist.Segments {
+		if segment.Sequence < r.nextSeq {
+			continue
+		}
+		if segment.Sequence > r.nextSeq {
+			reason := "сегменты выпали из окна плейлиста"
+			if r.nextPart > 0 {
+				reason = "сегменты выпали из окна плейлиста, первый записан частично"
+			}
+			r.addGap(r.nextSeq, segment.Sequence-1, reason)
+			r.nextPart = 0
+		}
+		r.nextSeq = segment.Sequence + 1
+		added++
+
+		// Начатый по частям сегмент дописывается оставшимися частями
+		written := r.nextPart
+		r.nextPart = 0
+
+		var err error
+		switch {
+		case written == 0:
+			err = r.writeSegment(ctx, segment)
+		case written <= len(segment.Parts):
+			_, err = r.writeParts(ctx, segment.Sequence, segment.Parts[written:])
+		default:
+			err = fmt.Errorf("части сегмента выпали из плейлиста после записи %d из них", written)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return added, true, nil
+			}
+			// Ошибки локальной файловой системы не являются пропуском в стриме
+			var pathErr *os.PathError
+			if errors.As(err, &pathErr) {
+				return added, true, err
+			}
+			r.addGap(segment.Sequence, segment.Sequence, fmt.Sprintf("ошибка загрузки: %v", err))
+			continue
+		}
+
+		if r.result.Segments == 0 {
+			r.result.FirstSequence = segment.Sequence
+		}
+		r.result.Segments++
+		r.result.LastSequence = segment.Sequence
+		r.result.Duration += segment.Duration
+
+		if r.config.Duration > 0 && r.result.Duration >= r.config.Duration {
+			return added, true, nil
+		}
+	}
+
+	pendingSeq := playlist.MediaSequence + int64(len(playlist.Segments))
+	if !r.result.LowLatency || pendingSeq != r.nextSeq || len(playlist.PendingParts) <= r.nextPart {
+		return added, false, nil
+	}
+
+	written, err := r.writeParts(ctx, pendingSeq, playlist.PendingParts[r.nextPart:])
+	r.nextPart += written
+	added += written
+	if err != nil {
+		if ctx.Err() != nil {
+			return added, true, nil
+		}
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			return added, true, err
+		}
+		// Часть запрашивается снова при следующем обновлении, а если она так
+		// и не загрузится - сегмент станет пропуском при его завершении
+		r.h.transcoder.logger.Warn("Ошибка загрузки части сегмента %d: %v", r.nextSeq, err)
+	}
+	return added, false, nil
+}
+
+// sequenceReset сообщает, что нумерация сегментов началась заново
+// (перезапуск энкодера): все окно нового плейлиста лежит ниже начала
+// предыдущего. Иначе его сегменты пропускались бы как уже записанные,
+// пока номер не догонит прежний.
+func (r *liveRecorder) sequenceReset(playlist *m3u8.MediaPlaylist) bool {
+	if r.result.Polls <= 1 || len(playlist.Segments) == 0 {
+		return false
+	}
+	return playlist.Segments[len(playlist.Segments)-1].Sequence < r.windowSeq
+}
+
+// writeSegment загружает сегмент (и новую секцию инициализации) и дописывает в запись
+func (r *liveRecorder) writeSegment(ctx context.Context, segment m3u8.Segment) error {
+	path := filepath.Join(r.workDir, "segment.ts")
+	defer os.Remove(path)
+
+	if err := r.writeMap(ctx, segment.Map, path); err != nil {
+		return err
+	}
+	if err := r.h.fetchSegment(ctx, segment, r.config, r.keys, path); err != nil {
+		return err
+	}
+	return appendFile(r.output, path)
+}
+
+// writeParts дописывает части сегмента sequence по порядку. Возвращает
+// количество записанных частей; на первой ошибке запись прекращается.
+func (r *liveRecorder) writeParts(ctx context.Context, sequence int64, parts []m3u8.PartialSegment) (int, error) {
+	path := filepath.Join(r.workDir, "part.ts")
+	defer os.Remove(path)
+
+	for i, part := range parts {
+		if part.Gap {
+			return i, fmt.Errorf("часть %s отмечена как недоступная (GAP)", part.URI)
+		}
+		if err := r.writeMap(ctx, part.Map, path); err != nil {
+			return i, err
+		}
+
+		segment := m3u8.Segment{URI: part.URI, Duration: part.Duration, Sequence: sequence, ByteRange: part.ByteRange}
+		if err := r.h.fetchSegment(ctx, segment, r.config, r.keys, path); err != nil {
+			return i, err
+		}
+		if err := appendFile(r.output, path); err != nil {
+			return i, err
+		}
+		r.result.Parts++
+	}
+	return len(parts), nil
+}
+
+// writeMap дописывает секцию инициализации, если она сменилась
+func (r *liveRecorder) writeMap(ctx context.Context, segmentMap *m3u8.Map, path string) error {
+	if segmentMap == nil || segmentMap.URI == r.lastMap {
+		return nil
+	}
+
+	mapSegment := m3u8.Segment{URI: segmentMap.URI, ByteRange: segmentMap.ByteRange}
+	if err := r.h.fetchSegment(ctx, mapSegment, r.config, r.keys, path); err != nil {
+		return err
+	}
+	if err := appendFile(r.output, path); err != nil {
+		return err
+	}
+	r.lastMap = segmentMap.URI
+	return nil
+}
+
+// addGap добавляет пропуск в результат и пишет предупреждение
+func (r *liveRecorder) addGap(from, to int64, reason string) {
+	r.h.transcoder.logger.Warn("Пропущены сегменты %d-%d: %s", from, to, reason)
+	r.result.Gaps = append(r.result.Gaps, dto.SequenceGap{From: from, To: to, Reason: reason})
+}
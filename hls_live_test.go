@@ -0,0 +1,415 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+)
+
+// newLiveTestServer эмулирует live стрим: каждое обновление плейлиста
+// сдвигает окно сегментов. На третьем обновлении окно перескакивает
+// (сегменты 17-18 выпадают), сегмент 20 всегда отвечает 404,
+// на четвертом обновлении появляется EXT-X-ENDLIST.
+func newLiveTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	windows := []struct {
+		first, last int64
+		endList     bool
+	}{
+		{10, 14, false},
+		{12, 16, false},
+		{19, 21, false},
+		{19, 22, true},
+	}
+
+	var mu sync.Mutex
+	poll := 0
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000000\nlive.m3u8\n")
+	})
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		window := windows[poll]
+		if poll < len(windows)-1 {
+			poll++
+		}
+		mu.Unlock()
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n", window.first)
+		for seq := window.first; seq <= window.last; seq++ {
+			fmt.Fprintf(&b, "#EXTINF:2.0,\nseg%d.ts\n", seq)
+		}
+		if window.endList {
+			b.WriteString("#EXT-X-ENDLIST\n")
+		}
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/seg20.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRecordLive(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	tc.hls.pollInterval = time.Millisecond
+	server := newLiveTestServer(t)
+
+	output := filepath.Join(t.TempDir(), "live.mp4")
+	result, err := tc.RecordLive(context.Background(), dto.HLSConfig{
+		URL:         server.URL + "/master.m3u8",
+		OutputPath:  output,
+		StartOffset: 3 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+
+	// Старт за 3 секунды до края: сегменты 13 и 14
+	if result.FirstSequence != 13 || result.LastSequence != 22 || result.Segments != 7 {
+		t.Errorf("Неверный диапазон записи: %+v", result)
+	}
+	if !result.EndList || result.Polls != 4 || result.Duration != 14*time.Second {
+		t.Errorf("Неверный итог записи: %+v", result)
+	}
+
+	var gaps [][2]int64
+	for _, gap := range result.Gaps {
+		gaps = append(gaps, [2]int64{gap.From, gap.To})
+	}
+	if want := [][2]int64{{17, 18}, {20, 20}}; !reflect.DeepEqual(gaps, want) {
+		t.Errorf("Ожидались пропуски %v, получено %v", want, gaps)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	if args := calls[len(calls)-1].Args; !strings.HasSuffix(args[1], "live.ts") || args[len(args)-1] != output {
+		t.Errorf("Неверный ремукс записи: %v", args)
+	}
+}
+
+func TestRecordLiveDurationLimit(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	tc.hls.pollInterval = time.Millisecond
+	server := newLiveTestServer(t)
+
+	result, err := tc.RecordLive(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/master.m3u8",
+		OutputPath: filepath.Join(t.TempDir(), "live.mp4"),
+		Duration:   5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+
+	// Без смещения запись начинается за три сегмента до края: 12, 13, 14
+	if result.FirstSequence != 12 || result.LastSequence != 14 || result.EndList || len(result.Gaps) != 0 {
+		t.Errorf("Неверный итог записи с ограничением: %+v", result)
+	}
+}
+
+// newEndedTestServer отдает завершенный (EXT-X-ENDLIST) плейлист из шести
+// сегментов и страницу со ссылкой на него; запоминает запрошенные сегменты
+func newEndedTestServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		segments []string
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><video src="/vod/index.m3u8"></video></html>`)
+	})
+	mux.HandleFunc("/vod/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n")
+		for seq := 0; seq < 6; seq++ {
+			fmt.Fprintf(&b, "#EXTINF:2.0,\nseg%d.ts\n", seq)
+		}
+		b.WriteString("#EXT-X-ENDLIST\n")
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/vod/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		segments = append(segments, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), segments...)
+	}
+}
+
+func TestRecordLiveEndedPlaylist(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server, segments := newEndedTestServer(t)
+
+	result, err := tc.RecordLive(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/vod/index.m3u8",
+		OutputPath: filepath.Join(t.TempDir(), "live.mp4"),
+	})
+	if err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+
+	// Завершенный плейлист записывается с первого сегмента, а не с live-края
+	if result.FirstSequence != 0 || result.LastSequence != 5 || result.Segments != 6 || !result.EndList {
+		t.Errorf("Неверный итог записи завершенного плейлиста: %+v", result)
+	}
+	if got := segments(); len(got) != 6 {
+		t.Errorf("Ожидалась загрузка 6 сегментов, запросы: %v", got)
+	}
+}
+
+func TestRecordLiveStreamDiscovery(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	server, _ := newEndedTestServer(t)
+
+	// Страница, а не плейлист: манифест ищется, как в DownloadHLS, и
+	// ограниченная по времени загрузка выполняется FFmpeg
+	err := tc.RecordLiveStream(context.Background(), server.URL+"/page.html", filepath.Join(t.TempDir(), "live.mp4"), time.Minute)
+	if err != nil {
+		t.Fatalf("Ошибка записи со страницы: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := calls[len(calls)-1].Args
+	if input := indexOf(args, "-i"); input < 0 || args[input+1] != server.URL+"/vod/index.m3u8" {
+		t.Errorf("Ожидалась загрузка найденного плейлиста, аргументы: %v", args)
+	}
+}
+
+func TestRecordLiveSequenceReset(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	tc.hls.pollInterval = time.Millisecond
+
+	// На третьем запросе энкодер перезапущен и нумерация начинается с нуля
+	windows := []struct {
+		first, last int64
+		endList     bool
+	}{
+		{100, 104, false},
+		{102, 106, false},
+		{0, 2, false},
+		{0, 3, true},
+	}
+
+	var mu sync.Mutex
+	poll := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		window := windows[poll]
+		if poll < len(windows)-1 {
+			poll++
+		}
+		mu.Unlock()
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n", window.first)
+		for seq := window.first; seq <= window.last; seq++ {
+			fmt.Fprintf(&b, "#EXTINF:2.0,\nseg%d.ts\n", seq)
+		}
+		if window.endList {
+			b.WriteString("#EXT-X-ENDLIST\n")
+		}
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	result, err := tc.RecordLive(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/live.m3u8",
+		OutputPath: filepath.Join(t.TempDir(), "live.mp4"),
+	})
+	if err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+
+	// Первое окно получает GetPlaylistInfo: записаны 104-106 до сброса и 0-3
+	// после него, без ложных пропусков
+	if result.Resets != 1 || result.Segments != 7 || result.FirstSequence != 104 || result.LastSequence != 3 || len(result.Gaps) != 0 {
+		t.Errorf("Неверный итог записи со сбросом MEDIA-SEQUENCE: %+v", result)
+	}
+}
+
+// newLowLatencyTestServer эмулирует LL-HLS стрим из сегментов 0-5 по две
+// части. Блокирующий запрос (_HLS_msn/_HLS_part) сдвигает live-край до
+// запрошенной части; после сегмента 5 появляется EXT-X-ENDLIST.
+func newLowLatencyTestServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	const partsPerSegment, lastSegment = 2, 5
+
+	var (
+		mu       sync.Mutex
+		requests []string
+		// Live-край: доступны части 0..edgePart сегмента edgeSeq
+		edgeSeq, edgePart int64 = 3, 0
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/live.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, r.URL.String())
+
+		if msn := r.URL.Query().Get("_HLS_msn"); msn != "" {
+			seq, _ := strconv.ParseInt(msn, 10, 64)
+			part, _ := strconv.ParseInt(r.URL.Query().Get("_HLS_part"), 10, 64)
+			if part >= partsPerSegment {
+				seq, part = seq+1, 0
+			}
+			if seq > edgeSeq || (seq == edgeSeq && part > edgePart) {
+				edgeSeq, edgePart = seq, part
+			}
+		}
+
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-PART-INF:PART-TARGET=1.0\n")
+		b.WriteString("#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=3.0\n#EXT-X-MEDIA-SEQUENCE:0\n")
+		for seq := int64(0); seq < edgeSeq && seq <= lastSegment; seq++ {
+			for part := 0; part < partsPerSegment; part++ {
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=1.0,URI=\"seg%d.part%d.ts\"\n", seq, part)
+			}
+			fmt.Fprintf(&b, "#EXTINF:2.0,\nseg%d.ts\n", seq)
+		}
+		if edgeSeq > lastSegment {
+			b.WriteString("#EXT-X-ENDLIST\n")
+		} else {
+			for part := int64(0); part <= edgePart; part++ {
+				fmt.Fprintf(&b, "#EXT-X-PART:DURATION=1.0,URI=\"seg%d.part%d.ts\"\n", edgeSeq, part)
+			}
+		}
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestRecordLiveLowLatency(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server, requests := newLowLatencyTestServer(t)
+
+	result, err := tc.RecordLive(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/live.m3u8",
+		OutputPath: filepath.Join(t.TempDir(), "live.mp4"),
+	})
+	if err != nil {
+		t.Fatalf("Ошибка записи: %v", err)
+	}
+
+	// Сегменты 0-2 записаны целиком, 3-5 - по частям по мере появления
+	if !result.LowLatency || !result.EndList || result.Segments != 6 || result.Parts != 6 || len(result.Gaps) != 0 {
+		t.Errorf("Неверный итог записи LL-HLS: %+v", result)
+	}
+
+	got := strings.Join(requests(), "\n")
+	for _, want := range []string{"/seg2.ts", "/seg3.part0.ts", "/seg5.part1.ts", "/live.m3u8?_HLS_msn=4&_HLS_part=1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Не запрошен %s, запросы:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"/seg2.part", "/seg3.ts", "/seg5.ts"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Лишний запрос %s, запросы:\n%s", unwanted, got)
+		}
+	}
+}
+
+// recordingLogger запоминает предупреждения
+type recordingLogger struct {
+	NoOpLogger
+	mu    sync.Mutex
+	warns []string
+}
+
+func (l *recordingLogger) Warn(msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warns = append(l.warns, fmt.Sprintf(msg, args...))
+}
+
+func (l *recordingLogger) Warnings() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.warns...)
+}
+
+func TestLiveStartSequence(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	playlist := &m3u8.MediaPlaylist{MediaSequence: 10}
+	for seq := int64(10); seq <= 14; seq++ {
+		playlist.Segments = append(playlist.Segments, m3u8.Segment{Sequence: seq, Duration: 2 * time.Second})
+	}
+
+	tests := []struct {
+		offset   time.Duration
+		wantSeq  int64
+		wantWarn bool
+	}{
+		{0, 12, false},
+		{3 * time.Second, 13, false},
+		{10 * time.Second, 10, false}, // Окно покрыто ровно, включая сегмент 0
+		{11 * time.Second, 10, true},
+	}
+
+	for _, tt := range tests {
+		logger := &recordingLogger{}
+		tc.SetLogger(logger)
+
+		recorder := &liveRecorder{h: tc.hls, config: dto.HLSConfig{StartOffset: tt.offset}}
+		if got := recorder.startSequence(playlist); got != tt.wantSeq {
+			t.Errorf("StartOffset %v: ожидался сегмент %d, получен %d", tt.offset, tt.wantSeq, got)
+		}
+		if warned := len(logger.Warnings()) > 0; warned != tt.wantWarn {
+			t.Errorf("StartOffset %v: предупреждение %v, ожидалось %v", tt.offset, warned, tt.wantWarn)
+		}
+	}
+}
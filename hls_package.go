@@ -0,0 +1,501 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+const (
+	// defaultPackageSegment длительность сегмента по умолчанию
+	defaultPackageSegment = 6 * time.Second
+	// defaultMasterPlaylist имя мастер-плейлиста по умолчанию
+	defaultMasterPlaylist = "master.m3u8"
+	// defaultDASHManifest имя MPD манифеста по умолчанию
+	defaultDASHManifest = "manifest.mpd"
+	// segmentFormatFMP4 сегменты fragmented MP4 (CMAF)
+	segmentFormatFMP4 = "fmp4"
+	// fmp4SegmentName имя сегмента fMP4 для FFmpeg и соответствующий шаблон DASH
+	fmp4SegmentName  = "seg_%05d.m4s"
+	dashSegmentMedia = "seg_$Number%05d$.m4s"
+	// dashTimescale единицы SegmentTimeline в секунду
+	dashTimescale = 1000
+)
+
+// ladderRung подготовленное качество лестницы битрейтов
+type ladderRung struct {
+	width        int
+	height       int
+	videoCodec   string
+	audioCodec   string
+	videoBitrate int64
+	audioBitrate int64
+	frameRate    float64
+	level        string // Уровень профиля кодека в десятичной записи (3.1) для -level, level-idc и CODECS
+}
+
+// audioRung параметры кодирования аудиопотока
+type audioRung struct {
+	codec   string
+	bitrate int64
+}
+
+// ladderLayout раскладка закодированных потоков по вариантам stream_%v.
+// Качества видео занимают stream_0..N-1. Аудио либо входит в каждое
+// качество, либо (для DASH) выделено в отдельные варианты stream_N+k.
+type ladderLayout struct {
+	rungs    []ladderRung
+	audio    []audioRung // Аудиопотоки в порядке -map
+	audioOf  []int       // Индекс аудиопотока для каждого качества
+	demuxed  bool        // Аудио в отдельных вариантах
+	hasAudio bool
+}
+
+// newLadderLayout раскладывает потоки. При демультиплексировании
+// одинаковые по кодеку и битрейту аудиопотоки кодируются один раз.
+func newLadderLayout(rungs []ladderRung, hasAudio, demux bool) ladderLayout {
+	layout := ladderLayout{rungs: rungs, hasAudio: hasAudio, demuxed: hasAudio && demux}
+	if !hasAudio {
+		return layout
+	}
+
+	for _, rung := range rungs {
+		audio := audioRung{codec: rung.audioCodec, bitrate: rung.audioBitrate}
+
+		index := len(layout.audio)
+		if layout.demuxed {
+			for k, existing := range layout.audio {
+				if existing == audio {
+					index = k
+					break
+				}
+			}
+		}
+		if index == len(layout.audio) {
+			layout.audio = append(layout.audio, audio)
+		}
+		layout.audioOf = append(layout.audioOf, index)
+	}
+
+	return layout
+}
+
+// audioStream возвращает номер варианта stream_%v отдельного аудиопотока
+func (l ladderLayout) audioStream(index int) int {
+	return len(l.rungs) + index
+}
+
+// PackageHLS кодирует входной файл в лестницу качеств за один проход FFmpeg
+// с выровненными ключевыми кадрами, нарезает сегменты TS или fMP4 и пишет
+// медиаплейлисты и мастер-плейлист. BANDWIDTH и AVERAGE-BANDWIDTH
+// вычисляются по фактическим размерам сегментов. С config.DASH по тем же
+// сегментам fMP4 дополнительно пишется MPD манифест, а аудио выделяется
+// в отдельные варианты (AdaptationSet).
+func (t *Transcoder) PackageHLS(ctx context.Context, config dto.HLSPackageConfig) (*dto.HLSPackageResult, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("ошибка валидации конфигурации упаковки: %w", err)
+	}
+	if config.SegmentDuration == 0 {
+		config.SegmentDuration = defaultPackageSegment
+	}
+	if config.MasterPlaylist == "" {
+		config.MasterPlaylist = defaultMasterPlaylist
+	}
+	if config.DASH {
+		config.SegmentFormat = segmentFormatFMP4
+		if config.DASHManifest == "" {
+			config.DASHManifest = defaultDASHManifest
+		}
+	}
+
+	info, err := t.GetMediaInfo(config.InputPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.HasVideo {
+		return nil, fmt.Errorf("входной файл не содержит видео: %s", config.InputPath)
+	}
+
+	rungs, err := prepareLadder(config.Renditions, info.GetFrameRate())
+	if err != nil {
+		return nil, err
+	}
+	layout := newLadderLayout(rungs, info.HasAudio, config.DASH)
+
+	if err := t.encodeLadder(ctx, config, layout); err != nil {
+		return nil, err
+	}
+
+	video := make([]streamStats, len(layout.rungs))
+	for i := range layout.rungs {
+		if video[i], err = measureStream(config.OutputDir, variantPlaylist(i)); err != nil {
+			return nil, err
+		}
+	}
+	var audio []streamStats
+	if layout.demuxed {
+		audio = make([]streamStats, len(layout.audio))
+		for k := range layout.audio {
+			if audio[k], err = measureStream(config.OutputDir, variantPlaylist(layout.audioStream(k))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	master := buildMasterPlaylist(config, layout, video, audio)
+	result := &dto.HLSPackageResult{MasterPlaylist: filepath.Join(config.OutputDir, config.MasterPlaylist)}
+	for _, variant := range master.Variants {
+		result.Variants = append(result.Variants, utils.StreamInfoFromVariant(variant))
+	}
+
+	if err := writeManifest(result.MasterPlaylist, master); err != nil {
+		return nil, err
+	}
+
+	if config.DASH {
+		result.DASHManifest = filepath.Join(config.OutputDir, config.DASHManifest)
+		if err := writeManifest(result.DASHManifest, buildMPD(config, layout, video, audio)); err != nil {
+			return nil, err
+		}
+	}
+
+	t.logger.Info("Упаковка завершена: %d качеств, %s", len(rungs), result.MasterPlaylist)
+	return result, nil
+}
+
+// prepareLadder разбирает параметры качеств и подставляет значения по умолчанию
+func prepareLadder(renditions []dto.Config, sourceFrameRate float64) ([]ladderRung, error) {
+	rungs := make([]ladderRung, 0, len(renditions))
+
+	for i, rendition := range renditions {
+		rung := ladderRung{
+			videoCodec: rendition.VideoCodec,
+			audioCodec: rendition.AudioCodec,
+			frameRate:  sourceFrameRate,
+		}
+		if rung.videoCodec == "" || rung.videoCodec == "h264" {
+			rung.videoCodec = "libx264"
+		}
+		if rung.videoCodec == "hevc" {
+			rung.videoCodec = "libx265"
+		}
+		if rung.audioCodec == "" {
+			rung.audioCodec = "aac"
+		}
+
+		fmt.Sscanf(rendition.Resolution, "%dx%d", &rung.width, &rung.height)
+
+		var err error
+		if rung.videoBitrate, err = utils.ParseBitrate(rendition.VideoBitrate); err != nil {
+			return nil, fmt.Errorf("качество %d: %w", i, err)
+		}
+
+		audioBitrate := rendition.AudioBitrate
+		if audioBitrate == "" {
+			audioBitrate = "128k"
+		}
+		if rung.audioBitrate, err = utils.ParseBitrate(audioBitrate); err != nil {
+			return nil, fmt.Errorf("качество %d: %w", i, err)
+		}
+
+		if rendition.FrameRate != "" {
+			rung.frameRate, _ = strconv.ParseFloat(rendition.FrameRate, 64)
+		}
+		if rung.frameRate <= 0 {
+			rung.frameRate = 30
+		}
+
+		rung.level = codecLevel(rung.height)
+		rungs = append(rungs, rung)
+	}
+
+	return rungs, nil
+}
+
+// encodeLadder кодирует все качества одним процессом FFmpeg: видео делится
+// фильтром split, ключевые кадры принудительно ставятся на границах сегментов
+func (t *Transcoder) encodeLadder(ctx context.Context, config dto.HLSPackageConfig, layout ladderLayout) error {
+	streams := len(layout.rungs)
+	if layout.demuxed {
+		streams += len(layout.audio)
+	}
+	for i := 0; i < streams; i++ {
+		if err := os.MkdirAll(filepath.Join(config.OutputDir, filepath.Dir(variantPlaylist(i))), 0755); err != nil {
+			return fmt.Errorf("не удалось создать директорию варианта: %w", err)
+		}
+	}
+
+	args := buildLadderArgs(config, layout)
+
+	stderr := newTailBuffer(stderrTailLines)
+	err := runner.Run(ctx, t.runner, runner.Command{
+		Path:   t.ffmpegPath,
+		Args:   args,
+		Stderr: stderr,
+	})
+	return newFFmpegError(args, err, stderr.String())
+}
+
+// buildLadderArgs строит аргументы FFmpeg для кодирования лестницы качеств в HLS
+func buildLadderArgs(config dto.HLSPackageConfig, layout ladderLayout) []string {
+	segment := config.SegmentDuration.Seconds()
+	args := []string{"-i", config.InputPath, "-filter_complex", ladderFilter(layout.rungs)}
+
+	var streamMap []string
+	for i := range layout.rungs {
+		args = append(args, "-map", fmt.Sprintf("[vout%d]", i))
+		if layout.hasAudio && !layout.demuxed {
+			args = append(args, "-map", "0:a:0")
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d", i, i))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d", i))
+		}
+	}
+	if layout.demuxed {
+		for k := range layout.audio {
+			args = append(args, "-map", "0:a:0")
+			streamMap = append(streamMap, fmt.Sprintf("a:%d", k))
+		}
+	}
+
+	for i, rung := range layout.rungs {
+		// GOP равен длительности сегмента, чтобы границы сегментов совпадали во всех качествах
+		gop := strconv.Itoa(int(math.Round(rung.frameRate * segment)))
+		stream := fmt.Sprintf(":v:%d", i)
+
+		args = append(args,
+			"-c"+stream, rung.videoCodec,
+			"-b"+stream, strconv.FormatInt(rung.videoBitrate, 10),
+			"-maxrate"+stream, strconv.FormatInt(rung.videoBitrate*107/100, 10),
+			"-bufsize"+stream, strconv.FormatInt(rung.videoBitrate*3/2, 10),
+			"-g"+stream, gop,
+			"-keyint_min"+stream, gop,
+		)
+
+		if rung.videoCodec == "libx265" {
+			args = append(args, "-tag"+stream, "hvc1", "-x265-params"+stream, "scenecut=0:level-idc="+rung.level)
+		} else {
+			args = append(args, "-profile"+stream, "high", "-level"+stream, rung.level)
+		}
+	}
+
+	for k, audio := range layout.audio {
+		args = append(args,
+			fmt.Sprintf("-c:a:%d", k), audio.codec,
+			fmt.Sprintf("-b:a:%d", k), strconv.FormatInt(audio.bitrate, 10),
+			fmt.Sprintf("-ac:a:%d", k), "2",
+		)
+	}
+
+	args = append(args,
+		"-sc_threshold", "0",
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%g)", segment),
+		"-f", "hls",
+		"-hls_time", fmt.Sprintf("%g", segment),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+	)
+
+	segmentName := "seg_%05d.ts"
+	if config.SegmentFormat == segmentFormatFMP4 {
+		segmentName = fmp4SegmentName
+		args = append(args, "-hls_segment_type", "fmp4", "-hls_fmp4_init_filename", "init_%v.mp4")
+	} else {
+		args = append(args, "-hls_segment_type", "mpegts")
+	}
+
+	return append(args,
+		"-hls_segment_filename", filepath.Join(config.OutputDir, "stream_%v", segmentName),
+		"-var_stream_map", strings.Join(streamMap, " "),
+		"-y", filepath.Join(config.OutputDir, "stream_%v", "index.m3u8"),
+	)
+}
+
+// ladderFilter строит filter_complex: split исходного видео и масштабирование для каждого качества
+func ladderFilter(rungs []ladderRung) string {
+	var split strings.Builder
+	fmt.Fprintf(&split, "[0:v]split=%d", len(rungs))
+	for i := range rungs {
+		fmt.Fprintf(&split, "[vsplit%d]", i)
+	}
+
+	chains := []string{split.String()}
+	for i, rung := range rungs {
+		chains = append(chains, fmt.Sprintf("[vsplit%d]scale=%d:%d,fps=%g[vout%d]",
+			i, rung.width, rung.height, rung.frameRate, i))
+	}
+	return strings.Join(chains, ";")
+}
+
+// variantPlaylist возвращает путь медиаплейлиста качества относительно выходной директории
+func variantPlaylist(index int) string {
+	return fmt.Sprintf("stream_%d/index.m3u8", index)
+}
+
+// streamStats медиаплейлист варианта и битрейт по размерам его сегментов
+type streamStats struct {
+	path             string // Путь медиаплейлиста относительно выходной директории
+	media            *m3u8.MediaPlaylist
+	bandwidth        int64 // Пиковый битрейт сегмента
+	averageBandwidth int64
+}
+
+// measureStream читает медиаплейлист, записанный FFmpeg, и вычисляет
+// пиковый и средний битрейт по размерам сегментов
+func measureStream(outputDir, playlistPath string) (streamStats, error) {
+	stats := streamStats{path: playlistPath}
+
+	fullPath := filepath.Join(outputDir, playlistPath)
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return stats, fmt.Errorf("FFmpeg не создал медиаплейлист %s: %w", fullPath, err)
+	}
+	if stats.media, err = m3u8.ParseMedia(string(content), ""); err != nil {
+		return stats, fmt.Errorf("ошибка разбора медиаплейлиста %s: %w", fullPath, err)
+	}
+
+	var totalBits float64
+	for _, segment := range stats.media.Segments {
+		stat, err := os.Stat(filepath.Join(filepath.Dir(fullPath), segment.URI))
+		if err != nil {
+			return stats, fmt.Errorf("сегмент не найден: %w", err)
+		}
+
+		bits := float64(stat.Size() * 8)
+		totalBits += bits
+		if seconds := segment.Duration.Seconds(); seconds > 0 {
+			stats.bandwidth = max(stats.bandwidth, int64(math.Ceil(bits/seconds)))
+		}
+	}
+	if total := stats.media.TotalDuration().Seconds(); total > 0 {
+		stats.averageBandwidth = int64(math.Ceil(totalBits / total))
+	}
+
+	return stats, nil
+}
+
+// buildMasterPlaylist описывает варианты для мастер-плейлиста. Отдельные
+// аудиопотоки становятся группами EXT-X-MEDIA, а их битрейт добавляется
+// к битрейту качеств, которые на них ссылаются.
+func buildMasterPlaylist(config dto.HLSPackageConfig, layout ladderLayout, video, audio []streamStats) *m3u8.MasterPlaylist {
+	master := &m3u8.MasterPlaylist{Version: 3, IndependentSegments: true}
+	if config.SegmentFormat == segmentFormatFMP4 {
+		master.Version = 7
+	}
+
+	for k, stats := range audio {
+		master.Renditions = append(master.Renditions, m3u8.Rendition{
+			Type:       m3u8.RenditionAudio,
+			GroupID:    audioGroupID(k),
+			Name:       fmt.Sprintf("audio %dk", layout.audio[k].bitrate/1000),
+			URI:        stats.path,
+			Default:    true,
+			AutoSelect: true,
+			Channels:   "2",
+		})
+	}
+
+	for i, rung := range layout.rungs {
+		codecs := []string{videoCodecString(rung)}
+		if layout.hasAudio {
+			codecs = append(codecs, audioCodecString(layout.audio[layout.audioOf[i]].codec))
+		}
+
+		variant := m3u8.Variant{
+			URI:              video[i].path,
+			Bandwidth:        video[i].bandwidth,
+			AverageBandwidth: video[i].averageBandwidth,
+			Codecs:           strings.Join(codecs, ","),
+			Resolution:       fmt.Sprintf("%dx%d", rung.width, rung.height),
+			Width:            rung.width,
+			Height:           rung.height,
+			FrameRate:        rung.frameRate,
+		}
+		if layout.demuxed {
+			k := layout.audioOf[i]
+			variant.Audio = audioGroupID(k)
+			variant.Bandwidth += audio[k].bandwidth
+			variant.AverageBandwidth += audio[k].averageBandwidth
+		}
+
+		master.Variants = append(master.Variants, variant)
+	}
+
+	return master
+}
+
+// audioGroupID возвращает GROUP-ID отдельного аудиопотока
+func audioGroupID(index int) string {
+	return fmt.Sprintf("audio_%d", index)
+}
+
+// codecLevel выбирает уровень профиля кодека по высоте кадра. Для H.264 и
+// HEVC уровни совпадают; x264 и x265 принимают десятичную запись.
+func codecLevel(height int) string {
+	levels := []struct {
+		height int
+		level  string
+	}{
+		{480, "3.0"},
+		{720, "3.1"},
+		{1080, "4.0"},
+		{1440, "5.0"},
+	}
+	for _, level := range levels {
+		if height <= level.height {
+			return level.level
+		}
+	}
+	return "5.1"
+}
+
+// videoCodecString формирует обозначение видеокодека (RFC 6381) для качества
+func videoCodecString(rung ladderRung) string {
+	level, _ := strconv.ParseFloat(rung.level, 64)
+	if rung.videoCodec == "libx265" {
+		// Main профиль, general_level_idc: уровень в единицах 1/30
+		return fmt.Sprintf("hvc1.1.6.L%d.B0", int(math.Round(level*30)))
+	}
+	// High профиль (0x64), уровень в десятых долях
+	return fmt.Sprintf("avc1.6400%02x", int(math.Round(level*10)))
+}
+
+// audioCodecString формирует обозначение аудиокодека (RFC 6381)
+func audioCodecString(codec string) string {
+	switch codec {
+	case "libmp3lame", "mp3":
+		return "mp4a.40.34"
+	default:
+		return "mp4a.40.2"
+	}
+}
+
+// writeManifest атомарно записывает мастер-плейлист или MPD
+func writeManifest(path string, manifest io.WriterTo) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("не удалось создать манифест %s: %w", path, err)
+	}
+
+	if _, err := manifest.WriteTo(file); err != nil {
+		file.Close()
+		return fmt.Errorf("ошибка записи манифеста %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("ошибка записи манифеста %s: %w", path, err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
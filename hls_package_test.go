@@ -0,0 +1,294 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/presets"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// writeFakeVariant создает медиаплейлист и сегменты, которые записал бы FFmpeg.
+// Если указана секция инициализации, сегменты записываются как fMP4.
+func writeFakeVariant(t *testing.T, dir, init string, segmentSizes []int) {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	pattern := "seg_%05d.ts"
+	if init != "" {
+		if err := os.WriteFile(filepath.Join(dir, init), []byte("ftyp"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", init)
+		pattern = "seg_%05d.m4s"
+	}
+	for i, size := range segmentSizes {
+		name := fmt.Sprintf(pattern, i)
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&b, "#EXTINF:4.000000,\n%s\n", name)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	if err := os.WriteFile(filepath.Join(dir, "index.m3u8"), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageHLS(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffprobe", runner.FakeResponse{
+		Stdout: `{
+			"format": {"duration": "8.0"},
+			"streams": [
+				{"codec_type": "video", "width": 1920, "height": 1080, "r_frame_rate": "25/1"},
+				{"codec_type": "audio", "channels": 2}
+			]
+		}`,
+	})
+
+	outputDir := t.TempDir()
+	// 4 секунды: 1 000 000 байт = 2 Мбит/с, 500 000 байт = 1 Мбит/с
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_0"), "", []int{1000000, 500000})
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_1"), "", []int{200000, 200000})
+
+	result, err := tc.PackageHLS(context.Background(), dto.HLSPackageConfig{
+		InputPath: newTestInput(t),
+		OutputDir: outputDir,
+		Renditions: []dto.Config{
+			{Resolution: "1280x720", VideoBitrate: "2500k"},
+			{Resolution: "640x360", VideoBitrate: "800k", FrameRate: "30"},
+		},
+		SegmentDuration: 4 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка упаковки: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+	for _, want := range []string{
+		"[0:v]split=2[vsplit0][vsplit1];[vsplit0]scale=1280:720,fps=25[vout0];[vsplit1]scale=640:360,fps=30[vout1]",
+		"-map [vout0] -map 0:a:0 -map [vout1] -map 0:a:0",
+		"-g:v:0 100 -keyint_min:v:0 100",
+		"-g:v:1 120",
+		"-force_key_frames expr:gte(t,n_forced*4)",
+		"-var_stream_map v:0,a:0 v:1,a:1",
+		"-hls_segment_type mpegts",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("В аргументах нет %q: %s", want, args)
+		}
+	}
+
+	content, err := os.ReadFile(result.MasterPlaylist)
+	if err != nil {
+		t.Fatalf("Мастер-плейлист не записан: %v", err)
+	}
+	info, err := utils.ParsePlaylist(string(content), "https://cdn.example.com/vod/master.m3u8")
+	if err != nil {
+		t.Fatalf("Мастер-плейлист не разбирается: %v\n%s", err, content)
+	}
+
+	if len(info.Streams) != 2 {
+		t.Fatalf("Ожидалось 2 варианта:\n%s", content)
+	}
+	hd := info.Streams[0]
+	if hd.Bandwidth != 2000000 || hd.AverageBandwidth != 1500000 {
+		t.Errorf("Неверный битрейт варианта: %+v", hd)
+	}
+	if hd.Resolution != "1280x720" || hd.Codecs != "avc1.64001f,mp4a.40.2" || hd.FrameRate != 25 {
+		t.Errorf("Неверные атрибуты варианта: %+v", hd)
+	}
+	if hd.URL != "https://cdn.example.com/vod/stream_0/index.m3u8" {
+		t.Errorf("URI варианта должен быть относительным: %s", hd.URL)
+	}
+	if sd := info.Streams[1]; sd.Codecs != "avc1.64001e,mp4a.40.2" || sd.FrameRate != 30 || sd.Bandwidth != 400000 {
+		t.Errorf("Неверные атрибуты варианта: %+v", sd)
+	}
+}
+
+func TestPackageHLSHEVC(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffprobe", runner.FakeResponse{
+		Stdout: `{
+			"format": {"duration": "8.0"},
+			"streams": [{"codec_type": "video", "width": 1920, "height": 1080, "r_frame_rate": "25/1"}]
+		}`,
+	})
+
+	outputDir := t.TempDir()
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_0"), "", []int{500000, 500000})
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_1"), "", []int{200000, 200000})
+
+	result, err := tc.PackageHLS(context.Background(), dto.HLSPackageConfig{
+		InputPath: newTestInput(t),
+		OutputDir: outputDir,
+		Renditions: []dto.Config{
+			{Resolution: "1920x1080", VideoBitrate: "4000k", VideoCodec: "hevc"},
+			{Resolution: "1280x720", VideoBitrate: "2000k", VideoCodec: "libx265"},
+		},
+		SegmentDuration: 4 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка упаковки: %v", err)
+	}
+
+	// x265 принимает уровень в десятичной записи, CODECS - general_level_idc (уровень * 30)
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+	for _, want := range []string{
+		"-c:v:0 libx265",
+		"-tag:v:0 hvc1 -x265-params:v:0 scenecut=0:level-idc=4.0",
+		"-x265-params:v:1 scenecut=0:level-idc=3.1",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("В аргументах нет %q: %s", want, args)
+		}
+	}
+
+	content, err := os.ReadFile(result.MasterPlaylist)
+	if err != nil {
+		t.Fatalf("Мастер-плейлист не записан: %v", err)
+	}
+	info, err := utils.ParsePlaylist(string(content), "https://cdn.example.com/vod/master.m3u8")
+	if err != nil || len(info.Streams) != 2 {
+		t.Fatalf("Мастер-плейлист не разбирается: %v\n%s", err, content)
+	}
+	if codecs := info.Streams[0].Codecs; codecs != "hvc1.1.6.L120.B0" {
+		t.Errorf("Неверный CODECS варианта 1080p: %s", codecs)
+	}
+	if codecs := info.Streams[1].Codecs; codecs != "hvc1.1.6.L93.B0" {
+		t.Errorf("Неверный CODECS варианта 720p: %s", codecs)
+	}
+}
+
+func TestPackageHLSWithDASH(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffprobe", runner.FakeResponse{
+		Stdout: `{
+			"format": {"duration": "8.0"},
+			"streams": [
+				{"codec_type": "video", "width": 1920, "height": 1080, "r_frame_rate": "25/1"},
+				{"codec_type": "audio", "channels": 2}
+			]
+		}`,
+	})
+
+	outputDir := t.TempDir()
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_0"), "init_0.mp4", []int{1000000, 500000})
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_1"), "init_1.mp4", []int{200000, 200000})
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_2"), "init_2.mp4", []int{64000, 64000})
+	writeFakeVariant(t, filepath.Join(outputDir, "stream_3"), "init_3.mp4", []int{32000, 32000})
+
+	result, err := tc.PackageHLS(context.Background(), dto.HLSPackageConfig{
+		InputPath:       newTestInput(t),
+		OutputDir:       outputDir,
+		Renditions:      presets.Ladder(presets.WebHD, presets.Mobile),
+		SegmentDuration: 4 * time.Second,
+		DASH:            true,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка упаковки: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+	for _, want := range []string{
+		"-map [vout0] -map [vout1] -map 0:a:0 -map 0:a:0",
+		"-c:a:0 aac -b:a:0 128000",
+		"-c:a:1 aac -b:a:1 64000",
+		"-hls_segment_type fmp4",
+		"-var_stream_map v:0 v:1 a:0 a:1",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("В аргументах нет %q: %s", want, args)
+		}
+	}
+
+	// HLS: аудио вынесено в группы, битрейт варианта включает аудио
+	content, err := os.ReadFile(result.MasterPlaylist)
+	if err != nil {
+		t.Fatalf("Мастер-плейлист не записан: %v", err)
+	}
+	info, err := utils.ParsePlaylist(string(content), "https://cdn.example.com/vod/master.m3u8")
+	if err != nil {
+		t.Fatalf("Мастер-плейлист не разбирается: %v\n%s", err, content)
+	}
+	if len(info.Master.Renditions) != 2 {
+		t.Errorf("Ожидалось 2 аудио группы:\n%s", content)
+	}
+	if hd := info.Streams[0]; hd.Audio != "audio_0" || hd.Bandwidth != 2128000 || hd.AverageBandwidth != 1628000 {
+		t.Errorf("Неверный вариант: %+v", hd)
+	}
+
+	// DASH: те же сегменты в SegmentTemplate с SegmentTimeline
+	data, err := os.ReadFile(result.DASHManifest)
+	if err != nil {
+		t.Fatalf("MPD не записан: %v", err)
+	}
+	var mpd dash.MPD
+	if err := xml.Unmarshal(data, &mpd); err != nil {
+		t.Fatalf("MPD не разбирается: %v\n%s", err, data)
+	}
+	if time.Duration(mpd.MediaPresentationDuration) != 8*time.Second || len(mpd.Periods) != 1 {
+		t.Fatalf("Неверный MPD:\n%s", data)
+	}
+
+	sets := mpd.Periods[0].AdaptationSets
+	if len(sets) != 2 || sets[0].ContentType != "video" || sets[1].ContentType != "audio" {
+		t.Fatalf("Ожидались AdaptationSet видео и аудио:\n%s", data)
+	}
+	if len(sets[0].Representations) != 2 || len(sets[1].Representations) != 2 {
+		t.Fatalf("Неверное количество Representation:\n%s", data)
+	}
+
+	hd := sets[0].Representations[0]
+	if hd.Bandwidth != 2000000 || hd.Width != 1280 || hd.Codecs != "avc1.64001f" {
+		t.Errorf("Неверное представление: %+v", hd)
+	}
+	template := hd.SegmentTemplate
+	if template == nil || template.Initialization != "stream_0/init_0.mp4" ||
+		template.Media != "stream_0/seg_$Number%05d$.m4s" || template.StartNumber == nil || *template.StartNumber != 0 {
+		t.Fatalf("Неверный SegmentTemplate: %+v", template)
+	}
+	timeline := template.SegmentTimeline.S
+	if len(timeline) != 1 || timeline[0].T == nil || *timeline[0].T != 0 || timeline[0].D != 4000 || timeline[0].R != 1 {
+		t.Errorf("Неверная SegmentTimeline: %+v", timeline)
+	}
+	if audio := sets[1].Representations[1]; audio.Bandwidth != 64000 || audio.SegmentTemplate.Initialization != "stream_3/init_3.mp4" {
+		t.Errorf("Неверное аудио представление: %+v", audio)
+	}
+}
+
+func TestPackageHLSValidation(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	_, err := tc.PackageHLS(context.Background(), dto.HLSPackageConfig{
+		InputPath:     newTestInput(t),
+		OutputDir:     t.TempDir(),
+		Renditions:    []dto.Config{{Resolution: "1280x720", VideoCodec: "libvpx-vp9"}},
+		SegmentFormat: "mkv",
+	})
+
+	var validationErrs dto.ValidationErrors
+	if !errors.As(err, &validationErrs) || len(validationErrs) != 3 {
+		t.Errorf("Ожидались 3 ошибки валидации (битрейт, кодек, формат), получено %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package transcoder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+)
+
+// hlsTrack дорожка загрузки: основной вариант или альтернативное представление
+type hlsTrack struct {
+	URL       string
+	Rendition *m3u8.Rendition     // nil - основной вариант
+	Playlist  *m3u8.MediaPlaylist // nil - дорожка передается FFmpeg по URL
+}
+
+// muxInput вход FFmpeg при сборке итогового файла
+type muxInput struct {
+	Path      string   // Локальный файл или URL
+	Options   []string // Опции входа (перед -i)
+	Rendition *m3u8.Rendition
+}
+
+// findVariant возвращает вариант мастер-плейлиста с указанным URL
+func findVariant(info *dto.PlaylistInfo, streamURL string) *m3u8.Variant {
+	if info.Master == nil {
+		return nil
+	}
+	for i := range info.Master.Variants {
+		if info.Master.Variants[i].URI == streamURL {
+			return &info.Master.Variants[i]
+		}
+	}
+	return nil
+}
+
+// selectRenditions выбирает внешние аудио и субтитры для варианта.
+// Аудио: представления на языках из AudioLanguages, иначе DEFAULT дорожка группы.
+// Субтитры загружаются только при заданных SubtitleLanguages.
+// Представления без URI входят в сам вариант и не загружаются отдельно.
+func selectRenditions(master *m3u8.MasterPlaylist, variant *m3u8.Variant, config dto.HLSConfig) []m3u8.Rendition {
+	if master == nil || variant == nil {
+		return nil
+	}
+
+	var selected []m3u8.Rendition
+	if variant.Audio != "" {
+		group := master.Group(m3u8.RenditionAudio, variant.Audio)
+		audio := matchRenditions(group, config.AudioLanguages)
+		if len(audio) == 0 {
+			if def := defaultRendition(group); def != nil {
+				audio = []m3u8.Rendition{*def}
+			}
+		}
+		selected = append(selected, audio...)
+	}
+
+	if variant.Subtitles != "" && len(config.SubtitleLanguages) > 0 {
+		group := master.Group(m3u8.RenditionSubtitles, variant.Subtitles)
+		selected = append(selected, matchRenditions(group, config.SubtitleLanguages)...)
+	}
+
+	// Дорожки без URI уже входят в вариант
+	external := selected[:0]
+	for _, rendition := range selected {
+		if rendition.URI != "" {
+			external = append(external, rendition)
+		}
+	}
+	return external
+}
+
+// matchRenditions возвращает по одному представлению на каждый язык в порядке предпочтения
+func matchRenditions(group []m3u8.Rendition, languages []string) []m3u8.Rendition {
+	var matched []m3u8.Rendition
+	used := make(map[string]bool)
+
+	for _, language := range languages {
+		for _, rendition := range group {
+			if !used[rendition.URI] && matchLanguage(rendition.Language, language) {
+				matched = append(matched, rendition)
+				used[rendition.URI] = true
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// defaultRendition возвращает DEFAULT представление группы, иначе AUTOSELECT, иначе первое
+func defaultRendition(group []m3u8.Rendition) *m3u8.Rendition {
+	for i := range group {
+		if group[i].Default {
+			return &group[i]
+		}
+	}
+	for i := range group {
+		if group[i].AutoSelect {
+			return &group[i]
+		}
+	}
+	if len(group) > 0 {
+		return &group[0]
+	}
+	return nil
+}
+
+// matchLanguage сравнивает языковые теги по основному подтегу:
+// "en" совпадает с "en-US" и "eng"
+func matchLanguage(tag, wanted string) bool {
+	if tag == "" || wanted == "" {
+		return false
+	}
+	return languageCode(tag) == languageCode(wanted)
+}
+
+// iso6392 соответствие двухбуквенных кодов ISO 639-1 трехбуквенным ISO 639-2,
+// которые FFmpeg записывает в метаданные дорожек
+var iso6392 = map[string]string{
+	"ar": "ara", "cs": "ces", "da": "dan", "de": "deu", "el": "ell",
+	"en": "eng", "es": "spa", "fa": "fas", "fi": "fin", "fr": "fra",
+	"he": "heb", "hi": "hin", "hu": "hun", "it": "ita", "ja": "jpn",
+	"kk": "kaz", "ko": "kor", "nl": "nld", "no": "nor", "pl": "pol",
+	"pt": "por", "ro": "ron", "ru": "rus", "sv": "swe", "tr": "tur",
+	"uk": "ukr", "uz": "uzb", "vi": "vie", "zh": "zho",
+}
+
+// languageCode приводит языковой тег (BCP 47) к трехбуквенному коду ISO 639-2
+func languageCode(tag string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	if code, exists := iso6392[primary]; exists {
+		return code
+	}
+	return primary
+}
+
+// buildMuxArgs строит аргументы FFmpeg для сборки входов в один файл без
+// перекодирования. Первый вход - основной вариант, остальные - представления
+// с метаданными языка, названия и дорожки по умолчанию.
+func buildMuxArgs(inputs []muxInput, outputPath string, duration time.Duration) []string {
+	var args []string
+	for _, input := range inputs {
+		args = append(args, input.Options...)
+		args = append(args, "-i", input.Path)
+	}
+
+	if len(inputs) == 1 {
+		args = append(args, "-map", "0")
+	} else {
+		args = append(args, buildRenditionArgs(inputs)...)
+	}
+
+	args = append(args, "-c", "copy")
+	if hasSubtitles(inputs) && isMP4Container(outputPath) {
+		// MP4 не поддерживает WebVTT, субтитры конвертируются в mov_text
+		args = append(args, "-c:s", "mov_text")
+	}
+
+	if duration > 0 {
+		args = append(args, "-t", fmt.Sprintf("%.0f", duration.Seconds()))
+	}
+
+	return append(args, "-y", outputPath)
+}
+
+// buildRenditionArgs строит -map, -metadata и -disposition для представлений
+func buildRenditionArgs(inputs []muxInput) []string {
+	hasAudio := false
+	for _, input := range inputs[1:] {
+		if input.Rendition.Type == m3u8.RenditionAudio {
+			hasAudio = true
+		}
+	}
+
+	// Из основного варианта берется видео; его аудио - только если нет внешних дорожек
+	args := []string{"-map", "0:v?"}
+	if !hasAudio {
+		args = append(args, "-map", "0:a?")
+	}
+
+	var metadata []string
+	audioIndex, subtitleIndex := 0, 0
+	for i, input := range inputs[1:] {
+		rendition := input.Rendition
+
+		var stream string
+		switch rendition.Type {
+		case m3u8.RenditionAudio:
+			args = append(args, "-map", fmt.Sprintf("%d:a", i+1))
+			stream = fmt.Sprintf("a:%d", audioIndex)
+			audioIndex++
+		case m3u8.RenditionSubtitles:
+			args = append(args, "-map", fmt.Sprintf("%d:s", i+1))
+			stream = fmt.Sprintf("s:%d", subtitleIndex)
+			subtitleIndex++
+		default:
+			continue
+		}
+
+		if rendition.Language != "" {
+			metadata = append(metadata, "-metadata:s:"+stream, "language="+languageCode(rendition.Language))
+		}
+		if rendition.Name != "" {
+			metadata = append(metadata, "-metadata:s:"+stream, "title="+rendition.Name)
+		}
+		// Дорожкой по умолчанию становится первое (наиболее предпочтительное) аудио,
+		// субтитры включаются по умолчанию только если они принудительные
+		disposition := "0"
+		if stream == "a:0" {
+			disposition = "default"
+		} else if rendition.Forced {
+			disposition = "default+forced"
+		}
+		metadata = append(metadata, "-disposition:"+stream, disposition)
+	}
+
+	return append(args, metadata...)
+}
+
+// hasSubtitles сообщает, есть ли среди входов субтитры
+func hasSubtitles(inputs []muxInput) bool {
+	for _, input := range inputs {
+		if input.Rendition != nil && input.Rendition.Type == m3u8.RenditionSubtitles {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsSubtitles сообщает, может ли контейнер выходного файла хранить
+// субтитры HLS: MP4/MOV (после конвертации в mov_text), Matroska и WebM.
+// MPEG-TS и аудиоконтейнеры WebVTT не принимают.
+func supportsSubtitles(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mkv", ".webm":
+		return true
+	}
+	return isMP4Container(path)
+}
+
+// hasSubtitleRenditions сообщает, есть ли среди представлений субтитры
+func hasSubtitleRenditions(renditions []m3u8.Rendition) bool {
+	for _, rendition := range renditions {
+		if rendition.Type == m3u8.RenditionSubtitles {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutSubtitles возвращает представления без субтитров
+func withoutSubtitles(renditions []m3u8.Rendition) []m3u8.Rendition {
+	var filtered []m3u8.Rendition
+	for _, rendition := range renditions {
+		if rendition.Type != m3u8.RenditionSubtitles {
+			filtered = append(filtered, rendition)
+		}
+	}
+	return filtered
+}
+
+// isMP4Container сообщает, является ли выходной файл MP4/MOV
+func isMP4Container(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".m4v", ".mov":
+		return true
+	}
+	return false
+}
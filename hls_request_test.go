@@ -0,0 +1,255 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// testRequestConfig параметры запросов, которые должен получить каждый ресурс
+var testRequestConfig = dto.HLSConfig{
+	RequestOptions: dto.RequestOptions{
+		Headers:   map[string]string{"X-Token": "secret", "Accept-Language": "ru"},
+		Cookies:   "session=abc; theme=dark",
+		UserAgent: "TestPlayer/1.0",
+		Referer:   "https://player.example.com/watch",
+	},
+}
+
+// newDecoratedTestServer отдает VOD плейлист и отклоняет запросы без
+// заголовков из testRequestConfig
+func newDecoratedTestServer(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		rejected []string
+	)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" || r.Header.Get("Accept-Language") != "ru" ||
+			r.Header.Get("Cookie") != "session=abc; theme=dark" ||
+			r.Header.Get("User-Agent") != "TestPlayer/1.0" ||
+			r.Header.Get("Referer") != "https://player.example.com/watch" {
+			mu.Lock()
+			rejected = append(rejected, r.URL.Path)
+			mu.Unlock()
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nvideo.m3u8\n")
+		case "/video.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXTINF:4,\nseg1.ts\n#EXT-X-ENDLIST\n")
+		default:
+			fmt.Fprintf(w, "[%s]", r.URL.Path)
+		}
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), rejected...)
+	}
+}
+
+func TestRequestDecorationNative(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server, rejected := newDecoratedTestServer(t)
+
+	config := testRequestConfig
+	config.URL = server.URL + "/master.m3u8"
+	config.OutputPath = filepath.Join(t.TempDir(), "out.mp4")
+
+	// Информация о плейлисте запрашивается с теми же заголовками, что и сегменты
+	info, err := tc.GetHLSInfoWithConfig(context.Background(), config)
+	if err != nil || len(info.Streams) != 1 {
+		t.Fatalf("Ошибка получения информации: %v", err)
+	}
+	if err := tc.DownloadHLSWithConfig(context.Background(), config); err != nil {
+		t.Fatalf("Ошибка загрузки HLS: %v", err)
+	}
+
+	// Проверка плейлиста использует те же параметры запросов
+	report, err := tc.ValidateHLS(context.Background(), info, dto.ConformanceConfig{RequestOptions: config.RequestOptions})
+	if err != nil || report.Playlists != 1 || report.CheckedURIs != 2 {
+		t.Errorf("Неверный итог проверки: %+v, ошибка %v", report, err)
+	}
+	if paths := rejected(); len(paths) > 0 {
+		t.Errorf("Запросы без заголовков: %v", paths)
+	}
+
+	// Без заголовков сервер отвечает 403
+	if _, err := tc.GetHLSInfo(server.URL + "/master.m3u8"); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Ожидалась ошибка 403 без заголовков, получено %v", err)
+	}
+}
+
+func TestRequestDecorationFFmpegArgs(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	server, _ := newDecoratedTestServer(t)
+
+	config := testRequestConfig
+	config.URL = server.URL + "/master.m3u8"
+	config.OutputPath = filepath.Join(t.TempDir(), "out.mp4")
+	config.Duration = 10 * time.Second // ограниченная запись идет через FFmpeg
+	config.Proxy = "http://proxy.example.com:3128"
+
+	// Прокси в тесте не существует, поэтому плейлист загружается напрямую
+	direct := config
+	direct.Proxy = ""
+	info, err := tc.GetHLSInfoWithConfig(context.Background(), direct)
+	if err != nil {
+		t.Fatalf("Ошибка получения информации: %v", err)
+	}
+
+	if err := tc.hls.downloadWithFFmpeg(context.Background(), info.Streams[0].URL, config); err != nil {
+		t.Fatalf("Ошибка загрузки через FFmpeg: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := calls[len(calls)-1].Args
+	input := indexOf(args, "-i")
+	if input < 0 {
+		t.Fatalf("Нет -i в аргументах: %v", args)
+	}
+
+	// Все HTTP опции стоят перед -i, иначе FFmpeg применяет их к выходу
+	before := strings.Join(args[:input], " ")
+	for _, want := range []string{
+		"-user_agent TestPlayer/1.0",
+		"-referer https://player.example.com/watch",
+		"-headers Accept-Language: ru\r\nX-Token: secret\r\nCookie: session=abc; theme=dark\r\n",
+		"-http_proxy http://proxy.example.com:3128",
+	} {
+		if !strings.Contains(before, want) {
+			t.Errorf("Перед -i нет %q: %q", want, before)
+		}
+	}
+	if args[input+1] != server.URL+"/video.m3u8" || !strings.Contains(strings.Join(args[input:], " "), "-t 10") {
+		t.Errorf("Неверные аргументы после -i: %v", args[input:])
+	}
+
+	// SOCKS прокси FFmpeg не поддерживает
+	config.Proxy = "socks5://127.0.0.1:1080"
+	if err := tc.hls.downloadWithFFmpeg(context.Background(), info.Streams[0].URL, config); err == nil {
+		t.Error("Ожидалась ошибка для SOCKS прокси в FFmpeg")
+	}
+}
+
+func TestRequestHeaderInjection(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	calls := len(fake.CallsTo("ffmpeg"))
+
+	tests := []struct {
+		name    string
+		options dto.RequestOptions
+		field   string
+	}{
+		{"перевод строки в значении", dto.RequestOptions{Headers: map[string]string{"X-Token": "secret\r\nX-Evil: 1"}}, "Headers"},
+		{"некорректное имя", dto.RequestOptions{Headers: map[string]string{"X Token:": "secret"}}, "Headers"},
+		{"перевод строки в cookies", dto.RequestOptions{Cookies: "session=abc\nX-Evil: 1"}, "Cookies"},
+		{"перевод строки в User-Agent", dto.RequestOptions{UserAgent: "TestPlayer\r"}, "UserAgent"},
+		{"перевод строки в Referer", dto.RequestOptions{Referer: "https://example.com/\n"}, "Referer"},
+	}
+
+	for _, tt := range tests {
+		err := tc.DownloadHLSWithConfig(context.Background(), dto.HLSConfig{
+			URL:            "https://example.com/index.m3u8",
+			OutputPath:     filepath.Join(t.TempDir(), "out.mp4"),
+			Duration:       10 * time.Second,
+			RequestOptions: tt.options,
+		})
+		if err == nil || !strings.Contains(err.Error(), "'"+tt.field+"'") {
+			t.Errorf("%s: ожидалась ошибка валидации поля %s, получено %v", tt.name, tt.field, err)
+		}
+	}
+
+	if got := len(fake.CallsTo("ffmpeg")); got != calls {
+		t.Errorf("FFmpeg не должен запускаться с некорректными заголовками, вызовов: %d", got-calls)
+	}
+}
+
+func TestRequestProxy(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	// HTTP прокси получает запрос с абсолютным URL исходного сервера
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		if r.Header.Get("Referer") != "https://player.example.com/watch" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXT-X-ENDLIST\n")
+	}))
+	t.Cleanup(proxy.Close)
+
+	info, err := tc.GetHLSInfoWithConfig(context.Background(), dto.HLSConfig{
+		URL: "http://stream.invalid/index.m3u8",
+		RequestOptions: dto.RequestOptions{
+			Referer: "https://player.example.com/watch",
+			Proxy:   proxy.URL,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки через прокси: %v", err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://stream.invalid/index.m3u8" || info.Media == nil {
+		t.Errorf("Запрос не прошел через прокси: %v", proxied)
+	}
+}
+
+func TestRequestCABundle(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4,\nseg0.ts\n#EXT-X-ENDLIST\n")
+	}))
+	t.Cleanup(server.Close)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(bundle, certificate, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Самоподписанный сертификат не проходит проверку без CA bundle
+	if _, err := tc.GetHLSInfo(server.URL + "/index.m3u8"); err == nil {
+		t.Error("Ожидалась ошибка проверки сертификата")
+	}
+
+	config := dto.HLSConfig{URL: server.URL + "/index.m3u8", RequestOptions: dto.RequestOptions{CABundle: bundle}}
+	if _, err := tc.GetHLSInfoWithConfig(context.Background(), config); err != nil {
+		t.Errorf("Ошибка загрузки с CA bundle: %v", err)
+	}
+	if args := strings.Join(utils.BuildHTTPInputArgs(config), " "); !strings.Contains(args, "-ca_file "+bundle+" -tls_verify 1") {
+		t.Errorf("FFmpeg не получил CA bundle: %s", args)
+	}
+}
+
+// indexOf возвращает индекс значения в срезе или -1
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
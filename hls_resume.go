@@ -0,0 +1,232 @@
+package transcoder
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+)
+
+// resumeHeader первая запись манифеста: параметры загрузки, к которой он относится
+type resumeHeader struct {
+	URL    string   `json:"url"`
+	Tracks []string `json:"tracks"`
+}
+
+// segmentRecord запись о полностью загруженном сегменте
+type segmentRecord struct {
+	Track  int    `json:"track"`
+	Index  int    `json:"index"`
+	URI    string `json:"uri"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// resumeManifest журнал загруженных сегментов (JSON, одна запись на строку),
+// который хранится рядом с выходным файлом и позволяет продолжить
+// прерванную загрузку с того же места
+type resumeManifest struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	records map[[2]int]segmentRecord
+}
+
+// resumePaths возвращает директорию сегментов и путь манифеста для выходного файла
+func resumePaths(outputPath string) (dir, manifest string) {
+	return outputPath + ".parts", outputPath + ".manifest"
+}
+
+// openResumeManifest открывает манифест загрузки. Если манифест относится
+// к другой загрузке (другой URL или набор дорожек), ранее загруженные
+// сегменты удаляются и загрузка начинается заново.
+func openResumeManifest(config dto.HLSConfig, tracks []hlsTrack) (*resumeManifest, string, error) {
+	dir, path := resumePaths(config.OutputPath)
+
+	header := resumeHeader{URL: config.URL}
+	for _, track := range tracks {
+		header.Tracks = append(header.Tracks, track.URL)
+	}
+
+	manifest := &resumeManifest{path: path, records: make(map[[2]int]segmentRecord)}
+
+	flags := os.O_APPEND | os.O_WRONLY
+	if !manifest.load(header) {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, "", fmt.Errorf("не удалось очистить директорию сегментов: %w", err)
+		}
+		flags = os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, "", fmt.Errorf("не удалось создать директорию сегментов: %w", err)
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, "", fmt.Errorf("не удалось открыть манифест загрузки: %w", err)
+	}
+	manifest.file = file
+
+	if flags&os.O_TRUNC != 0 {
+		if err := manifest.append(header); err != nil {
+			file.Close()
+			return nil, "", err
+		}
+	}
+
+	return manifest, dir, nil
+}
+
+// load читает манифест и сообщает, относится ли он к загрузке с указанным заголовком
+func (m *resumeManifest) load(header resumeHeader) bool {
+	file, err := os.Open(m.path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return false
+	}
+
+	var stored resumeHeader
+	if err := json.Unmarshal(scanner.Bytes(), &stored); err != nil || !sameHeader(stored, header) {
+		return false
+	}
+
+	for scanner.Scan() {
+		var record segmentRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// Недописанная последняя строка после аварийного завершения
+			continue
+		}
+		m.records[[2]int{record.Track, record.Index}] = record
+	}
+	return scanner.Err() == nil
+}
+
+// sameHeader сравнивает параметры загрузок
+func sameHeader(a, b resumeHeader) bool {
+	if a.URL != b.URL || len(a.Tracks) != len(b.Tracks) {
+		return false
+	}
+	for i := range a.Tracks {
+		if a.Tracks[i] != b.Tracks[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// append дописывает запись в манифест и сбрасывает её на диск
+func (m *resumeManifest) append(entry interface{}) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации манифеста: %w", err)
+	}
+
+	if _, err := m.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("ошибка записи манифеста: %w", err)
+	}
+	return m.file.Sync()
+}
+
+// Len возвращает количество загруженных сегментов по манифесту
+func (m *resumeManifest) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.records)
+}
+
+// track возвращает представление манифеста для одной дорожки
+func (m *resumeManifest) track(index int) *trackManifest {
+	return &trackManifest{manifest: m, track: index}
+}
+
+// Close закрывает манифест
+func (m *resumeManifest) Close() error {
+	return m.file.Close()
+}
+
+// remove удаляет манифест и директорию сегментов после успешной загрузки
+func (m *resumeManifest) remove(dir string) error {
+	m.Close()
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Remove(m.path)
+}
+
+// trackManifest манифест сегментов одной дорожки. Методы безопасны для nil
+// (загрузка без возобновления).
+type trackManifest struct {
+	manifest *resumeManifest
+	track    int
+}
+
+// completed сообщает, загружен ли сегмент ранее: запись есть в манифесте,
+// а файл на диске совпадает с ней по размеру и контрольной сумме
+func (t *trackManifest) completed(index int, segment m3u8.Segment, path string) bool {
+	if t == nil {
+		return false
+	}
+
+	t.manifest.mu.Lock()
+	record, exists := t.manifest.records[[2]int{t.track, index}]
+	t.manifest.mu.Unlock()
+
+	if !exists || record.URI != segment.URI {
+		return false
+	}
+
+	size, checksum, err := fileChecksum(path)
+	return err == nil && size == record.Size && checksum == record.SHA256
+}
+
+// record добавляет загруженный сегмент в манифест
+func (t *trackManifest) record(index int, segment m3u8.Segment, path string) error {
+	if t == nil {
+		return nil
+	}
+
+	size, checksum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+	record := segmentRecord{Track: t.track, Index: index, URI: segment.URI, Size: size, SHA256: checksum}
+
+	t.manifest.mu.Lock()
+	defer t.manifest.mu.Unlock()
+
+	if err := t.manifest.append(record); err != nil {
+		return err
+	}
+	t.manifest.records[[2]int{t.track, index}] = record
+	return nil
+}
+
+// fileChecksum возвращает размер файла и его SHA-256
+func fileChecksum(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
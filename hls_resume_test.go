@@ -0,0 +1,92 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+func TestDownloadHLSResume(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	var mu sync.Mutex
+	broken := true
+	var requested []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:4\n")
+		for i := 0; i < 5; i++ {
+			fmt.Fprintf(&b, "#EXTINF:4.0,\nseg%d.ts\n", i)
+		}
+		b.WriteString("#EXT-X-ENDLIST\n")
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requested = append(requested, r.URL.Path)
+		if broken && r.URL.Path == "/seg3.ts" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "movie.mp4")
+	config := dto.HLSConfig{
+		URL:         server.URL + "/index.m3u8",
+		OutputPath:  output,
+		Concurrency: 1,
+		Resume:      true,
+	}
+
+	if err := tc.DownloadHLSWithConfig(context.Background(), config); err == nil {
+		t.Fatal("Ожидалась ошибка загрузки сегмента 3")
+	}
+
+	partsDir, manifestPath := resumePaths(output)
+	if _, err := os.Stat(manifestPath); err != nil {
+		t.Fatalf("Манифест должен сохраниться после ошибки: %v", err)
+	}
+
+	// Поврежденный сегмент загружается заново
+	if err := os.WriteFile(segmentPath(filepath.Join(partsDir, "track_0"), 1), []byte("broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	broken = false
+	requested = nil
+	mu.Unlock()
+
+	if err := tc.DownloadHLSWithConfig(context.Background(), config); err != nil {
+		t.Fatalf("Ошибка возобновленной загрузки: %v", err)
+	}
+
+	sort.Strings(requested)
+	if want := []string{"/seg1.ts", "/seg3.ts", "/seg4.ts"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("Ожидалась загрузка только %v, загружено %v", want, requested)
+	}
+
+	if _, err := os.Stat(partsDir); !os.IsNotExist(err) {
+		t.Error("Директория сегментов должна удаляться после успешной загрузки")
+	}
+	if _, err := os.Stat(manifestPath); !os.IsNotExist(err) {
+		t.Error("Манифест должен удаляться после успешной загрузки")
+	}
+}
@@ -0,0 +1,408 @@
+package transcoder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+const (
+	// defaultSegmentWorkers количество параллельных загрузок по умолчанию
+	defaultSegmentWorkers = 4
+	// segmentRetryDelay базовая задержка между повторами загрузки сегмента
+	segmentRetryDelay = 500 * time.Millisecond
+)
+
+// httpStatusError ошибка HTTP ответа с неуспешным статусом
+type httpStatusError struct {
+	URL        string
+	StatusCode int
+	RetryAfter time.Duration // Задержка из Retry-After (0 - не указана)
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("ошибка HTTP %d: %s", e.StatusCode, e.URL)
+}
+
+// retryable сообщает, имеет ли смысл повторять запрос
+func (e *httpStatusError) retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode == http.StatusRequestTimeout
+}
+
+// downloadNative загружает сегменты VOD дорожек средствами Go и собирает
+// итоговый файл, используя FFmpeg только для финального ремукса.
+// Дорожки без загруженного плейлиста (субтитры) передаются FFmpeg по URL.
+// В режиме config.Resume сегменты и манифест хранятся рядом с выходным файлом
+// и удаляются только после успешной сборки.
+func (h *HLSDownloader) downloadNative(ctx context.Context, tracks []hlsTrack, config dto.HLSConfig) error {
+	var (
+		workDir  string
+		manifest *resumeManifest
+		err      error
+	)
+	if config.Resume {
+		if manifest, workDir, err = openResumeManifest(config, tracks); err != nil {
+			return err
+		}
+		defer manifest.Close()
+
+		if done := manifest.Len(); done > 0 {
+			h.transcoder.logger.Info("Возобновление загрузки: %d сегментов уже загружено", done)
+		}
+	} else {
+		if workDir, err = os.MkdirTemp(h.transcoder.tempDir, "hls_"); err != nil {
+			return fmt.Errorf("не удалось создать рабочую директорию: %w", err)
+		}
+		defer os.RemoveAll(workDir)
+	}
+
+	inputs := make([]muxInput, 0, len(tracks))
+	for i, track := range tracks {
+		if track.Playlist == nil {
+			// Дорожка без плейлиста (субтитры) загружается самим FFmpeg
+			if err := utils.CheckFFmpegProxy(config); err != nil {
+				return err
+			}
+			inputs = append(inputs, muxInput{
+				Path:      track.URL,
+				Options:   utils.BuildHTTPInputArgs(config),
+				Rendition: track.Rendition,
+			})
+			continue
+		}
+
+		h.transcoder.logger.Info("Загрузка %d сегментов (%.0fs) из %s",
+			len(track.Playlist.Segments), track.Playlist.TotalDuration().Seconds(), track.URL)
+
+		trackDir := filepath.Join(workDir, fmt.Sprintf("track_%d", i))
+		if err := os.MkdirAll(trackDir, 0755); err != nil {
+			return fmt.Errorf("не удалось создать рабочую директорию: %w", err)
+		}
+
+		var progress *trackManifest
+		if manifest != nil {
+			progress = manifest.track(i)
+		}
+		if err := h.fetchSegments(ctx, track.Playlist, config, trackDir, progress); err != nil {
+			return err
+		}
+
+		joinedPath := filepath.Join(workDir, fmt.Sprintf("track_%d.ts", i))
+		if err := concatSegments(track.Playlist, trackDir, joinedPath); err != nil {
+			return err
+		}
+		inputs = append(inputs, muxInput{Path: joinedPath, Rendition: track.Rendition})
+	}
+
+	if err := h.remux(ctx, inputs, config.OutputPath); err != nil {
+		return err
+	}
+	if manifest != nil {
+		return manifest.remove(workDir)
+	}
+	return nil
+}
+
+// canDownloadNatively сообщает, может ли плейлист быть собран без FFmpeg.
+// Сегменты с секцией инициализации (fMP4) собирает FFmpeg.
+func canDownloadNatively(playlist *m3u8.MediaPlaylist) bool {
+	for _, segment := range playlist.Segments {
+		if segment.Map != nil {
+			return false
+		}
+	}
+	return canDecryptNatively(playlist)
+}
+
+// fetchSegments параллельно загружает все сегменты плейлиста в workDir.
+// При первой неустранимой ошибке остальные загрузки отменяются.
+// Сегменты, уже отмеченные в manifest, повторно не загружаются.
+func (h *HLSDownloader) fetchSegments(ctx context.Context, playlist *m3u8.MediaPlaylist, config dto.HLSConfig, workDir string, manifest *trackManifest) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := config.Concurrency
+	if workers <= 0 {
+		workers = defaultSegmentWorkers
+	}
+
+	keys := newKeyCache()
+	indexes := make(chan int)
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				segment, path := playlist.Segments[index], segmentPath(workDir, index)
+				if manifest.completed(index, segment, path) {
+					continue
+				}
+
+				err := h.fetchSegment(ctx, segment, config, keys, path)
+				if err == nil {
+					err = manifest.record(index, segment, path)
+				}
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = fmt.Errorf("ошибка загрузки сегмента %d: %w", index, err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for index := range playlist.Segments {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// fetchSegment загружает (и при необходимости расшифровывает) один сегмент
+// с повторами и таймаутом на попытку
+func (h *HLSDownloader) fetchSegment(ctx context.Context, segment m3u8.Segment, config dto.HLSConfig, keys *keyCache, path string) error {
+	attempts := config.RetryAttempts + 1
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var decrypt func([]byte) ([]byte, error)
+		if decrypt, err = h.segmentDecrypter(ctx, segment, config, keys); err == nil {
+			if err = h.downloadToFile(ctx, segment, config, path, decrypt); err == nil {
+				return nil
+			}
+		}
+
+		if ctx.Err() != nil || !isRetryableFetchError(err) || attempt == attempts {
+			break
+		}
+
+		h.transcoder.logger.Debug("Повтор загрузки сегмента %s (попытка %d): %v", segment.URI, attempt+1, err)
+		if sleepErr := sleepContext(ctx, retryDelay(err, attempt, config)); sleepErr != nil {
+			return sleepErr
+		}
+	}
+	return err
+}
+
+// downloadToFile загружает сегмент во временный файл и атомарно переименовывает его.
+// Если задан decrypt, содержимое расшифровывается перед записью.
+func (h *HLSDownloader) downloadToFile(ctx context.Context, segment m3u8.Segment, config dto.HLSConfig, path string, decrypt func([]byte) ([]byte, error)) error {
+	if config.SegmentTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.SegmentTimeout)
+		defer cancel()
+	}
+
+	resp, err := h.getRange(ctx, segment.URI, segment.ByteRange, config)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	if segment.ByteRange != nil && resp.StatusCode == http.StatusOK {
+		// Сервер проигнорировал Range и вернул ресурс целиком
+		if _, err := io.CopyN(io.Discard, resp.Body, segment.ByteRange.Offset); err != nil {
+			return err
+		}
+		body = io.LimitReader(resp.Body, segment.ByteRange.Length)
+	}
+
+	if decrypt != nil {
+		// AES-128-CBC требует сегмент целиком для снятия выравнивания
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if data, err = decrypt(data); err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	tmpPath := path + ".part"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// get выполняет GET запрос с заголовками, cookies и User-Agent из конфигурации
+func (h *HLSDownloader) get(ctx context.Context, url string, config dto.HLSConfig) (*http.Response, error) {
+	return h.getRange(ctx, url, nil, config)
+}
+
+// getRange выполняет GET запрос части ресурса. При byteRange == nil запрашивается ресурс целиком.
+func (h *HLSDownloader) getRange(ctx context.Context, url string, byteRange *m3u8.ByteRange, config dto.HLSConfig) (*http.Response, error) {
+	req, err := h.newRequest(ctx, http.MethodGet, url, config)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != nil {
+		req.Header.Set("Range", byteRange.Header())
+	}
+	return h.do(req, config)
+}
+
+// newRequest создает запрос с заголовками, cookies, User-Agent и Referer из конфигурации
+func (h *HLSDownloader) newRequest(ctx context.Context, method, url string, config dto.HLSConfig) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	utils.DecorateRequest(req, config)
+	return req, nil
+}
+
+// do выполняет запрос клиентом для конфигурации (с ее прокси и CA bundle);
+// неуспешный статус возвращается как *httpStatusError
+func (h *HLSDownloader) do(req *http.Request, config dto.HLSConfig) (*http.Response, error) {
+	client, err := h.clientFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		statusErr := &httpStatusError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+		if statusErr.retryable() {
+			statusErr.RetryAfter, _ = utils.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, statusErr
+	}
+	return resp, nil
+}
+
+// retryDelay возвращает задержку перед повтором: нарастающую с номером
+// попытки, но не меньше Retry-After ответа (не больше config.MaxRetryAfter)
+func retryDelay(err error, attempt int, config dto.HLSConfig) time.Duration {
+	delay := segmentRetryDelay * time.Duration(attempt)
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		maxRetryAfter := config.MaxRetryAfter
+		if maxRetryAfter <= 0 {
+			maxRetryAfter = utils.DefaultMaxRetryAfter
+		}
+		delay = min(statusErr.RetryAfter, maxRetryAfter)
+	}
+	return delay
+}
+
+// fetchText загружает текстовый ресурс (плейлист) целиком
+func (h *HLSDownloader) fetchText(ctx context.Context, url string, config dto.HLSConfig) (string, error) {
+	resp, err := h.get(ctx, url, config)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// isRetryableFetchError определяет, стоит ли повторять загрузку
+func isRetryableFetchError(err error) bool {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	// Неверное выравнивание означает неверный ключ или IV, повтор не поможет
+	return !errors.Is(err, ErrInvalidPadding)
+}
+
+// segmentPath возвращает путь к файлу сегмента в рабочей директории
+func segmentPath(workDir string, index int) string {
+	return filepath.Join(workDir, fmt.Sprintf("seg_%06d.ts", index))
+}
+
+// concatSegments склеивает загруженные сегменты в один файл в порядке плейлиста
+func concatSegments(playlist *m3u8.MediaPlaylist, workDir, outputPath string) error {
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл для склейки: %w", err)
+	}
+	defer output.Close()
+
+	for index := range playlist.Segments {
+		if err := appendFile(output, segmentPath(workDir, index)); err != nil {
+			return fmt.Errorf("ошибка склейки сегмента %d: %w", index, err)
+		}
+	}
+	return output.Close()
+}
+
+// appendFile дописывает содержимое файла в writer
+func appendFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// remux собирает входные файлы в выходной без перекодирования
+func (h *HLSDownloader) remux(ctx context.Context, inputs []muxInput, outputPath string) error {
+	args := buildMuxArgs(inputs, outputPath, 0)
+
+	stderr := newTailBuffer(stderrTailLines)
+	err := runner.Run(ctx, h.transcoder.runner, runner.Command{
+		Path:   h.transcoder.ffmpegPath,
+		Args:   args,
+		Stderr: stderr,
+	})
+	return newFFmpegError(args, err, stderr.String())
+}
@@ -0,0 +1,260 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+const testSegmentCount = 5
+
+// newHLSTestServer создает сервер с мастер-плейлистом и VOD медиаплейлистом.
+// Сегмент 2 при первом запросе отвечает 503, чтобы проверить повторы.
+func newHLSTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var mu sync.Mutex
+	failed := false
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\nlow/index.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720\nhi/index.m3u8\n")
+	})
+	mux.HandleFunc("/hi/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MEDIA-SEQUENCE:0\n")
+		for i := 0; i < testSegmentCount; i++ {
+			fmt.Fprintf(&b, "#EXTINF:4.0,\nseg%d.ts\n", i)
+		}
+		b.WriteString("#EXT-X-ENDLIST\n")
+		fmt.Fprint(w, b.String())
+	})
+	mux.HandleFunc("/hi/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" || r.Header.Get("Cookie") != "session=abc" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		name := filepath.Base(r.URL.Path)
+		if name == "seg2.ts" {
+			mu.Lock()
+			shouldFail := !failed
+			failed = true
+			mu.Unlock()
+			if shouldFail {
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprintf(w, "[%s]", strings.TrimSuffix(name, ".ts"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchSegmentsWithRetry(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server := newHLSTestServer(t)
+
+	config := dto.HLSConfig{
+		URL: server.URL + "/hi/index.m3u8",
+		RequestOptions: dto.RequestOptions{
+			Headers: map[string]string{"X-Token": "secret"},
+			Cookies: "session=abc",
+		},
+		RetryAttempts: 2,
+		Concurrency:   3,
+	}
+
+	content, err := tc.hls.fetchText(context.Background(), config.URL, config)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки плейлиста: %v", err)
+	}
+	playlist, err := m3u8.ParseMedia(content, config.URL)
+	if err != nil {
+		t.Fatalf("Ошибка разбора плейлиста: %v", err)
+	}
+
+	workDir := t.TempDir()
+	if err := tc.hls.fetchSegments(context.Background(), playlist, config, workDir, nil); err != nil {
+		t.Fatalf("Ошибка загрузки сегментов: %v", err)
+	}
+
+	joined := filepath.Join(workDir, "joined.ts")
+	if err := concatSegments(playlist, workDir, joined); err != nil {
+		t.Fatalf("Ошибка склейки: %v", err)
+	}
+
+	data, _ := os.ReadFile(joined)
+	if string(data) != "[seg0][seg1][seg2][seg3][seg4]" {
+		t.Errorf("Неожиданное содержимое после склейки: %q", data)
+	}
+}
+
+func TestFetchSegmentsFailsWithoutRetries(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server := newHLSTestServer(t)
+
+	config := dto.HLSConfig{
+		URL: server.URL + "/hi/index.m3u8",
+		RequestOptions: dto.RequestOptions{
+			Headers: map[string]string{"X-Token": "secret"},
+			Cookies: "session=abc",
+		},
+	}
+
+	content, _ := tc.hls.fetchText(context.Background(), config.URL, config)
+	playlist, _ := m3u8.ParseMedia(content, config.URL)
+
+	err := tc.hls.fetchSegments(context.Background(), playlist, config, t.TempDir(), nil)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Ожидалась ошибка 503 без повторов, получено %v", err)
+	}
+}
+
+func TestDownloadHLSNative(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	server := newHLSTestServer(t)
+
+	output := filepath.Join(t.TempDir(), "out.mp4")
+	err := tc.DownloadHLSWithConfig(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/master.m3u8",
+		OutputPath: output,
+		Quality:    "best",
+		RequestOptions: dto.RequestOptions{
+			Headers: map[string]string{"X-Token": "secret"},
+			Cookies: "session=abc",
+		},
+		RetryAttempts: 1,
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки HLS: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	last := calls[len(calls)-1]
+	args := strings.Join(last.Args, " ")
+	if !strings.Contains(args, "track_0.ts") || !strings.Contains(args, "-c copy") || last.Args[len(last.Args)-1] != output {
+		t.Errorf("FFmpeg должен использоваться только для ремукса, аргументы: %v", last.Args)
+	}
+}
+
+// newRenditionsTestServer отдает мастер-плейлист с аудио на двух языках и субтитрами
+func newRenditionsTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	media := func(prefix string) string {
+		return "#EXTM3U\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.0,\n" + prefix + "0.ts\n#EXTINF:4.0,\n" + prefix + "1.ts\n#EXT-X-ENDLIST\n"
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "#EXTM3U\n"+
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"Русский\",LANGUAGE=\"ru\",DEFAULT=YES,URI=\"audio/ru.m3u8\"\n"+
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"English\",LANGUAGE=\"en-US\",URI=\"audio/en.m3u8\"\n"+
+			"#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"sub\",NAME=\"English\",LANGUAGE=\"en\",URI=\"subs/en.m3u8\"\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720,AUDIO=\"aud\",SUBTITLES=\"sub\"\nvideo/index.m3u8\n")
+	})
+	mux.HandleFunc("/video/index.m3u8", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, media("v")) })
+	mux.HandleFunc("/audio/ru.m3u8", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, media("ru")) })
+	mux.HandleFunc("/audio/en.m3u8", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, media("en")) })
+	mux.HandleFunc("/subs/en.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Субтитры должны загружаться FFmpeg, а не Go клиентом")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[%s]", r.URL.Path)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDownloadHLSWithRenditions(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	server := newRenditionsTestServer(t)
+
+	output := filepath.Join(t.TempDir(), "out.mp4")
+	err := tc.DownloadHLSWithConfig(context.Background(), dto.HLSConfig{
+		URL:        server.URL + "/master.m3u8",
+		OutputPath: output,
+		RequestOptions: dto.RequestOptions{
+			Cookies: "session=abc",
+		},
+		AudioLanguages:    []string{"en", "ru"},
+		SubtitleLanguages: []string{"eng"},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки HLS: %v", err)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	args := strings.Join(calls[len(calls)-1].Args, " ")
+
+	for _, want := range []string{
+		"track_0.ts", "track_1.ts", "track_2.ts",
+		"Cookie: session=abc\r\n -i " + server.URL + "/subs/en.m3u8",
+		"-map 0:v? -map 1:a -map 2:a -map 3:s",
+		"-metadata:s:a:0 language=eng -metadata:s:a:0 title=English -disposition:a:0 default",
+		"-metadata:s:a:1 language=rus -metadata:s:a:1 title=Русский -disposition:a:1 0",
+		"-metadata:s:s:0 language=eng",
+		"-c copy -c:s mov_text",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("В аргументах нет %q: %s", want, args)
+		}
+	}
+	if strings.Contains(args, "0:a?") {
+		t.Errorf("Аудио основного варианта не должно использоваться при внешних дорожках: %s", args)
+	}
+
+	// MPEG-TS не принимает WebVTT: субтитры пропускаются, аудио остается
+	err = tc.DownloadHLSWithConfig(context.Background(), dto.HLSConfig{
+		URL:               server.URL + "/master.m3u8",
+		OutputPath:        filepath.Join(t.TempDir(), "out.ts"),
+		AudioLanguages:    []string{"en"},
+		SubtitleLanguages: []string{"eng"},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка загрузки HLS в MPEG-TS: %v", err)
+	}
+
+	calls = fake.CallsTo("ffmpeg")
+	args = strings.Join(calls[len(calls)-1].Args, " ")
+	if strings.Contains(args, "subs/en.m3u8") || strings.Contains(args, "2:s") || !strings.Contains(args, "-map 1:a") {
+		t.Errorf("Для MPEG-TS субтитры не должны подключаться: %s", args)
+	}
+}
+
+func TestSelectRenditionsDefault(t *testing.T) {
+	info, err := utils.ParsePlaylist(testMasterPlaylist, "https://cdn.example.com/show/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variant := findVariant(info, "https://cdn.example.com/show/hi/index.m3u8")
+	renditions := selectRenditions(info.Master, variant, dto.HLSConfig{})
+	if len(renditions) != 1 || renditions[0].Language != "ru" {
+		t.Errorf("Ожидалась DEFAULT аудио дорожка, получено %+v", renditions)
+	}
+
+	// Неизвестный язык не оставляет файл без звука
+	renditions = selectRenditions(info.Master, variant, dto.HLSConfig{AudioLanguages: []string{"ja"}})
+	if len(renditions) != 1 || renditions[0].Language != "ru" {
+		t.Errorf("Ожидался возврат к DEFAULT дорожке, получено %+v", renditions)
+	}
+}
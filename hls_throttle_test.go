@@ -0,0 +1,191 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// newThrottleTestServer отдает сегменты по 5000 байт и запоминает
+// наибольшее число одновременных запросов
+func newThrottleTestServer(t *testing.T) (*httptest.Server, func() int) {
+	t.Helper()
+
+	var (
+		mu             sync.Mutex
+		active, peak   int
+		segmentPayload = strings.Repeat("x", 5000)
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		peak = max(peak, active)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, segmentPayload)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return peak
+	}
+}
+
+// testThrottlePlaylist плейлист из count сегментов сервера
+func testThrottlePlaylist(serverURL string, count int) *m3u8.MediaPlaylist {
+	playlist := &m3u8.MediaPlaylist{URL: serverURL + "/index.m3u8", EndList: true}
+	for i := 0; i < count; i++ {
+		playlist.Segments = append(playlist.Segments, m3u8.Segment{URI: fmt.Sprintf("%s/seg%d.ts", serverURL, i), Sequence: int64(i)})
+	}
+	return playlist
+}
+
+func TestThrottleHostLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     dto.HLSConfig
+		minElapsed time.Duration
+		maxPeak    int
+	}{
+		// 4 сегмента по 5000 байт при 40000 байт/с - не быстрее 0.5 с
+		{"скорость", dto.HLSConfig{RequestOptions: dto.RequestOptions{RateLimit: 40000}}, 400 * time.Millisecond, 4},
+		// 4 запроса при 10 запросах/с - не быстрее 0.3 с
+		{"частота запросов", dto.HLSConfig{RequestOptions: dto.RequestOptions{RequestsPerSecond: 10}}, 250 * time.Millisecond, 4},
+		{"соединения", dto.HLSConfig{RequestOptions: dto.RequestOptions{MaxConnections: 1}}, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, _ := newFakeTranscoder(t)
+			server, peak := newThrottleTestServer(t)
+
+			config := tt.config
+			config.Concurrency = 4
+
+			started := time.Now()
+			if err := tc.hls.fetchSegments(context.Background(), testThrottlePlaylist(server.URL, 4), config, t.TempDir(), nil); err != nil {
+				t.Fatalf("Ошибка загрузки сегментов: %v", err)
+			}
+			if elapsed := time.Since(started); elapsed < tt.minElapsed {
+				t.Errorf("Загрузка заняла %v, ожидалось не меньше %v", elapsed, tt.minElapsed)
+			}
+			if got := peak(); got > tt.maxPeak {
+				t.Errorf("Одновременных запросов %d, ожидалось не больше %d", got, tt.maxPeak)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	var (
+		mu       sync.Mutex
+		requests []time.Time
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, time.Now())
+		if len(requests) == 1 {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, "segment")
+	}))
+	t.Cleanup(server.Close)
+
+	// Retry-After (30 с) ограничен MaxRetryAfter, который превышает обычную задержку повтора
+	maxRetryAfter := 700 * time.Millisecond
+	config := dto.HLSConfig{RetryAttempts: 1, RequestOptions: dto.RequestOptions{MaxRetryAfter: maxRetryAfter, RequestsPerSecond: 100}}
+	playlist := testThrottlePlaylist(server.URL, 1)
+	if err := tc.hls.fetchSegments(context.Background(), playlist, config, t.TempDir(), nil); err != nil {
+		t.Fatalf("Ошибка загрузки после Retry-After: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 {
+		t.Fatalf("Ожидалось 2 запроса, получено %d", len(requests))
+	}
+	// Верхняя граница с большим запасом: важно лишь, что Retry-After не выжидается целиком
+	if wait := requests[1].Sub(requests[0]); wait < maxRetryAfter-100*time.Millisecond || wait > 10*maxRetryAfter {
+		t.Errorf("Повтор через %v, ожидалось около MaxRetryAfter (%v)", wait, maxRetryAfter)
+	}
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	if delay, ok := utils.ParseRetryAfter("Wed, 01 May 2024 10:00:30 GMT", now); !ok || delay != 30*time.Second {
+		t.Errorf("Retry-After с датой разобран неверно: %v %v", delay, ok)
+	}
+}
+
+func TestThrottleIdleTimeout(t *testing.T) {
+	// Сервер отдает часть тела и перестает отвечать
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "partial")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := utils.NewHTTPClient(dto.HLSConfig{RequestOptions: dto.RequestOptions{RateLimit: 1 << 20}}, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Ошибка создания клиента: %v", err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	defer resp.Body.Close()
+
+	start := time.Now()
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Error("Ожидалась ошибка чтения зависшего тела")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Чтение зависшего тела прервано через %v", elapsed)
+	}
+}
+
+func TestThrottleFFmpegWarning(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	logger := &recordingLogger{}
+	tc.SetLogger(logger)
+
+	config := dto.HLSConfig{
+		URL:            "https://example.com/live.m3u8",
+		OutputPath:     filepath.Join(t.TempDir(), "out.mp4"),
+		Duration:       10 * time.Second,
+		RequestOptions: dto.RequestOptions{RateLimit: 1 << 20},
+	}
+	if err := tc.hls.downloadWithFFmpeg(context.Background(), config.URL, config); err != nil {
+		t.Fatalf("Ошибка загрузки через FFmpeg: %v", err)
+	}
+
+	warnings := strings.Join(logger.Warnings(), "\n")
+	if !strings.Contains(warnings, "RateLimit") {
+		t.Errorf("Ожидалось предупреждение об ограничениях нагрузки, получено %q", warnings)
+	}
+}
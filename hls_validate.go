@@ -0,0 +1,300 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// ValidateHLS проверяет плейлист, полученный GetPlaylistInfo, на соответствие
+// RFC 8216. Для мастер-плейлиста загружаются и проверяются все медиаплейлисты
+// вариантов и EXT-X-MEDIA. Сегменты, секции инициализации и ключи проверяются
+// на доступность HEAD запросами. Нарушения попадают в отчет; ошибка
+// возвращается, только если проверку невозможно выполнить.
+func (h *HLSDownloader) ValidateHLS(ctx context.Context, info *dto.PlaylistInfo, config dto.ConformanceConfig) (*dto.ConformanceReport, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("ошибка валидации конфигурации проверки: %w", err)
+	}
+	if info.MPD != nil {
+		return nil, fmt.Errorf("проверка MPD манифестов не поддерживается")
+	}
+
+	request := dto.HLSConfig{RequestOptions: config.RequestOptions}
+	report := &dto.ConformanceReport{URL: info.URL}
+
+	var playlists []*m3u8.MediaPlaylist
+	switch {
+	case info.Master != nil:
+		report.Issues = append(report.Issues, utils.ValidateMasterPlaylist(info.Master)...)
+		for _, uri := range mediaPlaylistURIs(info.Master) {
+			playlist, issue := h.loadMediaPlaylist(ctx, uri, request)
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			if issue != nil {
+				report.Issues = append(report.Issues, *issue)
+				continue
+			}
+			playlists = append(playlists, playlist)
+		}
+	case info.Media != nil:
+		playlists = append(playlists, info.Media)
+	default:
+		return nil, fmt.Errorf("плейлист не разобран")
+	}
+
+	for _, playlist := range playlists {
+		report.Issues = append(report.Issues, utils.ValidateMediaPlaylist(playlist)...)
+	}
+	report.Playlists = len(playlists)
+	report.Issues = append(report.Issues, validateVariantConsistency(info.URL, playlists)...)
+
+	if config.ReloadCheck {
+		issues, err := h.validateReloads(ctx, playlists, request)
+		if err != nil {
+			return nil, err
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+
+	if !config.SkipReachability {
+		uris := resourceURIs(playlists, config.SegmentSample)
+		report.Issues = append(report.Issues, h.checkReachability(ctx, uris, config.Concurrency, request)...)
+		report.CheckedURIs = len(uris)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+
+	return report, nil
+}
+
+// mediaPlaylistURIs возвращает медиаплейлисты вариантов, I-frame вариантов
+// и EXT-X-MEDIA без повторов
+func mediaPlaylistURIs(master *m3u8.MasterPlaylist) []string {
+	var uris []string
+	for _, variant := range master.Variants {
+		uris = append(uris, variant.URI)
+	}
+	for _, variant := range master.IFrameVariants {
+		uris = append(uris, variant.URI)
+	}
+	for _, rendition := range master.Renditions {
+		if rendition.URI != "" {
+			uris = append(uris, rendition.URI)
+		}
+	}
+	return utils.UniqueStrings(uris)
+}
+
+// loadMediaPlaylist загружает и разбирает медиаплейлист. Ошибка загрузки
+// или разбора возвращается замечанием отчета.
+func (h *HLSDownloader) loadMediaPlaylist(ctx context.Context, uri string, request dto.HLSConfig) (*m3u8.MediaPlaylist, *dto.ConformanceIssue) {
+	content, err := h.fetchText(ctx, uri, request)
+	if err != nil {
+		return nil, &dto.ConformanceIssue{Severity: dto.SeverityError, Rule: dto.RuleUnreachable, URI: uri, Message: fmt.Sprintf("медиаплейлист недоступен: %v", err)}
+	}
+	if m3u8.IsMaster(content) {
+		return nil, &dto.ConformanceIssue{Severity: dto.SeverityError, Rule: dto.RuleSyntax, URI: uri, Message: "вместо медиаплейлиста получен мастер-плейлист"}
+	}
+
+	playlist, err := m3u8.ParseMedia(content, uri)
+	if err != nil {
+		return nil, &dto.ConformanceIssue{Severity: dto.SeverityError, Rule: dto.RuleSyntax, URI: uri, Message: fmt.Sprintf("ошибка разбора медиаплейлиста: %v", err)}
+	}
+	return playlist, nil
+}
+
+// validateVariantConsistency сверяет медиаплейлисты одного мастер-плейлиста:
+// все live или все VOD, а длительности VOD различаются не больше чем на
+// TARGETDURATION
+func validateVariantConsistency(masterURL string, playlists []*m3u8.MediaPlaylist) []dto.ConformanceIssue {
+	if len(playlists) < 2 {
+		return nil
+	}
+
+	var live, vod []string
+	for _, playlist := range playlists {
+		if playlist.IsLive() {
+			live = append(live, playlist.URL)
+		} else {
+			vod = append(vod, playlist.URL)
+		}
+	}
+	if len(live) > 0 && len(vod) > 0 {
+		return []dto.ConformanceIssue{{
+			Severity: dto.SeverityError, Rule: dto.RuleVariantConsistency, URI: masterURL,
+			Message: fmt.Sprintf("live плейлисты (%s) смешаны с VOD (%s)", strings.Join(live, ", "), strings.Join(vod, ", ")),
+		}}
+	}
+	if len(live) > 0 {
+		return nil
+	}
+
+	var issues []dto.ConformanceIssue
+	reference := playlists[0]
+	for _, playlist := range playlists[1:] {
+		tolerance := max(reference.TargetDuration, playlist.TargetDuration)
+		difference := reference.TotalDuration() - playlist.TotalDuration()
+		if difference < 0 {
+			difference = -difference
+		}
+		if difference > tolerance {
+			issues = append(issues, dto.ConformanceIssue{
+				Severity: dto.SeverityWarning, Rule: dto.RuleSegmentDuration, URI: playlist.URL,
+				Message: fmt.Sprintf("длительность %v отличается от %v у %s", playlist.TotalDuration(), reference.TotalDuration(), reference.URL),
+			})
+		}
+	}
+	return issues
+}
+
+// validateReloads загружает обновления live плейлистов через TARGETDURATION
+// и проверяет, что MEDIA-SEQUENCE не откатывается
+func (h *HLSDownloader) validateReloads(ctx context.Context, playlists []*m3u8.MediaPlaylist, request dto.HLSConfig) ([]dto.ConformanceIssue, error) {
+	var (
+		live []*m3u8.MediaPlaylist
+		wait time.Duration
+	)
+	for _, playlist := range playlists {
+		if playlist.IsLive() {
+			live = append(live, playlist)
+			wait = max(wait, playlist.TargetDuration)
+		}
+	}
+	if len(live) == 0 {
+		return nil, nil
+	}
+
+	if h.pollInterval > 0 {
+		wait = h.pollInterval
+	}
+	if err := sleepContext(ctx, wait); err != nil {
+		return nil, err
+	}
+
+	var issues []dto.ConformanceIssue
+	for _, playlist := range live {
+		reloaded, issue := h.loadMediaPlaylist(ctx, playlist.URL, request)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if issue != nil {
+			issues = append(issues, *issue)
+			continue
+		}
+		issues = append(issues, utils.ValidatePlaylistReload(playlist, reloaded)...)
+	}
+	return issues, nil
+}
+
+// resourceURIs собирает сегменты (не больше sample на плейлист), секции
+// инициализации и ключи без повторов. Ключи с не-HTTP схемой (skd://) пропускаются.
+func resourceURIs(playlists []*m3u8.MediaPlaylist, sample int) []string {
+	var uris []string
+	for _, playlist := range playlists {
+		for _, index := range sampleIndexes(len(playlist.Segments), sample) {
+			segment := playlist.Segments[index]
+			uris = append(uris, segment.URI)
+			if segment.Map != nil {
+				uris = append(uris, segment.Map.URI)
+			}
+			if segment.Key != nil && segment.Key.Method != "NONE" && isHTTPURL(segment.Key.URI) {
+				uris = append(uris, segment.Key.URI)
+			}
+		}
+	}
+	return utils.UniqueStrings(uris)
+}
+
+// sampleIndexes возвращает sample равномерно распределенных индексов из
+// count, включая первый и последний (sample <= 0 - все)
+func sampleIndexes(count, sample int) []int {
+	if sample <= 0 || sample > count {
+		sample = count
+	}
+
+	indexes := make([]int, 0, sample)
+	for i := 0; i < sample; i++ {
+		if sample == 1 {
+			indexes = append(indexes, 0)
+			break
+		}
+		indexes = append(indexes, i*(count-1)/(sample-1))
+	}
+	return indexes
+}
+
+// checkReachability параллельно проверяет доступность URI.
+// Замечания возвращаются в порядке uris.
+func (h *HLSDownloader) checkReachability(ctx context.Context, uris []string, workers int, request dto.HLSConfig) []dto.ConformanceIssue {
+	if workers <= 0 {
+		workers = defaultSegmentWorkers
+	}
+
+	results := make([]error, len(uris))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				results[index] = h.checkURI(ctx, uris[index], request)
+			}
+		}()
+	}
+
+feed:
+	for index := range uris {
+		select {
+		case indexes <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	var issues []dto.ConformanceIssue
+	for i, err := range results {
+		if err != nil {
+			issues = append(issues, dto.ConformanceIssue{Severity: dto.SeverityError, Rule: dto.RuleUnreachable, URI: uris[i], Message: err.Error()})
+		}
+	}
+	return issues
+}
+
+// checkURI проверяет доступность ресурса HEAD запросом. Если сервер не
+// поддерживает HEAD, запрашивается первый байт ресурса.
+func (h *HLSDownloader) checkURI(ctx context.Context, uri string, request dto.HLSConfig) error {
+	req, err := h.newRequest(ctx, http.MethodHead, uri, request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.do(req, request)
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusMethodNotAllowed || statusErr.StatusCode == http.StatusNotImplemented) {
+		resp, err = h.getRange(ctx, uri, &m3u8.ByteRange{Length: 1}, request)
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// isHTTPURL проверяет, что URI загружается по HTTP(S)
+func isHTTPURL(uri string) bool {
+	lower := strings.ToLower(uri)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
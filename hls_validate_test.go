@@ -0,0 +1,163 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// newConformanceTestServer отдает мастер-плейлист с типичными нарушениями.
+// Сегменты отвечают только на GET (HEAD - 405), seg2.ts отсутствует.
+func newConformanceTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	playlists := map[string]string{
+		"/master.m3u8": `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e",AUDIO="aac"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,AVERAGE-BANDWIDTH=3000000,RESOLUTION=1280x720,CODECS="avc1.64001f,mp4a.40.2",SUBTITLES="subs"
+hi.m3u8
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Main",DEFAULT=YES,URI="audio.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Second",DEFAULT=YES,URI="missing.m3u8"
+`,
+		"/low.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:4.0,
+seg1.ts
+#EXTINF:5.2,
+seg2.ts
+#EXTINF:1.0,
+seg3.ts
+`,
+		"/hi.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.0,
+seg1.ts
+#EXTINF:4.0,
+seg3.ts
+`,
+		"/audio.m3u8": `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.0,
+seg1.ts
+#EXTINF:1.0,
+seg3.ts
+#EXTINF:4.0,
+seg4.ts
+#EXT-X-ENDLIST
+`,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if content, exists := playlists[r.URL.Path]; exists {
+			fmt.Fprint(w, content)
+			return
+		}
+		if !strings.HasSuffix(r.URL.Path, ".ts") || r.URL.Path == "/seg2.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Range") != "bytes=0-0" {
+			t.Errorf("Проверка доступности должна запрашивать один байт, Range: %q", r.Header.Get("Range"))
+		}
+		fmt.Fprint(w, "x")
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestValidateHLS(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	server := newConformanceTestServer(t)
+
+	info, err := tc.GetHLSInfo(server.URL + "/master.m3u8")
+	if err != nil {
+		t.Fatalf("Ошибка получения информации: %v", err)
+	}
+	report, err := tc.ValidateHLS(context.Background(), info, dto.ConformanceConfig{})
+	if err != nil {
+		t.Fatalf("Ошибка проверки: %v", err)
+	}
+
+	if report.Valid() || report.Playlists != 3 || report.CheckedURIs != 4 {
+		t.Errorf("Неверный итог проверки: %+v", report)
+	}
+
+	found := make(map[string]string)
+	for _, issue := range report.Issues {
+		found[issue.Rule+" "+strings.TrimPrefix(issue.URI, server.URL)] = issue.Severity
+	}
+	for want, severity := range map[string]string{
+		"codecs /master.m3u8":              dto.SeverityError,   // AUDIO без аудиокодека
+		"bandwidth /master.m3u8":           dto.SeverityWarning, // AVERAGE-BANDWIDTH > BANDWIDTH
+		"rendition-group /master.m3u8":     dto.SeverityError,   // SUBTITLES без группы и два DEFAULT
+		"unreachable /missing.m3u8":        dto.SeverityError,
+		"target-duration /low.m3u8":        dto.SeverityError, // 5.2 округляется до 5 > 4
+		"endlist /low.m3u8":                dto.SeverityError,
+		"segment-duration /audio.m3u8":     dto.SeverityWarning, // короткий сегмент в середине
+		"variant-consistency /master.m3u8": dto.SeverityError,   // hi.m3u8 без ENDLIST - live, остальные VOD
+		"unreachable /seg2.ts":             dto.SeverityError,
+	} {
+		if got, exists := found[want]; !exists || got != severity {
+			t.Errorf("Нет замечания %q (%s), получено: %+v", want, severity, report.Issues)
+		}
+	}
+	if _, exists := found["unreachable /seg1.ts"]; exists {
+		t.Error("Сегмент, отвечающий на GET, не должен считаться недоступным")
+	}
+}
+
+func TestValidateHLSReload(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+	tc.hls.pollInterval = time.Millisecond
+
+	var (
+		mu    sync.Mutex
+		polls int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Второе обновление откатывает MEDIA-SEQUENCE и подменяет сегмент 5
+		sequence, uri := 5, "a.ts"
+		if polls++; polls > 1 {
+			sequence, uri = 4, "b.ts"
+		}
+		fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:%d\n#EXTINF:2,\nold.ts\n#EXTINF:2,\n%s\n", sequence, uri)
+	}))
+	t.Cleanup(server.Close)
+
+	info, err := tc.GetHLSInfo(server.URL + "/live.m3u8")
+	if err != nil {
+		t.Fatalf("Ошибка получения информации: %v", err)
+	}
+	report, err := tc.ValidateHLS(context.Background(), info, dto.ConformanceConfig{ReloadCheck: true, SkipReachability: true})
+	if err != nil {
+		t.Fatalf("Ошибка проверки: %v", err)
+	}
+
+	var messages []string
+	for _, issue := range report.Errors() {
+		if issue.Rule == dto.RuleMediaSequence {
+			messages = append(messages, issue.Message)
+		}
+	}
+	if len(messages) != 2 || report.CheckedURIs != 0 {
+		t.Errorf("Ожидались откат MEDIA-SEQUENCE и подмена сегмента, получено: %+v", report.Issues)
+	}
+}
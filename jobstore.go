@@ -0,0 +1,269 @@
+package transcoder
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// JobStore постоянное хранилище задач очереди
+type JobStore interface {
+	// Save сохраняет текущее состояние задачи
+	Save(job *dto.Job) error
+	// Delete удаляет задачу из хранилища
+	Delete(id string) error
+	// Load возвращает все сохраненные задачи в порядке их добавления
+	Load() ([]*dto.Job, error)
+}
+
+// RecoveryPolicy определяет, что делать с задачами, прерванными перезапуском
+type RecoveryPolicy int
+
+const (
+	RecoveryRequeue RecoveryPolicy = iota // Вернуть прерванные задачи в очередь
+	RecoveryFail                          // Пометить прерванные задачи как failed
+)
+
+// ErrJobInterrupted ошибка задачи, выполнение которой прервал перезапуск процесса
+var ErrJobInterrupted = errors.New("выполнение задачи прервано перезапуском")
+
+// storedJob сериализуемое представление dto.Job
+type storedJob struct {
+	ID        string             `json:"id"`
+	Config    dto.Config         `json:"config"`
+	Status    dto.JobStatus      `json:"status"`
+	Priority  int                `json:"priority"`
+	Progress  float64            `json:"progress"`
+	Error     string             `json:"error,omitempty"`
+	Attempts  int                `json:"attempts"`
+	History   []dto.AttemptError `json:"history,omitempty"`
+	StartTime time.Time          `json:"start_time"`
+	EndTime   time.Time          `json:"end_time"`
+}
+
+// journalEntry запись журнала: сохранение или удаление задачи
+type journalEntry struct {
+	Op  string     `json:"op"`
+	ID  string     `json:"id,omitempty"`
+	Job *storedJob `json:"job,omitempty"`
+}
+
+const (
+	journalOpSave   = "save"
+	journalOpDelete = "delete"
+)
+
+// FileJobStore хранилище задач в виде JSON-журнала (одна запись на строку).
+// Каждое изменение дописывается в конец файла и синхронизируется на диск,
+// при загрузке журнал воспроизводится и компактируется.
+type FileJobStore struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileJobStore открывает (или создает) журнал задач по указанному пути
+func NewFileJobStore(path string) (*FileJobStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("не удалось создать директорию журнала: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть журнал задач: %w", err)
+	}
+
+	return &FileJobStore{path: path, file: file}, nil
+}
+
+// Save дописывает состояние задачи в журнал
+func (s *FileJobStore) Save(job *dto.Job) error {
+	return s.append(journalEntry{Op: journalOpSave, Job: toStoredJob(job)})
+}
+
+// Delete дописывает в журнал удаление задачи
+func (s *FileJobStore) Delete(id string) error {
+	return s.append(journalEntry{Op: journalOpDelete, ID: id})
+}
+
+// append записывает одну запись журнала и сбрасывает её на диск
+func (s *FileJobStore) append(entry journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации задачи: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("ошибка записи журнала задач: %w", err)
+	}
+	return s.file.Sync()
+}
+
+// Load воспроизводит журнал и компактирует его до актуального состояния
+func (s *FileJobStore) Load() ([]*dto.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, order, err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*dto.Job, 0, len(order))
+	for _, id := range order {
+		if record, exists := records[id]; exists {
+			jobs = append(jobs, record.toJob())
+		}
+	}
+
+	if err := s.compact(jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// replay читает журнал и возвращает последнее состояние каждой задачи
+func (s *FileJobStore) replay() (map[string]*storedJob, []string, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("не удалось прочитать журнал задач: %w", err)
+	}
+	defer file.Close()
+
+	records := make(map[string]*storedJob)
+	var order []string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var line, corruptLine int
+	for scanner.Scan() {
+		line++
+
+		// Недописанной после аварийного завершения может быть только последняя
+		// строка; поврежденная строка в середине означает потерю состояния
+		if corruptLine > 0 {
+			return nil, nil, fmt.Errorf("журнал задач поврежден: строка %d", corruptLine)
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			corruptLine = line
+			continue
+		}
+
+		switch entry.Op {
+		case journalOpSave:
+			if entry.Job == nil {
+				continue
+			}
+			if _, exists := records[entry.Job.ID]; !exists {
+				order = append(order, entry.Job.ID)
+			}
+			records[entry.Job.ID] = entry.Job
+		case journalOpDelete:
+			delete(records, entry.ID)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("ошибка чтения журнала задач: %w", err)
+	}
+	return records, order, nil
+}
+
+// compact атомарно переписывает журнал, оставляя по одной записи на задачу
+func (s *FileJobStore) compact(jobs []*dto.Job) error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("ошибка компактирования журнала: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, job := range jobs {
+		if err := encoder.Encode(journalEntry{Op: journalOpSave, Job: toStoredJob(job)}); err != nil {
+			tmp.Close()
+			return fmt.Errorf("ошибка компактирования журнала: %w", err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка компактирования журнала: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("ошибка компактирования журнала: %w", err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("ошибка компактирования журнала: %w", err)
+	}
+
+	// Переоткрываем журнал, так как старый дескриптор указывает на замененный файл
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть журнал задач: %w", err)
+	}
+	s.file.Close()
+	s.file = file
+	return nil
+}
+
+// Close закрывает журнал
+func (s *FileJobStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// toStoredJob преобразует задачу в сериализуемый вид
+func toStoredJob(job *dto.Job) *storedJob {
+	record := &storedJob{
+		ID:        job.ID,
+		Config:    job.Config,
+		Status:    job.Status,
+		Priority:  job.Priority,
+		Progress:  job.Progress,
+		Attempts:  job.Attempts,
+		History:   job.History,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+	}
+	if job.Error != nil {
+		record.Error = job.Error.Error()
+	}
+	return record
+}
+
+// toJob восстанавливает задачу из сериализованного вида
+func (r *storedJob) toJob() *dto.Job {
+	job := &dto.Job{
+		ID:        r.ID,
+		Config:    r.Config,
+		Status:    r.Status,
+		Priority:  r.Priority,
+		Progress:  r.Progress,
+		Attempts:  r.Attempts,
+		History:   r.History,
+		StartTime: r.StartTime,
+		EndTime:   r.EndTime,
+	}
+	if r.Error != "" {
+		job.Error = errors.New(r.Error)
+	}
+	return job
+}
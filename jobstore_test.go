@@ -0,0 +1,161 @@
+package transcoder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+)
+
+func TestFileJobStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+	store, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatalf("Ошибка создания хранилища: %v", err)
+	}
+
+	first := &dto.Job{ID: "first", Status: dto.StatusPending, Priority: 3}
+	second := &dto.Job{ID: "second", Status: dto.StatusPending}
+	third := &dto.Job{ID: "third", Status: dto.StatusPending}
+
+	for _, job := range []*dto.Job{first, second, third} {
+		if err := store.Save(job); err != nil {
+			t.Fatalf("Ошибка сохранения: %v", err)
+		}
+	}
+
+	second.Status = dto.StatusRunning
+	store.Save(second)
+	store.Delete(third.ID)
+	store.Close()
+
+	reopened, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatalf("Ошибка повторного открытия: %v", err)
+	}
+	defer reopened.Close()
+
+	jobs, err := reopened.Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+
+	if len(jobs) != 2 || jobs[0].ID != "first" || jobs[1].ID != "second" {
+		t.Fatalf("Неожиданный набор задач после воспроизведения журнала: %+v", jobs)
+	}
+	if jobs[0].Priority != 3 || jobs[1].Status != dto.StatusRunning {
+		t.Errorf("Состояние задач восстановлено неверно: %+v, %+v", jobs[0], jobs[1])
+	}
+}
+
+func TestQueueRecoveryPolicy(t *testing.T) {
+	tc, _ := newFakeTranscoder(t)
+
+	for _, policy := range []RecoveryPolicy{RecoveryRequeue, RecoveryFail} {
+		path := filepath.Join(t.TempDir(), "jobs.journal")
+		store, err := NewFileJobStore(path)
+		if err != nil {
+			t.Fatalf("Ошибка создания хранилища: %v", err)
+		}
+		store.Save(&dto.Job{ID: "interrupted", Status: dto.StatusRunning, Progress: 42})
+		store.Save(&dto.Job{ID: "done", Status: dto.StatusCompleted})
+
+		queue, err := NewQueueWithStore(tc, 1, store, policy)
+		if err != nil {
+			t.Fatalf("Ошибка создания очереди: %v", err)
+		}
+
+		job, _ := queue.GetJob("interrupted")
+		switch policy {
+		case RecoveryRequeue:
+			if job.Status != dto.StatusPending || job.Progress != 0 || queue.pending.Len() != 1 {
+				t.Errorf("Прерванная задача должна вернуться в очередь: %+v", job)
+			}
+		case RecoveryFail:
+			if job.Status != dto.StatusFailed || job.Error == nil || queue.pending.Len() != 0 {
+				t.Errorf("Прерванная задача должна быть помечена как failed: %+v", job)
+			}
+		}
+
+		if done, _ := queue.GetJob("done"); done.Status != dto.StatusCompleted {
+			t.Error("Завершенная задача должна сохранить статус")
+		}
+		store.Close()
+	}
+}
+
+func TestFileJobStoreCorruptLines(t *testing.T) {
+	valid := `{"op":"save","job":{"id":"first","status":0}}` + "\n"
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"недописанная последняя строка", valid + `{"op":"save","job":{"id":"sec`, false},
+		{"поврежденная строка в середине", `{"op":"save",` + "\n" + valid, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jobs.journal")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Ошибка записи журнала: %v", err)
+			}
+			store, err := NewFileJobStore(path)
+			if err != nil {
+				t.Fatalf("Ошибка открытия хранилища: %v", err)
+			}
+			defer store.Close()
+
+			jobs, err := store.Load()
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Ожидалась ошибка поврежденного журнала")
+				}
+				return
+			}
+			if err != nil || len(jobs) != 1 || jobs[0].ID != "first" {
+				t.Errorf("Ожидалась одна задача, получено %+v, ошибка %v", jobs, err)
+			}
+		})
+	}
+}
+
+func TestQueueDeletesFinishedJobsFromStore(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Stdout: "progress=end\n"})
+
+	path := filepath.Join(t.TempDir(), "jobs.journal")
+	store, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatalf("Ошибка создания хранилища: %v", err)
+	}
+	defer store.Close()
+
+	queue, err := NewQueueWithStore(tc, 1, store, RecoveryRequeue)
+	if err != nil {
+		t.Fatalf("Ошибка создания очереди: %v", err)
+	}
+	defer queue.Stop()
+
+	input := newTestInput(t)
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "out.mp4")})
+	queue.AddJob(job)
+	queue.Start()
+	waitForJobs(t, queue)
+
+	if done, _ := queue.GetJob(job.ID); done.Status != dto.StatusCompleted {
+		t.Fatalf("Ожидалась завершенная задача, статус %d", done.Status)
+	}
+
+	jobs, err := store.Load()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("Завершенная задача должна быть удалена из журнала: %+v", jobs)
+	}
+}
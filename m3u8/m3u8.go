@@ -0,0 +1,416 @@
+// Package m3u8 разбирает HLS плейлисты (RFC 8216)
+package m3u8
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotPlaylist содержимое не является M3U8 плейлистом
+var ErrNotPlaylist = errors.New("содержимое не является M3U8 плейлистом (нет #EXTM3U)")
+
+// MediaPlaylist медиаплейлист со списком сегментов
+type MediaPlaylist struct {
+	URL                   string
+	Version               int
+	TargetDuration        time.Duration
+	MediaSequence         int64
+	DiscontinuitySequence int64
+	PlaylistType          string // VOD, EVENT или пусто
+	IFramesOnly           bool
+	IndependentSegments   bool
+	EndList               bool
+	Segments              []Segment
+
+	// Low-Latency HLS
+	PartTargetDuration time.Duration     // EXT-X-PART-INF:PART-TARGET
+	ServerControl      *ServerControl    // EXT-X-SERVER-CONTROL
+	PendingParts       []PartialSegment  // Части сегмента, который еще не завершен (номер MediaSequence+len(Segments))
+	PreloadHints       []PreloadHint     // EXT-X-PRELOAD-HINT
+	RenditionReports   []RenditionReport // EXT-X-RENDITION-REPORT
+}
+
+// ServerControl возможности сервера из EXT-X-SERVER-CONTROL
+type ServerControl struct {
+	CanBlockReload    bool          // Поддерживаются блокирующие обновления (_HLS_msn/_HLS_part)
+	CanSkipUntil      time.Duration // Поддерживаются дельта-обновления (_HLS_skip)
+	CanSkipDateRanges bool
+	HoldBack          time.Duration // Минимальное отставание от конца плейлиста
+	PartHoldBack      time.Duration // Минимальное отставание при воспроизведении по частям
+}
+
+// PartialSegment частичный сегмент (EXT-X-PART)
+type PartialSegment struct {
+	URI         string // Абсолютный URL части
+	Duration    time.Duration
+	Independent bool       // Часть начинается с независимого кадра
+	Gap         bool       // Часть недоступна
+	ByteRange   *ByteRange // Диапазон байт внутри ресурса
+	Map         *Map       // Действующая секция инициализации
+	Key         *Key       // Действующий ключ шифрования
+}
+
+// Типы EXT-X-PRELOAD-HINT
+const (
+	HintPart = "PART"
+	HintMap  = "MAP"
+)
+
+// PreloadHint ресурс, который сервер отдаст следующим (EXT-X-PRELOAD-HINT)
+type PreloadHint struct {
+	Type            string // PART или MAP
+	URI             string
+	ByteRangeStart  int64
+	ByteRangeLength int64 // 0 - до конца ресурса
+}
+
+// RenditionReport состояние другого медиаплейлиста (EXT-X-RENDITION-REPORT)
+type RenditionReport struct {
+	URI      string
+	LastMSN  int64
+	LastPart int64 // -1 - не указан
+}
+
+// Segment медиасегмент
+type Segment struct {
+	URI             string           // Абсолютный URL сегмента
+	Duration        time.Duration    // Длительность из EXTINF
+	Title           string           // Название из EXTINF
+	Sequence        int64            // Порядковый номер (media sequence)
+	Discontinuity   bool             // Перед сегментом стоит EXT-X-DISCONTINUITY
+	ByteRange       *ByteRange       // Диапазон байт внутри ресурса (EXT-X-BYTERANGE)
+	Map             *Map             // Секция инициализации (EXT-X-MAP)
+	ProgramDateTime time.Time        // Время первого кадра (EXT-X-PROGRAM-DATE-TIME)
+	Key             *Key             // Ключ шифрования (nil - сегмент не зашифрован)
+	Parts           []PartialSegment // Части сегмента (LL-HLS), обычно только у последних сегментов
+}
+
+// ByteRange диапазон байт ресурса
+type ByteRange struct {
+	Length int64
+	Offset int64
+}
+
+// Header возвращает значение HTTP заголовка Range для диапазона
+func (r *ByteRange) Header() string {
+	return fmt.Sprintf("bytes=%d-%d", r.Offset, r.Offset+r.Length-1)
+}
+
+// Map секция инициализации медиа (например, init.mp4 для fMP4)
+type Map struct {
+	URI       string
+	ByteRange *ByteRange
+}
+
+// Методы шифрования EXT-X-KEY
+const (
+	KeyMethodNone      = "NONE"
+	KeyMethodAES128    = "AES-128"
+	KeyMethodSampleAES = "SAMPLE-AES"
+)
+
+// Key параметры шифрования из тега EXT-X-KEY
+type Key struct {
+	Method            string
+	URI               string // Абсолютный URL ключа
+	IV                string // Вектор инициализации в виде 0x..., пусто - номер сегмента
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+// IsIdentity сообщает, передается ли ключ как есть (KEYFORMAT="identity")
+func (k *Key) IsIdentity() bool {
+	return k.KeyFormat == "" || k.KeyFormat == "identity"
+}
+
+// IsLive сообщает, является ли плейлист живым: нет EXT-X-ENDLIST
+// и тип плейлиста не VOD
+func (p *MediaPlaylist) IsLive() bool {
+	return !p.EndList && p.PlaylistType != "VOD"
+}
+
+// TotalDuration возвращает суммарную длительность сегментов
+func (p *MediaPlaylist) TotalDuration() time.Duration {
+	var total time.Duration
+	for _, segment := range p.Segments {
+		total += segment.Duration
+	}
+	return total
+}
+
+// IsMaster сообщает, является ли содержимое мастер-плейлистом
+func IsMaster(content string) bool {
+	return strings.Contains(content, "#EXT-X-STREAM-INF") ||
+		strings.Contains(content, "#EXT-X-I-FRAME-STREAM-INF") ||
+		strings.Contains(content, "#EXT-X-MEDIA:")
+}
+
+// ParseMedia разбирает медиаплейлист. Относительные URI сегментов
+// разрешаются относительно baseURL.
+func ParseMedia(content, baseURL string) (*MediaPlaylist, error) {
+	playlist := &MediaPlaylist{URL: baseURL}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	headerSeen := false
+	var current Segment
+	var key *Key
+	var segmentMap *Map
+	hasInfo := false
+	// Конец предыдущего диапазона для EXT-X-BYTERANGE без смещения
+	var nextOffset int64
+	var nextPartOffset int64
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !headerSeen {
+			if line != "#EXTM3U" {
+				return nil, ErrNotPlaylist
+			}
+			headerSeen = true
+			continue
+		}
+
+		tag, value := splitTag(line)
+		switch tag {
+		case "#EXT-X-VERSION":
+			playlist.Version, _ = strconv.Atoi(value)
+		case "#EXT-X-TARGETDURATION":
+			playlist.TargetDuration = parseSeconds(value)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			playlist.MediaSequence, _ = strconv.ParseInt(value, 10, 64)
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			playlist.DiscontinuitySequence, _ = strconv.ParseInt(value, 10, 64)
+		case "#EXT-X-PLAYLIST-TYPE":
+			playlist.PlaylistType = value
+		case "#EXT-X-I-FRAMES-ONLY":
+			playlist.IFramesOnly = true
+		case "#EXT-X-INDEPENDENT-SEGMENTS":
+			playlist.IndependentSegments = true
+		case "#EXT-X-ENDLIST":
+			playlist.EndList = true
+		case "#EXT-X-KEY":
+			// Ключ действует на все последующие сегменты до следующего EXT-X-KEY
+			key = parseKey(value, baseURL)
+		case "#EXT-X-MAP":
+			// Секция инициализации действует до следующего EXT-X-MAP
+			attrs := ParseAttributes(value)
+			segmentMap = &Map{URI: ResolveURI(baseURL, attrs["URI"])}
+			if attrs["BYTERANGE"] != "" {
+				segmentMap.ByteRange = parseByteRange(attrs["BYTERANGE"], 0)
+			}
+		case "#EXT-X-DISCONTINUITY":
+			current.Discontinuity = true
+		case "#EXT-X-BYTERANGE":
+			current.ByteRange = parseByteRange(value, nextOffset)
+		case "#EXT-X-PROGRAM-DATE-TIME":
+			current.ProgramDateTime = parseDateTime(value)
+		case "#EXT-X-PART-INF":
+			playlist.PartTargetDuration = parseSeconds(ParseAttributes(value)["PART-TARGET"])
+		case "#EXT-X-SERVER-CONTROL":
+			playlist.ServerControl = parseServerControl(value)
+		case "#EXT-X-PART":
+			part := parsePart(value, baseURL, nextPartOffset)
+			part.Map, part.Key = segmentMap, key
+			if part.ByteRange != nil {
+				nextPartOffset = part.ByteRange.Offset + part.ByteRange.Length
+			}
+			current.Parts = append(current.Parts, part)
+		case "#EXT-X-PRELOAD-HINT":
+			attrs := ParseAttributes(value)
+			hint := PreloadHint{Type: attrs["TYPE"], URI: ResolveURI(baseURL, attrs["URI"])}
+			hint.ByteRangeStart, _ = strconv.ParseInt(attrs["BYTERANGE-START"], 10, 64)
+			hint.ByteRangeLength, _ = strconv.ParseInt(attrs["BYTERANGE-LENGTH"], 10, 64)
+			playlist.PreloadHints = append(playlist.PreloadHints, hint)
+		case "#EXT-X-RENDITION-REPORT":
+			attrs := ParseAttributes(value)
+			report := RenditionReport{URI: ResolveURI(baseURL, attrs["URI"]), LastPart: -1}
+			report.LastMSN, _ = strconv.ParseInt(attrs["LAST-MSN"], 10, 64)
+			if lastPart, err := strconv.ParseInt(attrs["LAST-PART"], 10, 64); err == nil {
+				report.LastPart = lastPart
+			}
+			playlist.RenditionReports = append(playlist.RenditionReports, report)
+		case "#EXTINF":
+			duration, title, _ := strings.Cut(value, ",")
+			current.Duration = parseSeconds(duration)
+			current.Title = strings.TrimSpace(title)
+			hasInfo = true
+		default:
+			if strings.HasPrefix(line, "#") {
+				// Комментарии и неподдерживаемые теги пропускаются
+				continue
+			}
+
+			if !hasInfo {
+				// URI без EXTINF недопустим в медиаплейлисте
+				continue
+			}
+
+			current.URI = ResolveURI(baseURL, line)
+			current.Sequence = playlist.MediaSequence + int64(len(playlist.Segments))
+			current.Key = key
+			current.Map = segmentMap
+			if current.ByteRange != nil {
+				nextOffset = current.ByteRange.Offset + current.ByteRange.Length
+			}
+			playlist.Segments = append(playlist.Segments, current)
+			current = Segment{}
+			hasInfo = false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !headerSeen {
+		return nil, ErrNotPlaylist
+	}
+
+	// Части после последнего сегмента относятся к сегменту, который еще формируется
+	playlist.PendingParts = current.Parts
+
+	return playlist, nil
+}
+
+// parseServerControl разбирает атрибуты EXT-X-SERVER-CONTROL
+func parseServerControl(value string) *ServerControl {
+	attrs := ParseAttributes(value)
+	return &ServerControl{
+		CanBlockReload:    attrs["CAN-BLOCK-RELOAD"] == "YES",
+		CanSkipUntil:      parseSeconds(attrs["CAN-SKIP-UNTIL"]),
+		CanSkipDateRanges: attrs["CAN-SKIP-DATERANGES"] == "YES",
+		HoldBack:          parseSeconds(attrs["HOLD-BACK"]),
+		PartHoldBack:      parseSeconds(attrs["PART-HOLD-BACK"]),
+	}
+}
+
+// parsePart разбирает атрибуты EXT-X-PART. BYTERANGE без смещения
+// продолжает предыдущую часть.
+func parsePart(value, baseURL string, nextOffset int64) PartialSegment {
+	attrs := ParseAttributes(value)
+
+	part := PartialSegment{
+		URI:         ResolveURI(baseURL, attrs["URI"]),
+		Duration:    parseSeconds(attrs["DURATION"]),
+		Independent: attrs["INDEPENDENT"] == "YES",
+		Gap:         attrs["GAP"] == "YES",
+	}
+	if attrs["BYTERANGE"] != "" {
+		part.ByteRange = parseByteRange(attrs["BYTERANGE"], nextOffset)
+	}
+	return part
+}
+
+// parseByteRange разбирает диапазон вида n[@o]. Без смещения диапазон
+// начинается с defaultOffset (сразу после предыдущего).
+func parseByteRange(value string, defaultOffset int64) *ByteRange {
+	length, offset, hasOffset := strings.Cut(value, "@")
+
+	byteRange := &ByteRange{Offset: defaultOffset}
+	byteRange.Length, _ = strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+	if hasOffset {
+		byteRange.Offset, _ = strconv.ParseInt(strings.TrimSpace(offset), 10, 64)
+	}
+	return byteRange
+}
+
+// parseDateTime разбирает дату в формате ISO 8601 (RFC 3339 с долями секунды)
+func parseDateTime(value string) time.Time {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
+
+// parseKey разбирает атрибуты EXT-X-KEY. Для METHOD=NONE возвращает nil.
+func parseKey(value, baseURL string) *Key {
+	attrs := ParseAttributes(value)
+	if attrs["METHOD"] == "" || attrs["METHOD"] == KeyMethodNone {
+		return nil
+	}
+
+	key := &Key{
+		Method:            attrs["METHOD"],
+		IV:                attrs["IV"],
+		KeyFormat:         attrs["KEYFORMAT"],
+		KeyFormatVersions: attrs["KEYFORMATVERSIONS"],
+	}
+	if uri := attrs["URI"]; uri != "" {
+		key.URI = ResolveURI(baseURL, uri)
+	}
+	return key
+}
+
+// ParseAttributes разбирает список атрибутов вида KEY=VALUE,KEY="VALUE".
+// Кавычки у строковых значений удаляются.
+func ParseAttributes(value string) map[string]string {
+	attrs := make(map[string]string)
+
+	for len(value) > 0 {
+		name, rest, found := strings.Cut(value, "=")
+		if !found {
+			break
+		}
+		name = strings.TrimSpace(name)
+
+		var attr string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end < 0 {
+				attr, rest = rest[1:], ""
+			} else {
+				attr, rest = rest[1:end+1], rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			attr, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attrs[name] = strings.TrimSpace(attr)
+		value = rest
+	}
+
+	return attrs
+}
+
+// splitTag разделяет строку тега на имя и значение после двоеточия
+func splitTag(line string) (tag, value string) {
+	tag, value, _ = strings.Cut(line, ":")
+	return tag, strings.TrimSpace(value)
+}
+
+// parseSeconds преобразует дробное число секунд в time.Duration
+func parseSeconds(value string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// ResolveURI разрешает URI относительно URL плейлиста
+func ResolveURI(baseURL, uri string) string {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return uri
+	}
+
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	return base.ResolveReference(ref).String()
+}
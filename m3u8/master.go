@@ -0,0 +1,224 @@
+package m3u8
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+)
+
+// Типы альтернативных представлений EXT-X-MEDIA
+const (
+	RenditionAudio          = "AUDIO"
+	RenditionVideo          = "VIDEO"
+	RenditionSubtitles      = "SUBTITLES"
+	RenditionClosedCaptions = "CLOSED-CAPTIONS"
+)
+
+// MasterPlaylist мастер-плейлист со списком вариантов и альтернативных представлений
+type MasterPlaylist struct {
+	URL                 string
+	Version             int
+	IndependentSegments bool
+	Variants            []Variant     // EXT-X-STREAM-INF
+	IFrameVariants      []Variant     // EXT-X-I-FRAME-STREAM-INF
+	Renditions          []Rendition   // EXT-X-MEDIA
+	SessionData         []SessionData // EXT-X-SESSION-DATA
+	SessionKeys         []Key         // EXT-X-SESSION-KEY
+}
+
+// Variant вариант потока из EXT-X-STREAM-INF или EXT-X-I-FRAME-STREAM-INF
+type Variant struct {
+	URI              string // Абсолютный URL медиаплейлиста
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	Resolution       string // Разрешение в виде WIDTHxHEIGHT
+	Width            int
+	Height           int
+	FrameRate        float64
+	HDCPLevel        string // TYPE-0, TYPE-1 или NONE
+	VideoRange       string // SDR, HLG или PQ
+	Audio            string // GROUP-ID аудио представлений
+	Video            string // GROUP-ID видео представлений
+	Subtitles        string // GROUP-ID субтитров
+	ClosedCaptions   string // GROUP-ID скрытых субтитров или NONE
+	IFrame           bool   // Вариант из EXT-X-I-FRAME-STREAM-INF
+}
+
+// Rendition альтернативное представление из EXT-X-MEDIA
+type Rendition struct {
+	Type            string // AUDIO, VIDEO, SUBTITLES или CLOSED-CAPTIONS
+	GroupID         string
+	Name            string
+	Language        string
+	AssocLanguage   string
+	URI             string // Абсолютный URL медиаплейлиста (пусто - входит в вариант)
+	Default         bool
+	AutoSelect      bool
+	Forced          bool
+	InstreamID      string // CC1..CC4 или SERVICE1..SERVICE63 для CLOSED-CAPTIONS
+	Characteristics string
+	Channels        string
+}
+
+// SessionData произвольные данные сессии из EXT-X-SESSION-DATA
+type SessionData struct {
+	DataID   string
+	Value    string
+	URI      string
+	Language string
+}
+
+// Group возвращает представления указанного типа из группы
+func (p *MasterPlaylist) Group(renditionType, groupID string) []Rendition {
+	var group []Rendition
+	for _, rendition := range p.Renditions {
+		if rendition.Type == renditionType && rendition.GroupID == groupID {
+			group = append(group, rendition)
+		}
+	}
+	return group
+}
+
+// Parse разбирает плейлист любого типа. Возвращается либо мастер-,
+// либо медиаплейлист, второй результат равен nil.
+func Parse(content, baseURL string) (*MasterPlaylist, *MediaPlaylist, error) {
+	if IsMaster(content) {
+		master, err := ParseMaster(content, baseURL)
+		return master, nil, err
+	}
+
+	media, err := ParseMedia(content, baseURL)
+	return nil, media, err
+}
+
+// ParseMaster разбирает мастер-плейлист. URI вариантов и представлений
+// разрешаются относительно baseURL.
+func ParseMaster(content, baseURL string) (*MasterPlaylist, error) {
+	playlist := &MasterPlaylist{URL: baseURL}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	headerSeen := false
+	var pending *Variant
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !headerSeen {
+			if line != "#EXTM3U" {
+				return nil, ErrNotPlaylist
+			}
+			headerSeen = true
+			continue
+		}
+
+		tag, value := splitTag(line)
+		switch tag {
+		case "#EXT-X-VERSION":
+			playlist.Version, _ = strconv.Atoi(value)
+		case "#EXT-X-INDEPENDENT-SEGMENTS":
+			playlist.IndependentSegments = true
+		case "#EXT-X-STREAM-INF":
+			// URI варианта должен следовать за тегом: предыдущий вариант без URI отбрасывается
+			variant := parseVariant(ParseAttributes(value), baseURL)
+			pending = &variant
+		case "#EXT-X-I-FRAME-STREAM-INF":
+			variant := parseVariant(ParseAttributes(value), baseURL)
+			variant.IFrame = true
+			playlist.IFrameVariants = append(playlist.IFrameVariants, variant)
+		case "#EXT-X-MEDIA":
+			playlist.Renditions = append(playlist.Renditions, parseRendition(ParseAttributes(value), baseURL))
+		case "#EXT-X-SESSION-DATA":
+			attrs := ParseAttributes(value)
+			data := SessionData{
+				DataID:   attrs["DATA-ID"],
+				Value:    attrs["VALUE"],
+				Language: attrs["LANGUAGE"],
+			}
+			if attrs["URI"] != "" {
+				data.URI = ResolveURI(baseURL, attrs["URI"])
+			}
+			playlist.SessionData = append(playlist.SessionData, data)
+		case "#EXT-X-SESSION-KEY":
+			if key := parseKey(value, baseURL); key != nil {
+				playlist.SessionKeys = append(playlist.SessionKeys, *key)
+			}
+		default:
+			if strings.HasPrefix(line, "#") || pending == nil {
+				// Комментарии, неподдерживаемые теги и URI без EXT-X-STREAM-INF пропускаются
+				continue
+			}
+
+			pending.URI = ResolveURI(baseURL, line)
+			playlist.Variants = append(playlist.Variants, *pending)
+			pending = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !headerSeen {
+		return nil, ErrNotPlaylist
+	}
+
+	return playlist, nil
+}
+
+// parseVariant заполняет вариант из атрибутов EXT-X-STREAM-INF
+func parseVariant(attrs map[string]string, baseURL string) Variant {
+	variant := Variant{
+		Codecs:         attrs["CODECS"],
+		Resolution:     attrs["RESOLUTION"],
+		HDCPLevel:      attrs["HDCP-LEVEL"],
+		VideoRange:     attrs["VIDEO-RANGE"],
+		Audio:          attrs["AUDIO"],
+		Video:          attrs["VIDEO"],
+		Subtitles:      attrs["SUBTITLES"],
+		ClosedCaptions: attrs["CLOSED-CAPTIONS"],
+	}
+
+	variant.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+	variant.AverageBandwidth, _ = strconv.ParseInt(attrs["AVERAGE-BANDWIDTH"], 10, 64)
+	variant.FrameRate, _ = strconv.ParseFloat(attrs["FRAME-RATE"], 64)
+
+	if width, height, found := strings.Cut(variant.Resolution, "x"); found {
+		variant.Width, _ = strconv.Atoi(width)
+		variant.Height, _ = strconv.Atoi(height)
+	}
+
+	// У I-frame вариантов URI задается атрибутом
+	if attrs["URI"] != "" {
+		variant.URI = ResolveURI(baseURL, attrs["URI"])
+	}
+
+	return variant
+}
+
+// parseRendition заполняет представление из атрибутов EXT-X-MEDIA
+func parseRendition(attrs map[string]string, baseURL string) Rendition {
+	rendition := Rendition{
+		Type:            attrs["TYPE"],
+		GroupID:         attrs["GROUP-ID"],
+		Name:            attrs["NAME"],
+		Language:        attrs["LANGUAGE"],
+		AssocLanguage:   attrs["ASSOC-LANGUAGE"],
+		Default:         attrs["DEFAULT"] == "YES",
+		AutoSelect:      attrs["AUTOSELECT"] == "YES",
+		Forced:          attrs["FORCED"] == "YES",
+		InstreamID:      attrs["INSTREAM-ID"],
+		Characteristics: attrs["CHARACTERISTICS"],
+		Channels:        attrs["CHANNELS"],
+	}
+
+	if attrs["URI"] != "" {
+		rendition.URI = ResolveURI(baseURL, attrs["URI"])
+	}
+
+	return rendition
+}
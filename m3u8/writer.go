@@ -0,0 +1,115 @@
+package m3u8
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// attributeList собирает список атрибутов тега в порядке добавления
+type attributeList []string
+
+// add добавляет атрибут без кавычек, пустые значения пропускаются
+func (a *attributeList) add(name, value string) {
+	if value != "" {
+		*a = append(*a, name+"="+value)
+	}
+}
+
+// quoted добавляет строковый атрибут в кавычках, пустые значения пропускаются
+func (a *attributeList) quoted(name, value string) {
+	if value != "" {
+		*a = append(*a, name+"=\""+value+"\"")
+	}
+}
+
+// flag добавляет атрибут YES, если значение истинно
+func (a *attributeList) flag(name string, value bool) {
+	if value {
+		*a = append(*a, name+"=YES")
+	}
+}
+
+func (a attributeList) String() string {
+	return strings.Join(a, ",")
+}
+
+// WriteTo записывает мастер-плейлист в формате M3U8. URI вариантов
+// и представлений записываются как есть (обычно относительно мастер-плейлиста).
+func (p *MasterPlaylist) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+
+	b.WriteString("#EXTM3U\n")
+	if p.Version > 0 {
+		fmt.Fprintf(&b, "#EXT-X-VERSION:%d\n", p.Version)
+	}
+	if p.IndependentSegments {
+		b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	}
+
+	for _, data := range p.SessionData {
+		var attrs attributeList
+		attrs.quoted("DATA-ID", data.DataID)
+		attrs.quoted("VALUE", data.Value)
+		attrs.quoted("URI", data.URI)
+		attrs.quoted("LANGUAGE", data.Language)
+		fmt.Fprintf(&b, "#EXT-X-SESSION-DATA:%s\n", attrs)
+	}
+
+	for _, rendition := range p.Renditions {
+		var attrs attributeList
+		attrs.add("TYPE", rendition.Type)
+		attrs.quoted("GROUP-ID", rendition.GroupID)
+		attrs.quoted("NAME", rendition.Name)
+		attrs.quoted("LANGUAGE", rendition.Language)
+		attrs.quoted("ASSOC-LANGUAGE", rendition.AssocLanguage)
+		attrs.flag("DEFAULT", rendition.Default)
+		attrs.flag("AUTOSELECT", rendition.AutoSelect)
+		attrs.flag("FORCED", rendition.Forced)
+		attrs.quoted("INSTREAM-ID", rendition.InstreamID)
+		attrs.quoted("CHARACTERISTICS", rendition.Characteristics)
+		attrs.quoted("CHANNELS", rendition.Channels)
+		attrs.quoted("URI", rendition.URI)
+		fmt.Fprintf(&b, "#EXT-X-MEDIA:%s\n", attrs)
+	}
+
+	for _, variant := range p.Variants {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:%s\n%s\n", variantAttributes(variant), variant.URI)
+	}
+
+	for _, variant := range p.IFrameVariants {
+		attrs := variantAttributes(variant)
+		attrs.quoted("URI", variant.URI)
+		fmt.Fprintf(&b, "#EXT-X-I-FRAME-STREAM-INF:%s\n", attrs)
+	}
+
+	n, err := w.Write(b.Bytes())
+	return int64(n), err
+}
+
+// variantAttributes возвращает атрибуты EXT-X-STREAM-INF варианта
+func variantAttributes(variant Variant) attributeList {
+	var attrs attributeList
+	attrs.add("BANDWIDTH", strconv.FormatInt(variant.Bandwidth, 10))
+	if variant.AverageBandwidth > 0 {
+		attrs.add("AVERAGE-BANDWIDTH", strconv.FormatInt(variant.AverageBandwidth, 10))
+	}
+	attrs.quoted("CODECS", variant.Codecs)
+	attrs.add("RESOLUTION", variant.Resolution)
+	if variant.FrameRate > 0 {
+		attrs.add("FRAME-RATE", strconv.FormatFloat(variant.FrameRate, 'f', 3, 64))
+	}
+	attrs.add("HDCP-LEVEL", variant.HDCPLevel)
+	attrs.add("VIDEO-RANGE", variant.VideoRange)
+	attrs.quoted("AUDIO", variant.Audio)
+	attrs.quoted("VIDEO", variant.Video)
+	attrs.quoted("SUBTITLES", variant.Subtitles)
+	if variant.ClosedCaptions == "NONE" {
+		attrs.add("CLOSED-CAPTIONS", variant.ClosedCaptions)
+	} else {
+		attrs.quoted("CLOSED-CAPTIONS", variant.ClosedCaptions)
+	}
+	return attrs
+}
@@ -1,12 +1,14 @@
 package transcoder
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
 )
 
 // MediaInfo структурированная информация о медиафайле
@@ -52,15 +54,13 @@ type StreamInfo struct {
 func (t *Transcoder) GetMediaInfo(filePath string) (*MediaInfo, error) {
 	t.logger.Debug("Получение информации о файле: %s", filePath)
 
-	cmd := exec.Command("ffprobe",
+	output, err := runner.Output(context.Background(), t.runner, t.ffprobePath,
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
 		filePath,
 	)
-
-	output, err := cmd.Output()
 	if err != nil {
 		t.logger.Error("Ошибка выполнения ffprobe: %v", err)
 		return nil, fmt.Errorf("ошибка получения информации о файле: %w", err)
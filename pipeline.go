@@ -24,6 +24,7 @@ type Pipeline struct {
 	steps       []PipelineStep
 	tempDir     string
 	transcoder  *Transcoder
+	retry       RetryPolicy
 }
 
 // NewPipeline создает новый конвейер
@@ -46,6 +47,12 @@ func (p *Pipeline) AddStep(step PipelineStep) *Pipeline {
 	return p
 }
 
+// SetRetryPolicy устанавливает политику повторов для шагов конвейера
+func (p *Pipeline) SetRetryPolicy(policy RetryPolicy) *Pipeline {
+	p.retry = policy
+	return p
+}
+
 // Execute выполняет весь конвейер
 func (p *Pipeline) Execute(ctx context.Context, inputPath, outputPath string) error {
 	p.transcoder.logger.Info("Запуск конвейера '%s': %s -> %s", p.name, inputPath, outputPath)
@@ -65,7 +72,7 @@ func (p *Pipeline) Execute(ctx context.Context, inputPath, outputPath string) er
 
 		if i == len(p.steps)-1 {
 			// Последний шаг - используем финальный путь
-			nextPath, err = step.Execute(ctx, currentPath, p.transcoder)
+			nextPath, err = p.executeStep(ctx, step, currentPath)
 			if err != nil {
 				return fmt.Errorf("ошибка на шаге '%s': %w", step.GetName(), err)
 			}
@@ -78,7 +85,7 @@ func (p *Pipeline) Execute(ctx context.Context, inputPath, outputPath string) er
 			}
 		} else {
 			// Промежуточный шаг
-			nextPath, err = step.Execute(ctx, currentPath, p.transcoder)
+			nextPath, err = p.executeStep(ctx, step, currentPath)
 			if err != nil {
 				return fmt.Errorf("ошибка на шаге '%s': %w", step.GetName(), err)
 			}
@@ -91,6 +98,24 @@ func (p *Pipeline) Execute(ctx context.Context, inputPath, outputPath string) er
 	return nil
 }
 
+// executeStep выполняет шаг с повторами согласно политике конвейера
+func (p *Pipeline) executeStep(ctx context.Context, step PipelineStep, inputPath string) (string, error) {
+	for attempt := 1; ; attempt++ {
+		outputPath, err := step.Execute(ctx, inputPath, p.transcoder)
+		if err == nil || !p.retry.ShouldRetry(attempt, err) {
+			return outputPath, err
+		}
+
+		delay := p.retry.Backoff(attempt)
+		p.transcoder.logger.Warn("Попытка %d шага '%s' не удалась, повтор через %v: %v",
+			attempt, step.GetName(), delay, err)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return "", err
+		}
+	}
+}
+
 // GetSteps возвращает список шагов
 func (p *Pipeline) GetSteps() []PipelineStep {
 	return p.steps
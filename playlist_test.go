@@ -0,0 +1,192 @@
+package transcoder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+const testMasterPlaylist = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SESSION-DATA:DATA-ID="com.example.title",VALUE="Фильм, часть 1",LANGUAGE="ru"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Русский",LANGUAGE="ru",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="2",URI="audio/ru.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",URI="audio/en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",FORCED=NO,URI="subs/en.m3u8"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="CC1",INSTREAM-ID="CC1"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,AVERAGE-BANDWIDTH=700000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2",AUDIO="aac",SUBTITLES="subs",CLOSED-CAPTIONS="cc"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1200000,RESOLUTION=854x480
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,FRAME-RATE=29.970,HDCP-LEVEL=TYPE-0,VIDEO-RANGE=PQ,AUDIO="aac"
+# комментарий между тегом и URI
+hi/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=90000,RESOLUTION=640x360,URI="low/iframe.m3u8"
+`
+
+const testMediaPlaylist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+#EXT-X-PROGRAM-DATE-TIME:2024-05-01T10:00:00.500Z
+#EXTINF:6.006,
+#EXT-X-BYTERANGE:1000@720
+media.mp4
+#EXTINF:5.5,
+#EXT-X-BYTERANGE:2000
+media.mp4
+#EXT-X-DISCONTINUITY
+#EXTINF:4,Реклама
+ad.ts
+`
+
+func TestParseMasterPlaylist(t *testing.T) {
+	info, err := utils.ParsePlaylist(testMasterPlaylist, "https://cdn.example.com/show/master.m3u8")
+	if err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+
+	master := info.Master
+	if master == nil || info.Media != nil {
+		t.Fatal("Ожидался мастер-плейлист")
+	}
+
+	// Вариант без URI (854x480) отбрасывается, комментарий не мешает следующему
+	if len(info.Streams) != 2 {
+		t.Fatalf("Ожидалось 2 варианта, получено %d", len(info.Streams))
+	}
+	hi := master.Variants[1]
+	if hi.URI != "https://cdn.example.com/show/hi/index.m3u8" || hi.Height != 1080 ||
+		hi.HDCPLevel != "TYPE-0" || hi.VideoRange != "PQ" || hi.FrameRate != 29.97 {
+		t.Errorf("Вариант разобран неверно: %+v", hi)
+	}
+	if low := info.Streams[0]; low.AverageBandwidth != 700000 || low.Codecs != "avc1.4d401e,mp4a.40.2" ||
+		low.Subtitles != "subs" || low.ClosedCaptions != "cc" {
+		t.Errorf("StreamInfo заполнен неверно: %+v", low)
+	}
+
+	audio := master.Group(m3u8.RenditionAudio, "aac")
+	if len(audio) != 2 || !audio[0].Default || audio[0].Language != "ru" ||
+		audio[1].URI != "https://cdn.example.com/show/audio/en.m3u8" {
+		t.Errorf("Аудио группа разобрана неверно: %+v", audio)
+	}
+	if cc := master.Group(m3u8.RenditionClosedCaptions, "cc"); len(cc) != 1 || cc[0].InstreamID != "CC1" || cc[0].URI != "" {
+		t.Errorf("Скрытые субтитры разобраны неверно: %+v", cc)
+	}
+
+	if len(master.IFrameVariants) != 1 || master.IFrameVariants[0].URI != "https://cdn.example.com/show/low/iframe.m3u8" {
+		t.Errorf("I-frame варианты разобраны неверно: %+v", master.IFrameVariants)
+	}
+	if len(master.SessionData) != 1 || master.SessionData[0].Value != "Фильм, часть 1" {
+		t.Errorf("Данные сессии разобраны неверно: %+v", master.SessionData)
+	}
+	if info.IsLive || !master.IndependentSegments {
+		t.Error("Мастер-плейлист не должен считаться live")
+	}
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	info, err := utils.ParsePlaylist(testMediaPlaylist, "https://cdn.example.com/vod/index.m3u8")
+	if err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+
+	media := info.Media
+	if media == nil || info.Master != nil {
+		t.Fatal("Ожидался медиаплейлист")
+	}
+	if info.IsLive {
+		t.Error("VOD плейлист без ENDLIST не должен считаться live")
+	}
+	if media.DiscontinuitySequence != 3 || len(media.Segments) != 3 {
+		t.Fatalf("Плейлист разобран неверно: %+v", media)
+	}
+
+	first, second, third := media.Segments[0], media.Segments[1], media.Segments[2]
+	if first.Sequence != 100 || first.Duration != 6006*time.Millisecond {
+		t.Errorf("Первый сегмент разобран неверно: %+v", first)
+	}
+	if first.Map == nil || first.Map.URI != "https://cdn.example.com/vod/init.mp4" || *first.Map.ByteRange != (m3u8.ByteRange{Length: 720}) {
+		t.Errorf("EXT-X-MAP разобран неверно: %+v", first.Map)
+	}
+	if want := time.Date(2024, 5, 1, 10, 0, 0, 500e6, time.UTC); !first.ProgramDateTime.Equal(want) {
+		t.Errorf("PROGRAM-DATE-TIME разобран неверно: %v", first.ProgramDateTime)
+	}
+
+	// Диапазон без смещения продолжает предыдущий
+	if *second.ByteRange != (m3u8.ByteRange{Length: 2000, Offset: 1720}) || second.ByteRange.Header() != "bytes=1720-3719" {
+		t.Errorf("EXT-X-BYTERANGE разобран неверно: %+v", second.ByteRange)
+	}
+	if second.Discontinuity || !third.Discontinuity || third.Title != "Реклама" || third.ByteRange != nil {
+		t.Errorf("EXT-X-DISCONTINUITY разобран неверно: %+v", third)
+	}
+	if info.Duration != "15.506s" {
+		t.Errorf("Неверная длительность: %s", info.Duration)
+	}
+}
+
+func TestParsePlaylistRejectsGarbage(t *testing.T) {
+	if _, err := utils.ParsePlaylist("<html></html>", "https://example.com/"); err == nil {
+		t.Error("Ожидалась ошибка для содержимого без #EXTM3U")
+	}
+}
+
+const testLowLatencyPlaylist = `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=1.0,CAN-SKIP-UNTIL=24.0
+#EXT-X-PART-INF:PART-TARGET=0.5
+#EXT-X-MEDIA-SEQUENCE:271
+#EXTINF:4.0,
+seg271.mp4
+#EXT-X-PART:DURATION=0.5,URI="seg272.mp4",BYTERANGE="1000@0",INDEPENDENT=YES
+#EXT-X-PART:DURATION=0.5,URI="seg272.mp4",BYTERANGE="1200"
+#EXTINF:1.0,
+seg272.mp4
+#EXT-X-PART:DURATION=0.5,URI="part273.0.mp4",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part273.1.mp4"
+#EXT-X-RENDITION-REPORT:URI="../audio/index.m3u8",LAST-MSN=273,LAST-PART=0
+`
+
+func TestParseLowLatencyPlaylist(t *testing.T) {
+	media, err := m3u8.ParseMedia(testLowLatencyPlaylist, "https://cdn.example.com/live/video/index.m3u8")
+	if err != nil {
+		t.Fatalf("Ошибка разбора: %v", err)
+	}
+
+	control := media.ServerControl
+	if control == nil || !control.CanBlockReload || control.PartHoldBack != time.Second || control.CanSkipUntil != 24*time.Second {
+		t.Errorf("EXT-X-SERVER-CONTROL разобран неверно: %+v", control)
+	}
+	if media.PartTargetDuration != 500*time.Millisecond || len(media.Segments) != 2 {
+		t.Fatalf("Плейлист разобран неверно: %+v", media)
+	}
+
+	if parts := media.Segments[0].Parts; len(parts) != 0 {
+		t.Errorf("У первого сегмента не должно быть частей: %+v", parts)
+	}
+	parts := media.Segments[1].Parts
+	if len(parts) != 2 || !parts[0].Independent || parts[1].Independent {
+		t.Fatalf("Части сегмента разобраны неверно: %+v", parts)
+	}
+	// BYTERANGE без смещения продолжает предыдущую часть
+	if *parts[1].ByteRange != (m3u8.ByteRange{Length: 1200, Offset: 1000}) {
+		t.Errorf("BYTERANGE части разобран неверно: %+v", parts[1].ByteRange)
+	}
+
+	pending := media.PendingParts
+	if len(pending) != 1 || pending[0].URI != "https://cdn.example.com/live/video/part273.0.mp4" {
+		t.Errorf("Незавершенный сегмент разобран неверно: %+v", pending)
+	}
+	if hints := media.PreloadHints; len(hints) != 1 || hints[0].Type != m3u8.HintPart || hints[0].URI != "https://cdn.example.com/live/video/part273.1.mp4" {
+		t.Errorf("EXT-X-PRELOAD-HINT разобран неверно: %+v", hints)
+	}
+	want := m3u8.RenditionReport{URI: "https://cdn.example.com/live/audio/index.m3u8", LastMSN: 273, LastPart: 0}
+	if reports := media.RenditionReports; len(reports) != 1 || reports[0] != want {
+		t.Errorf("EXT-X-RENDITION-REPORT разобран неверно: %+v", reports)
+	}
+}
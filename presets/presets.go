@@ -318,3 +318,13 @@ func GetPresetsByCategory() map[string][]dto.Preset {
 		},
 	}
 }
+
+// Ladder собирает лестницу качеств для упаковки в HLS/DASH из пресетов,
+// например Ladder(WebHD, WebSD, Mobile)
+func Ladder(presets ...dto.Preset) []dto.Config {
+	renditions := make([]dto.Config, 0, len(presets))
+	for _, preset := range presets {
+		renditions = append(renditions, preset.Config)
+	}
+	return renditions
+}
@@ -1,8 +1,10 @@
 package transcoder
 
 import (
+	"bytes"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +20,10 @@ type ProgressTracker struct {
 	frameRegex  *regexp.Regexp
 	timeRegex   *regexp.Regexp
 	speedRegex  *regexp.Regexp
+
+	// Последние значения из вывода `-progress`
+	current time.Duration
+	speed   string
 }
 
 // NewProgressTracker создает новый трекер прогресса
@@ -84,3 +90,83 @@ func (pt *ProgressTracker) ParseFFmpegOutput(line string) {
 func (pt *ProgressTracker) SetDuration(duration time.Duration) {
 	pt.duration = duration
 }
+
+// ParseProgressLine обрабатывает строку машиночитаемого вывода `-progress`
+// (пары key=value). Колбэк вызывается в конце каждого блока (ключ progress).
+func (pt *ProgressTracker) ParseProgressLine(line string) {
+	key, value, found := strings.Cut(strings.TrimSpace(line), "=")
+	if !found {
+		return
+	}
+
+	switch key {
+	case "out_time_us", "out_time_ms":
+		// out_time_ms в FFmpeg исторически тоже содержит микросекунды
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			pt.current = time.Duration(us) * time.Microsecond
+		}
+	case "speed":
+		pt.speed = strings.TrimSpace(value)
+	case "progress":
+		pt.report(value == "end")
+	}
+}
+
+// report вычисляет прогресс и ETA по последним полученным значениям
+func (pt *ProgressTracker) report(finished bool) {
+	if pt.callback == nil {
+		return
+	}
+
+	var progress float64
+	var eta time.Duration
+
+	if pt.duration > 0 {
+		progress = float64(pt.current) / float64(pt.duration) * 100
+		if progress > 100 {
+			progress = 100
+		}
+
+		// ETA считаем по оставшемуся медиа-времени и текущей скорости обработки
+		speedFloat, err := strconv.ParseFloat(strings.TrimSuffix(pt.speed, "x"), 64)
+		if err == nil && speedFloat > 0 && pt.current < pt.duration {
+			eta = time.Duration(float64(pt.duration-pt.current) / speedFloat)
+		}
+	}
+
+	if finished {
+		progress = 100
+		eta = 0
+	}
+
+	speed := pt.speed
+	if speed == "N/A" {
+		speed = ""
+	}
+
+	pt.callback(progress, speed, eta)
+}
+
+// lineWriter io.Writer, вызывающий функцию для каждой полной строки вывода
+type lineWriter struct {
+	onLine  func(line string)
+	partial []byte
+}
+
+// newLineWriter создает writer, разбивающий поток на строки
+func newLineWriter(onLine func(line string)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.onLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
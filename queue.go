@@ -1,8 +1,13 @@
 package transcoder
 
 import (
+	"container/heap"
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/Mirsadikovv/ffmpeg_research/dto"
 )
@@ -10,32 +15,235 @@ import (
 // Queue управляет очередью задач транскодирования
 type Queue struct {
 	transcoder *Transcoder
-	jobs       []*dto.Job
+	jobs       []*dto.Job          // Реестр всех задач в порядке добавления
+	index      map[string]*dto.Job // Быстрый поиск задачи по ID
+	pending    jobHeap             // Ожидающие задачи по приоритету
+	seq        uint64              // Счетчик для FIFO при равных приоритетах
 	workers    int
+	store      JobStore                      // Постоянное хранилище (nil = только в памяти)
+	retry      RetryPolicy                   // Политика повторов (по умолчанию без повторов)
+	events     []Event                       // События, ожидающие публикации после снятия блокировки
+	after      []func()                      // Действия, выполняемые после публикации events
+	closed     bool                          // Очередь не принимает и не запускает новые задачи
+	running    sync.WaitGroup                // Выполняемые в данный момент задачи
+	cancels    map[string]context.CancelFunc // Отмена выполняемых задач по ID
 	mu         sync.RWMutex
+	cond       *sync.Cond
 	ctx        context.Context
 	cancel     context.CancelFunc
 }
 
+// Ошибки управления задачами очереди
+var (
+	ErrJobNotFound  = errors.New("задача не найдена в очереди")
+	ErrJobNotActive = errors.New("задача не находится в подходящем статусе")
+	ErrQueueClosed  = errors.New("очередь закрыта и не принимает новые задачи")
+)
+
+// ShutdownSummary итог корректной остановки очереди (ID задач)
+type ShutdownSummary struct {
+	Completed   []string // Задачи, успешно завершенные во время остановки
+	Failed      []string // Задачи, завершившиеся ошибкой во время остановки
+	Interrupted []string // Задачи, прерванные по истечении срока (частичные файлы удалены)
+	Pending     []string // Задачи, оставшиеся в очереди
+}
+
 // NewQueue создает новую очередь
 func NewQueue(transcoder *Transcoder, workers int) *Queue {
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Queue{
+	q := &Queue{
 		transcoder: transcoder,
 		jobs:       make([]*dto.Job, 0),
+		index:      make(map[string]*dto.Job),
+		cancels:    make(map[string]context.CancelFunc),
 		workers:    workers,
 		ctx:        ctx,
 		cancel:     cancel,
 	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// NewQueueWithStore создает очередь, сохраняющую незавершенные задачи в store.
+// Задачи из хранилища восстанавливаются: ожидающие возвращаются в очередь,
+// а прерванные перезапуском обрабатываются согласно policy. Завершенные
+// задачи удаляются из хранилища.
+func NewQueueWithStore(transcoder *Transcoder, workers int, store JobStore, policy RecoveryPolicy) (*Queue, error) {
+	jobs, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки задач из хранилища: %w", err)
+	}
+
+	q := NewQueue(transcoder, workers)
+	q.store = store
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, job := range jobs {
+		switch {
+		case job.Status == dto.StatusRunning || job.Status == dto.StatusPaused:
+			q.recoverInterrupted(job, policy)
+		case isTerminal(job.Status):
+			// Завершенные задачи из журнала прежних версий
+			q.persist(job)
+		}
+
+		q.jobs = append(q.jobs, job)
+		q.index[job.ID] = job
+
+		if job.Status == dto.StatusPending {
+			q.push(job)
+		}
+	}
+
+	transcoder.logger.Info("Восстановлено задач из хранилища: %d", len(jobs))
+	return q, nil
+}
+
+// recoverInterrupted обрабатывает задачу, выполнявшуюся в момент остановки процесса.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) recoverInterrupted(job *dto.Job, policy RecoveryPolicy) {
+	switch policy {
+	case RecoveryFail:
+		job.Status = dto.StatusFailed
+		job.Error = ErrJobInterrupted
+		job.EndTime = time.Now()
+		q.transcoder.logger.Warn("Задача %s прервана перезапуском и помечена как failed", job.ID)
+	default:
+		job.Status = dto.StatusPending
+		job.Progress = 0
+		job.StartTime = time.Time{}
+		q.transcoder.logger.Warn("Задача %s прервана перезапуском и возвращена в очередь", job.ID)
+	}
+	q.persist(job)
+}
+
+// persist сохраняет состояние задачи в хранилище, если оно задано.
+// Завершенные задачи удаляются из хранилища: оно нужно для восстановления
+// незавершенной работы, а итог остается доступен через GetJob до перезапуска.
+// Вызывается под блокировкой q.mu, чтобы порядок записей совпадал с порядком изменений.
+func (q *Queue) persist(job *dto.Job) {
+	if q.store == nil {
+		return
+	}
+
+	if isTerminal(job.Status) {
+		if err := q.store.Delete(job.ID); err != nil {
+			q.transcoder.logger.Error("Ошибка удаления задачи %s из хранилища: %v", job.ID, err)
+		}
+		return
+	}
+	if err := q.store.Save(job); err != nil {
+		q.transcoder.logger.Error("Ошибка сохранения задачи %s: %v", job.ID, err)
+	}
 }
 
-// AddJob добавляет задачу в очередь
-func (q *Queue) AddJob(job *dto.Job) {
+// isTerminal сообщает, что задача больше не будет выполняться
+func isTerminal(status dto.JobStatus) bool {
+	return status == dto.StatusCompleted || status == dto.StatusFailed || status == dto.StatusCancelled
+}
+
+// unlock снимает блокировку q.mu и публикует накопленные события,
+// чтобы обработчики подписчиков могли обращаться к очереди без взаимоблокировки.
+// Затем выполняет отложенные действия: задача попадает к воркерам только
+// после публикации EventJobQueued, поэтому EventJobStarted не может его опередить.
+func (q *Queue) unlock() {
+	events, after := q.events, q.after
+	q.events, q.after = nil, nil
+	q.mu.Unlock()
+
+	for _, event := range events {
+		q.transcoder.events.Publish(event)
+	}
+	for _, action := range after {
+		action()
+	}
+}
+
+// emit откладывает публикацию события до снятия блокировки.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) emit(eventType EventType, job *dto.Job) {
+	q.events = append(q.events, newJobEvent(eventType, job))
+}
+
+// Subscribe подписывает на события задач (канал с буфером buffer) и возвращает функцию отписки
+func (q *Queue) Subscribe(buffer int) (<-chan Event, func()) {
+	return q.transcoder.Subscribe(buffer)
+}
+
+// SubscribeFunc регистрирует обработчик событий задач и возвращает функцию отписки
+func (q *Queue) SubscribeFunc(fn func(Event)) func() {
+	return q.transcoder.SubscribeFunc(fn)
+}
+
+// SetRetryPolicy устанавливает политику повторов для неуспешных задач
+func (q *Queue) SetRetryPolicy(policy RetryPolicy) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	q.retry = policy
+}
+
+// AddJob добавляет задачу в очередь с приоритетом job.Priority.
+// Очередь хранит собственную копию задачи: переданный указатель не
+// обновляется, текущее состояние возвращают GetJob и GetJobs.
+// После начала Shutdown возвращает ErrQueueClosed.
+func (q *Queue) AddJob(job *dto.Job) error {
+	return q.addJob(job, job.Priority)
+}
+
+// AddJobWithPriority добавляет задачу с указанным приоритетом (больше = раньше).
+// Приоритет задается копии задачи в очереди, переданная задача не изменяется.
+func (q *Queue) AddJobWithPriority(job *dto.Job, priority int) error {
+	return q.addJob(job, priority)
+}
+
+// addJob добавляет в очередь копию задачи с приоритетом priority
+func (q *Queue) addJob(job *dto.Job, priority int) error {
+	q.mu.Lock()
+	defer q.unlock()
+
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	// Повторное добавление той же задачи игнорируется
+	if _, exists := q.index[job.ID]; exists {
+		return nil
+	}
+
+	job = cloneJob(job)
+	job.Priority = priority
 	q.jobs = append(q.jobs, job)
+	q.index[job.ID] = job
+	q.persist(job)
+	q.enqueue(job)
+	return nil
+}
+
+// enqueue публикует EventJobQueued и после публикации передает задачу
+// воркерам, если она не была отменена в обработчике события.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) enqueue(job *dto.Job) {
+	q.emit(EventJobQueued, job)
+	q.after = append(q.after, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+
+		if job.Status == dto.StatusPending && q.ctx.Err() == nil && !q.closed {
+			q.push(job)
+		}
+	})
+}
+
+// push помещает задачу в очередь ожидания и будит один воркер.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) push(job *dto.Job) {
+	q.seq++
+	heap.Push(&q.pending, &queueItem{job: job, seq: q.seq})
+	q.cond.Signal()
 }
 
 // Start запускает обработку очереди
@@ -48,44 +256,389 @@ func (q *Queue) Start() {
 // Stop останавливает обработку очереди
 func (q *Queue) Stop() {
 	q.cancel()
+
+	q.mu.Lock()
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// Shutdown корректно останавливает очередь: прекращает прием и запуск задач
+// и ждет завершения выполняемых. Если ctx истекает раньше, выполняемые задачи
+// прерываются, а их частично записанные выходные файлы удаляются; в этом случае
+// вместе с итогом возвращается ошибка контекста. Оставшиеся в очереди задачи
+// не запускаются (при постоянном хранилище они будут восстановлены при следующем старте).
+func (q *Queue) Shutdown(ctx context.Context) (*ShutdownSummary, error) {
+	q.mu.Lock()
+	q.closed = true
+	active := make([]*dto.Job, 0, len(q.cancels))
+	for _, job := range q.jobs {
+		if job.Status == dto.StatusRunning || job.Status == dto.StatusPaused {
+			active = append(active, job)
+		}
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	q.transcoder.logger.Info("Остановка очереди: ожидание %d выполняемых задач", len(active))
+
+	drained := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(drained)
+	}()
+
+	var shutdownErr error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		shutdownErr = ctx.Err()
+		q.transcoder.logger.Warn("Срок остановки истек, выполняемые задачи прерываются")
+		q.Stop()
+		<-drained
+	}
+
+	// Окончательно останавливаем воркеры
+	q.Stop()
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	summary := &ShutdownSummary{}
+	for _, job := range active {
+		switch job.Status {
+		case dto.StatusCompleted:
+			summary.Completed = append(summary.Completed, job.ID)
+		case dto.StatusFailed:
+			summary.Failed = append(summary.Failed, job.ID)
+		case dto.StatusCancelled:
+			summary.Interrupted = append(summary.Interrupted, job.ID)
+			q.removePartialOutput(job)
+		}
+	}
+	for _, job := range q.jobs {
+		if job.Status == dto.StatusPending {
+			summary.Pending = append(summary.Pending, job.ID)
+		}
+	}
+
+	q.transcoder.logger.Info("Очередь остановлена: завершено %d, ошибок %d, прервано %d, в очереди %d",
+		len(summary.Completed), len(summary.Failed), len(summary.Interrupted), len(summary.Pending))
+
+	return summary, shutdownErr
+}
+
+// removePartialOutput удаляет частично записанный выходной файл прерванной задачи
+func (q *Queue) removePartialOutput(job *dto.Job) {
+	if job.Config.OutputPath == "" {
+		return
+	}
+	if err := os.Remove(job.Config.OutputPath); err != nil && !os.IsNotExist(err) {
+		q.transcoder.logger.Warn("Не удалось удалить частичный файл %s: %v", job.Config.OutputPath, err)
+	}
+}
+
+// Cancel отменяет задачу: ожидающая задача удаляется из очереди,
+// у выполняемой (или приостановленной) завершается процесс FFmpeg
+func (q *Queue) Cancel(jobID string) error {
+	q.mu.Lock()
+	defer q.unlock()
+
+	job, exists := q.index[jobID]
+	if !exists {
+		return ErrJobNotFound
+	}
+
+	switch job.Status {
+	case dto.StatusPending:
+		q.removePending(jobID)
+		job.Status = dto.StatusCancelled
+		job.EndTime = time.Now()
+		q.persist(job)
+		q.emit(EventJobCancelled, job)
+		q.transcoder.logger.Info("Задача %s отменена до запуска", jobID)
+		return nil
+	case dto.StatusRunning, dto.StatusPaused:
+		// Статус Cancelled выставит воркер после завершения процесса
+		if cancel, ok := q.cancels[jobID]; ok {
+			cancel()
+		}
+		q.transcoder.logger.Info("Задача %s отменяется", jobID)
+		return nil
+	default:
+		return ErrJobNotActive
+	}
+}
+
+// Pause приостанавливает выполняемую задачу (SIGSTOP группе процессов FFmpeg на Linux)
+func (q *Queue) Pause(jobID string) error {
+	q.mu.Lock()
+	defer q.unlock()
+
+	job, exists := q.index[jobID]
+	if !exists {
+		return ErrJobNotFound
+	}
+	if job.Status != dto.StatusRunning {
+		return ErrJobNotActive
+	}
+
+	if err := q.transcoder.pauseJob(jobID); err != nil {
+		return fmt.Errorf("не удалось приостановить задачу: %w", err)
+	}
+
+	job.Status = dto.StatusPaused
+	q.persist(job)
+	q.emit(EventJobPaused, job)
+	q.transcoder.logger.Info("Задача %s приостановлена", jobID)
+	return nil
+}
+
+// Resume возобновляет приостановленную задачу
+func (q *Queue) Resume(jobID string) error {
+	q.mu.Lock()
+	defer q.unlock()
+
+	job, exists := q.index[jobID]
+	if !exists {
+		return ErrJobNotFound
+	}
+	if job.Status != dto.StatusPaused {
+		return ErrJobNotActive
+	}
+
+	if err := q.transcoder.resumeJob(jobID); err != nil {
+		return fmt.Errorf("не удалось возобновить задачу: %w", err)
+	}
+
+	job.Status = dto.StatusRunning
+	q.persist(job)
+	q.emit(EventJobResumed, job)
+	q.transcoder.logger.Info("Задача %s возобновлена", jobID)
+	return nil
+}
+
+// removePending удаляет задачу из очереди ожидания.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) removePending(jobID string) {
+	for i, item := range q.pending {
+		if item.job.ID == jobID {
+			heap.Remove(&q.pending, i)
+			return
+		}
+	}
 }
 
 // worker обрабатывает задачи из очереди
 func (q *Queue) worker() {
 	for {
-		select {
-		case <-q.ctx.Done():
+		job, ctx := q.getNextJob()
+		if job == nil {
 			return
-		default:
-			job := q.getNextJob()
-			if job != nil {
-				q.transcoder.Execute(q.ctx, job)
-			}
 		}
+		q.runJob(ctx, job)
+		q.running.Done()
 	}
 }
 
-// getNextJob получает следующую задачу из очереди
-func (q *Queue) getNextJob() *dto.Job {
+// runJob выполняет задачу на рабочей копии, синхронизируя состояние
+// с реестром под блокировкой, чтобы GetJobs видел прогресс без гонок.
+// ctx и функция его отмены регистрируются в getNextJob.
+func (q *Queue) runJob(ctx context.Context, job *dto.Job) {
 	q.mu.Lock()
-	defer q.mu.Unlock()
+	// Задача отменена между выбором из очереди и запуском
+	if ctx.Err() != nil && q.ctx.Err() == nil {
+		q.finishCancelled(job)
+		q.unlock()
+		return
+	}
+	job.Attempts++
+	work := *job
+	q.mu.Unlock()
 
-	for i, job := range q.jobs {
-		if job.Status == dto.StatusPending {
-			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
-			return job
+	onProgress := job.OnProgress
+	work.OnProgress = func(progress float64, speed string, eta time.Duration) {
+		q.mu.Lock()
+		job.Progress = progress
+		job.Speed = speed
+		job.ETA = eta
+		q.mu.Unlock()
+
+		if onProgress != nil {
+			onProgress(progress, speed, eta)
 		}
 	}
 
-	return nil
+	// События завершения публикуются ниже: неуспешная попытка, которая будет
+	// повторена, сообщается только событием EventJobRetrying
+	q.transcoder.execute(ctx, &work, false)
+
+	q.mu.Lock()
+	defer q.unlock()
+
+	q.releaseCancel(job.ID)
+	work.OnProgress = onProgress
+	*job = work
+
+	// Задача, прерванная остановкой очереди, остается в хранилище как выполняемая
+	// и будет обработана политикой восстановления при следующем запуске
+	if q.ctx.Err() != nil {
+		q.emit(terminalEvent(job.Status), job)
+		return
+	}
+
+	if job.Status == dto.StatusFailed {
+		job.History = append(job.History, dto.AttemptError{
+			Attempt: job.Attempts,
+			Error:   job.Error.Error(),
+			Time:    job.EndTime,
+		})
+
+		if q.retry.ShouldRetry(job.Attempts, job.Error) {
+			q.scheduleRetry(job)
+			q.persist(job)
+			return
+		}
+	}
+
+	q.emit(terminalEvent(job.Status), job)
+	q.persist(job)
+}
+
+// finishCancelled завершает отмененную до запуска FFmpeg задачу.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) finishCancelled(job *dto.Job) {
+	q.releaseCancel(job.ID)
+	job.Status = dto.StatusCancelled
+	job.Error = context.Canceled
+	job.EndTime = time.Now()
+	q.persist(job)
+	q.emit(EventJobCancelled, job)
+	q.transcoder.logger.Info("Задача %s отменена до запуска FFmpeg", job.ID)
+}
+
+// releaseCancel освобождает контекст выполнения задачи.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) releaseCancel(jobID string) {
+	if cancel, ok := q.cancels[jobID]; ok {
+		cancel()
+		delete(q.cancels, jobID)
+	}
+}
+
+// scheduleRetry возвращает задачу в очередь после задержки политики повторов.
+// Вызывается под блокировкой q.mu.
+func (q *Queue) scheduleRetry(job *dto.Job) {
+	delay := q.retry.Backoff(job.Attempts)
+	q.transcoder.logger.Warn("Попытка %d задачи %s не удалась, повтор через %v: %v",
+		job.Attempts, job.ID, delay, job.Error)
+
+	job.Status = dto.StatusPending
+	job.Progress = 0
+	q.emit(EventJobRetrying, job)
+
+	// Таймер запускается после публикации EventJobRetrying, чтобы повтор
+	// с нулевой задержкой не опередил его событием EventJobQueued
+	q.after = append(q.after, func() {
+		time.AfterFunc(delay, func() {
+			q.mu.Lock()
+			defer q.unlock()
+
+			// Задача могла быть отменена во время ожидания
+			if job.Status == dto.StatusPending && q.ctx.Err() == nil && !q.closed {
+				q.enqueue(job)
+			}
+		})
+	})
+}
+
+// getNextJob блокируется до появления задачи или остановки очереди.
+// Контекст выполнения создается и регистрируется под той же блокировкой,
+// поэтому Cancel сразу после выбора задачи не теряется.
+// Возвращает nil, если очередь остановлена.
+func (q *Queue) getNextJob() (*dto.Job, context.Context) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.pending.Len() == 0 && q.ctx.Err() == nil && !q.closed {
+		q.cond.Wait()
+	}
+
+	if q.ctx.Err() != nil || q.closed {
+		return nil, nil
+	}
+
+	q.running.Add(1)
+	job := heap.Pop(&q.pending).(*queueItem).job
+	job.Status = dto.StatusRunning
+	job.StartTime = time.Now()
+
+	ctx, cancel := context.WithCancel(q.ctx)
+	q.cancels[job.ID] = cancel
+
+	q.persist(job)
+	return job, ctx
 }
 
-// GetJobs возвращает все задачи
+// GetJobs возвращает снимки всех задач, включая выполняемые и завершенные
 func (q *Queue) GetJobs() []*dto.Job {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
 	jobs := make([]*dto.Job, len(q.jobs))
-	copy(jobs, q.jobs)
+	for i, job := range q.jobs {
+		jobs[i] = cloneJob(job)
+	}
 	return jobs
 }
+
+// GetJob возвращает снимок задачи по ID
+func (q *Queue) GetJob(id string) (*dto.Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, exists := q.index[id]
+	if !exists {
+		return nil, false
+	}
+	return cloneJob(job), true
+}
+
+// cloneJob возвращает копию задачи с собственной историей попыток
+func cloneJob(job *dto.Job) *dto.Job {
+	clone := *job
+	clone.History = append([]dto.AttemptError(nil), job.History...)
+	return &clone
+}
+
+// queueItem элемент очереди ожидания
+type queueItem struct {
+	job *dto.Job
+	seq uint64
+}
+
+// jobHeap очередь с приоритетом: больший Priority раньше, при равенстве - FIFO
+type jobHeap []*queueItem
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].job.Priority != h[j].job.Priority {
+		return h[i].job.Priority > h[j].job.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x interface{}) {
+	*h = append(*h, x.(*queueItem))
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
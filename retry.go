@@ -0,0 +1,110 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// RetryPolicy политика повторного выполнения неуспешных задач
+type RetryPolicy struct {
+	MaxAttempts    int                  // Всего попыток, включая первую (<= 1 - без повторов)
+	InitialBackoff time.Duration        // Задержка перед первым повтором
+	MaxBackoff     time.Duration        // Максимальная задержка (0 - без ограничения)
+	Multiplier     float64              // Множитель экспоненциального роста задержки
+	Jitter         float64              // Доля случайного разброса задержки (0..1)
+	Retryable      func(err error) bool // Классификатор ошибок (nil - IsRetryableError)
+}
+
+// DefaultRetryPolicy возвращает политику по умолчанию: 3 попытки,
+// задержка от 2 секунд с удвоением, не более минуты, разброс 20%
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// ShouldRetry определяет, нужно ли повторять задачу после попытки attempt (с 1)
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if err == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+	return retryable(err)
+}
+
+// Backoff возвращает задержку перед повтором после попытки attempt (с 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+// IsRetryableError классифицирует ошибку как временную (стоит повторить)
+// или фатальную. Фатальными считаются ошибки валидации, отмена и ошибки
+// FFmpeg с причиной, которую повтор не исправит (нет кодека, неверные
+// аргументы, нет файла, нет прав).
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var validationErrors dto.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return false
+	}
+
+	var ffErr *FFmpegError
+	if errors.As(err, &ffErr) {
+		switch ffErr.Cause {
+		case CauseCodecNotFound, CauseInvalidArgument, CauseNoSuchFile, CausePermissionDenied:
+			return false
+		}
+	}
+
+	return true
+}
+
+// sleepContext ожидает указанное время или отмену контекста
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
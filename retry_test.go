@@ -0,0 +1,129 @@
+package transcoder
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{&FFmpegError{Cause: CauseNetwork}, true},
+		{&FFmpegError{Cause: CauseNoSpace}, true},
+		{&FFmpegError{Cause: CauseUnknown}, true},
+		{&FFmpegError{Cause: CauseCodecNotFound}, false},
+		{&FFmpegError{Cause: CauseNoSuchFile}, false},
+		{dto.ValidationErrors{{Field: "InputPath", Message: "пусто"}}, false},
+		{context.Canceled, false},
+		{errors.New("temporary"), true},
+	}
+
+	for _, c := range cases {
+		if got := IsRetryableError(c.err); got != c.retryable {
+			t.Errorf("IsRetryableError(%v) = %v, ожидалось %v", c.err, got, c.retryable)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("Backoff(%d) = %v, ожидалось %v", i+1, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Backoff(1); got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("Задержка с разбросом вне диапазона: %v", got)
+		}
+	}
+}
+
+func TestQueueRetriesTransientFailure(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{
+		Stderr:   "No space left on device\n",
+		ExitCode: 1,
+	})
+	fake.AddResponse("ffmpeg", runner.FakeResponse{})
+
+	input := newTestInput(t)
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+	queue.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	events, unsubscribe := queue.Subscribe(32)
+	defer unsubscribe()
+
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "out.mp4")})
+	queue.AddJob(job)
+	queue.Start()
+
+	// Неуспешная попытка, которая будет повторена, не считается завершением задачи
+	var received []EventType
+	for done := false; !done; {
+		select {
+		case event := <-events:
+			switch event.Type {
+			case EventJobFailed, EventJobCancelled, EventJobRetrying:
+				received = append(received, event.Type)
+			case EventJobCompleted:
+				received = append(received, event.Type)
+				done = true
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Не дождались завершения задачи, события: %v", received)
+		}
+	}
+	if len(received) != 2 || received[0] != EventJobRetrying {
+		t.Errorf("Ожидались события повтора и завершения, получено %v", received)
+	}
+
+	result, _ := queue.GetJob(job.ID)
+	if result.Status != dto.StatusCompleted {
+		t.Fatalf("Ожидался статус %d после повтора, получен %d (%v)", dto.StatusCompleted, result.Status, result.Error)
+	}
+	if result.Attempts != 2 || len(result.History) != 1 || result.History[0].Attempt != 1 {
+		t.Errorf("Неожиданная история попыток: %d попыток, %+v", result.Attempts, result.History)
+	}
+}
+
+func TestQueueDoesNotRetryFatalFailure(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{
+		Stderr:   "Unknown encoder 'libx264'\n",
+		ExitCode: 1,
+	})
+
+	input := newTestInput(t)
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+	queue.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "out.mp4")})
+	queue.AddJob(job)
+	queue.Start()
+	waitForJobs(t, queue)
+
+	result, _ := queue.GetJob(job.ID)
+	if result.Status != dto.StatusFailed || result.Attempts != 1 {
+		t.Errorf("Фатальная ошибка не должна повторяться: статус %d, попыток %d", result.Status, result.Attempts)
+	}
+}
@@ -0,0 +1,190 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FakeResponse заранее заданный результат запуска команды
+type FakeResponse struct {
+	Stdout   string        // Выводится в stdout процесса
+	Stderr   string        // Выводится в stderr процесса
+	ExitCode int           // Код завершения (0 = успех)
+	StartErr error         // Ошибка запуска (процесс не стартует)
+	Delay    time.Duration // Время "работы" процесса, прерывается отменой контекста
+}
+
+// Call записанный вызов команды
+type Call struct {
+	Path string
+	Args []string
+}
+
+// FakeRunner сценарный runner для тестов: записывает аргументы вызовов
+// и воспроизводит заданные ответы вместо запуска реальных процессов.
+type FakeRunner struct {
+	mu        sync.Mutex
+	calls     []Call
+	responses map[string][]FakeResponse
+}
+
+// NewFakeRunner создает сценарный runner. Без заданных ответов
+// все команды завершаются успешно с пустым выводом.
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		responses: make(map[string][]FakeResponse),
+	}
+}
+
+// AddResponse добавляет ответ для программы (по имени файла, например "ffmpeg").
+// Ответы выдаются по порядку, последний ответ повторяется.
+func (f *FakeRunner) AddResponse(program string, response FakeResponse) *FakeRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses[program] = append(f.responses[program], response)
+	return f
+}
+
+// Calls возвращает все записанные вызовы
+func (f *FakeRunner) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := make([]Call, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// CallsTo возвращает вызовы конкретной программы
+func (f *FakeRunner) CallsTo(program string) []Call {
+	var calls []Call
+	for _, call := range f.Calls() {
+		if programName(call.Path) == program {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Start записывает вызов и возвращает процесс с заданным ответом
+func (f *FakeRunner) Start(ctx context.Context, cmd Command) (Process, error) {
+	response := f.nextResponse(cmd)
+	if response.StartErr != nil {
+		return nil, response.StartErr
+	}
+
+	return &fakeProcess{ctx: ctx, cmd: cmd, response: response, resumed: make(chan struct{})}, nil
+}
+
+// nextResponse записывает вызов и выбирает ответ для него
+func (f *FakeRunner) nextResponse(cmd Command) FakeResponse {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, Call{
+		Path: cmd.Path,
+		Args: append([]string(nil), cmd.Args...),
+	})
+
+	program := programName(cmd.Path)
+	queue := f.responses[program]
+	if len(queue) == 0 {
+		return FakeResponse{}
+	}
+
+	response := queue[0]
+	if len(queue) > 1 {
+		f.responses[program] = queue[1:]
+	}
+	return response
+}
+
+// programName возвращает имя программы без пути
+func programName(path string) string {
+	return filepath.Base(path)
+}
+
+// fakeProcess процесс, воспроизводящий FakeResponse
+type fakeProcess struct {
+	ctx      context.Context
+	cmd      Command
+	response FakeResponse
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // закрывается при возобновлении
+}
+
+func (p *fakeProcess) Pause() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.paused {
+		p.paused = true
+		p.resumed = make(chan struct{})
+	}
+	return nil
+}
+
+func (p *fakeProcess) Resume() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		p.paused = false
+		close(p.resumed)
+	}
+	return nil
+}
+
+// waitResumed блокируется, пока процесс приостановлен
+func (p *fakeProcess) waitResumed() error {
+	p.mu.Lock()
+	paused, resumed := p.paused, p.resumed
+	p.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+func (p *fakeProcess) Wait() error {
+	if p.cmd.Stdout != nil && p.response.Stdout != "" {
+		io.WriteString(p.cmd.Stdout, p.response.Stdout)
+	}
+	if p.cmd.Stderr != nil && p.response.Stderr != "" {
+		io.WriteString(p.cmd.Stderr, p.response.Stderr)
+	}
+
+	if p.response.Delay > 0 {
+		timer := time.NewTimer(p.response.Delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		}
+	}
+
+	// Приостановленный процесс не завершается до возобновления
+	if err := p.waitResumed(); err != nil {
+		return err
+	}
+
+	if p.response.ExitCode != 0 {
+		return &ExitError{Code: p.response.ExitCode}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package runner
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup запускает процесс в отдельной группе, чтобы сигналы
+// приостановки и завершения доходили и до его дочерних процессов
+func setProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		return signalGroup(c, syscall.SIGKILL)
+	}
+}
+
+// pauseProcess приостанавливает группу процессов (SIGSTOP)
+func pauseProcess(c *exec.Cmd) error {
+	return signalGroup(c, syscall.SIGSTOP)
+}
+
+// resumeProcess возобновляет группу процессов (SIGCONT)
+func resumeProcess(c *exec.Cmd) error {
+	return signalGroup(c, syscall.SIGCONT)
+}
+
+// signalGroup отправляет сигнал всей группе процессов
+func signalGroup(c *exec.Cmd, sig syscall.Signal) error {
+	if c.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-c.Process.Pid, sig)
+}
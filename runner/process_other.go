@@ -0,0 +1,18 @@
+//go:build !linux
+
+package runner
+
+import "os/exec"
+
+// setProcessGroup на других платформах не меняет параметры запуска
+func setProcessGroup(c *exec.Cmd) {}
+
+// pauseProcess не поддерживается вне Linux
+func pauseProcess(c *exec.Cmd) error {
+	return ErrPauseNotSupported
+}
+
+// resumeProcess не поддерживается вне Linux
+func resumeProcess(c *exec.Cmd) error {
+	return ErrPauseNotSupported
+}
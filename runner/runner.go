@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Command описывает запуск внешней программы
+type Command struct {
+	Path   string    // Путь к исполняемому файлу
+	Args   []string  // Аргументы без имени программы
+	Stdout io.Writer // Куда писать stdout (nil = отбросить)
+	Stderr io.Writer // Куда писать stderr (nil = отбросить)
+}
+
+// Process запущенный внешний процесс
+type Process interface {
+	// Wait ожидает завершения процесса
+	Wait() error
+	// Pause приостанавливает процесс
+	Pause() error
+	// Resume возобновляет приостановленный процесс
+	Resume() error
+}
+
+// ErrPauseNotSupported приостановка процессов не поддерживается на этой платформе
+var ErrPauseNotSupported = errors.New("приостановка процессов не поддерживается на этой платформе")
+
+// CommandRunner запускает внешние команды (ffmpeg, ffprobe).
+// Позволяет подменить реальный запуск в тестах.
+type CommandRunner interface {
+	Start(ctx context.Context, cmd Command) (Process, error)
+}
+
+// ExitError ошибка завершения процесса с ненулевым кодом
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode возвращает код завершения процесса
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// Run запускает команду и ожидает её завершения
+func Run(ctx context.Context, r CommandRunner, cmd Command) error {
+	process, err := r.Start(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	return process.Wait()
+}
+
+// Output запускает команду и возвращает её stdout
+func Output(ctx context.Context, r CommandRunner, path string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := Run(ctx, r, Command{
+		Path:   path,
+		Args:   args,
+		Stdout: &stdout,
+	})
+	return stdout.Bytes(), err
+}
+
+// ExecRunner запускает команды через os/exec
+type ExecRunner struct{}
+
+// NewExecRunner создает runner, запускающий реальные процессы
+func NewExecRunner() *ExecRunner {
+	return &ExecRunner{}
+}
+
+// Start запускает процесс через exec.CommandContext
+func (r *ExecRunner) Start(ctx context.Context, cmd Command) (Process, error) {
+	c := exec.CommandContext(ctx, cmd.Path, cmd.Args...)
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	setProcessGroup(c)
+
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	return &execProcess{cmd: c}, nil
+}
+
+// execProcess процесс, запущенный через os/exec
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p *execProcess) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p *execProcess) Pause() error {
+	return pauseProcess(p.cmd)
+}
+
+func (p *execProcess) Resume() error {
+	return resumeProcess(p.cmd)
+}
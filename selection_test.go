@@ -0,0 +1,79 @@
+package transcoder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/utils"
+)
+
+// testStreams лестница вариантов с разными кодеками и частотой кадров
+var testStreams = []dto.StreamInfo{
+	{URL: "sd.m3u8", Resolution: "640x360", Bandwidth: 800000, Codecs: "avc1.4d401e,mp4a.40.2", FrameRate: 25},
+	{URL: "hd-avc.m3u8", Resolution: "1280x720", Bandwidth: 2500000, Codecs: "avc1.64001f,mp4a.40.2", FrameRate: 25},
+	{URL: "hd-hevc.m3u8", Resolution: "1280x720", Bandwidth: 1800000, Codecs: "hev1.1.6.L93.B0,mp4a.40.2", FrameRate: 50},
+	{URL: "fhd-avc.m3u8", Resolution: "1920x1080", Bandwidth: 5000000, Codecs: "avc1.640028,mp4a.40.2", FrameRate: 29.97},
+	{URL: "fhd-av1.m3u8", Resolution: "1920x1080", Bandwidth: 3500000, Codecs: "av01.0.08M.08,mp4a.40.2", FrameRate: 29.97},
+}
+
+func TestSelectVariantPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		config dto.HLSConfig
+		want   string
+	}{
+		{"по умолчанию лучший битрейт", dto.HLSConfig{}, "fhd-avc.m3u8"},
+		{"ограничение высоты", dto.HLSConfig{MaxHeight: 720}, "hd-avc.m3u8"},
+		{"ограничение ширины", dto.HLSConfig{MaxWidth: 1000}, "sd.m3u8"},
+		{"потолок битрейта", dto.HLSConfig{MaxBandwidth: 4000000}, "fhd-av1.m3u8"},
+		{"ограничению не соответствует ни один", dto.HLSConfig{MaxBandwidth: 100000}, "sd.m3u8"},
+		{"предпочтение кодека", dto.HLSConfig{PreferCodecs: []string{"hevc", "avc1"}}, "hd-hevc.m3u8"},
+		{"первый доступный кодек", dto.HLSConfig{PreferCodecs: []string{"vp9", "av1"}}, "fhd-av1.m3u8"},
+		{"частота кадров", dto.HLSConfig{PreferFrameRate: 30}, "fhd-avc.m3u8"},
+		{"частота кадров с ограничением", dto.HLSConfig{PreferFrameRate: 60, MaxHeight: 720}, "hd-hevc.m3u8"},
+		{"ближайшее разрешение", dto.HLSConfig{Quality: "1024x576", NearestResolution: true}, "hd-avc.m3u8"},
+		{"худший среди ограниченных", dto.HLSConfig{Quality: "worst", MaxHeight: 720, PreferCodecs: []string{"avc1"}}, "sd.m3u8"},
+		{
+			"собственный выбор",
+			dto.HLSConfig{MaxHeight: 360, StreamSelector: func(streams []dto.StreamInfo) (int, error) {
+				return len(streams) - 1, nil
+			}},
+			"fhd-av1.m3u8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, err := utils.SelectVariantIndex(testStreams, tt.config)
+			if err != nil {
+				t.Fatalf("Ошибка выбора: %v", err)
+			}
+			if got := testStreams[index].URL; got != tt.want {
+				t.Errorf("Выбран %s, ожидался %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectVariantErrors(t *testing.T) {
+	// Без NearestResolution отсутствующее разрешение остается ошибкой
+	if _, err := utils.SelectVariantIndex(testStreams, dto.HLSConfig{Quality: "1024x576"}); err == nil {
+		t.Error("Ожидалась ошибка для отсутствующего разрешения")
+	}
+
+	selectorErr := errors.New("нет подходящего")
+	_, err := utils.SelectVariantIndex(testStreams, dto.HLSConfig{
+		StreamSelector: func([]dto.StreamInfo) (int, error) { return 0, selectorErr },
+	})
+	if !errors.Is(err, selectorErr) {
+		t.Errorf("Ожидалась ошибка селектора, получено %v", err)
+	}
+
+	_, err = utils.SelectVariantIndex(testStreams, dto.HLSConfig{
+		StreamSelector: func([]dto.StreamInfo) (int, error) { return 10, nil },
+	})
+	if err == nil {
+		t.Error("Ожидалась ошибка для индекса вне диапазона")
+	}
+}
@@ -4,32 +4,45 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
 	"github.com/Mirsadikovv/ffmpeg_research/utils"
 	"github.com/google/uuid"
 )
 
 // Transcoder представляет основной интерфейс для транскодирования
 type Transcoder struct {
-	ffmpegPath string
-	tempDir    string
-	hls        *HLSDownloader
-	logger     Logger
+	ffmpegPath  string
+	ffprobePath string
+	tempDir     string
+	hls         *HLSDownloader
+	logger      Logger
+	runner      runner.CommandRunner
+	events      *EventBus
+
+	processesMu sync.Mutex
+	processes   map[string]runner.Process // Запущенные процессы FFmpeg по ID задачи
 }
 
 // New создает новый экземпляр транскодера
 func New(ffmpegPath string) (*Transcoder, error) {
+	return NewWithRunner(ffmpegPath, runner.NewExecRunner())
+}
+
+// NewWithRunner создает транскодер, запускающий ffmpeg/ffprobe через
+// указанный runner (например, runner.FakeRunner в тестах)
+func NewWithRunner(ffmpegPath string, r runner.CommandRunner) (*Transcoder, error) {
 	if ffmpegPath == "" {
 		ffmpegPath = "ffmpeg"
 	}
 
 	// Проверяем доступность FFmpeg
-	if err := utils.CheckFFmpeg(ffmpegPath); err != nil {
+	if err := utils.CheckFFmpegWithRunner(r, ffmpegPath); err != nil {
 		return nil, fmt.Errorf("FFmpeg не найден: %w", err)
 	}
 
@@ -39,9 +52,13 @@ func New(ffmpegPath string) (*Transcoder, error) {
 	}
 
 	transcoder := &Transcoder{
-		ffmpegPath: ffmpegPath,
-		tempDir:    tempDir,
-		logger:     NewDefaultLogger(LogLevelInfo), // По умолчанию INFO уровень
+		ffmpegPath:  ffmpegPath,
+		ffprobePath: "ffprobe",
+		tempDir:     tempDir,
+		logger:      NewDefaultLogger(LogLevelInfo), // По умолчанию INFO уровень
+		runner:      r,
+		events:      NewEventBus(),
+		processes:   make(map[string]runner.Process),
 	}
 
 	// Инициализируем HLS загрузчик
@@ -61,35 +78,50 @@ func (t *Transcoder) CreateJob(config dto.Config) *dto.Job {
 
 // Execute выполняет транскодирование
 func (t *Transcoder) Execute(ctx context.Context, job *dto.Job) error {
+	return t.execute(ctx, job, true)
+}
+
+// execute выполняет задачу. При emitFinish=false события завершения
+// (completed, failed, cancelled) не публикуются: их публикует очередь
+// после решения о повторе.
+func (t *Transcoder) execute(ctx context.Context, job *dto.Job, emitFinish bool) error {
+	finish := func(eventType EventType) {
+		if emitFinish {
+			t.emit(eventType, job)
+		}
+	}
+
 	// Валидируем конфигурацию перед выполнением
 	if err := job.Config.Validate(); err != nil {
 		job.Status = dto.StatusFailed
 		job.Error = err
 		t.logger.Error("Ошибка валидации конфигурации: %v", err)
+		finish(EventJobFailed)
 		return fmt.Errorf("ошибка валидации конфигурации: %w", err)
 	}
 
 	job.Status = dto.StatusRunning
 	job.StartTime = time.Now()
+	t.emit(EventJobStarted, job)
 
 	t.logger.Info("Начало транскодирования: %s -> %s", job.Config.InputPath, job.Config.OutputPath)
 
 	args := utils.BuildFFmpegArgs(job.Config)
 	t.logger.Debug("FFmpeg аргументы: %v", args)
 
-	cmd := exec.CommandContext(ctx, t.ffmpegPath, args...)
-
-	if err := cmd.Run(); err != nil {
-		job.Status = dto.StatusFailed
+	if err := t.runJob(ctx, job, args); err != nil {
+		job.Status = failureStatus(ctx)
 		job.Error = err
 		job.EndTime = time.Now()
 		t.logger.Error("Ошибка выполнения FFmpeg: %v", err)
+		finish(finishEvent(job.Status))
 		return fmt.Errorf("ошибка транскодирования: %w", err)
 	}
 
 	job.Status = dto.StatusCompleted
 	job.Progress = 100.0
 	job.EndTime = time.Now()
+	finish(EventJobCompleted)
 
 	duration := job.EndTime.Sub(job.StartTime)
 	t.logger.Info("Транскодирование завершено за %v", duration)
@@ -97,17 +129,122 @@ func (t *Transcoder) Execute(ctx context.Context, job *dto.Job) error {
 	return nil
 }
 
+// runJob запускает FFmpeg для задачи и обновляет её прогресс в реальном времени
+func (t *Transcoder) runJob(ctx context.Context, job *dto.Job, args []string) error {
+	tracker := NewProgressTracker(func(progress float64, speed string, eta time.Duration) {
+		job.Progress = progress
+		job.Speed = speed
+		job.ETA = eta
+		if job.OnProgress != nil {
+			job.OnProgress(progress, speed, eta)
+		}
+		t.emit(EventJobProgress, job)
+	})
+
+	// Продолжительность входного файла нужна для расчета процента
+	if info, err := t.GetMediaInfo(job.Config.InputPath); err == nil {
+		tracker.SetDuration(info.Duration)
+	} else {
+		t.logger.Warn("Не удалось определить продолжительность, прогресс будет неточным: %v", err)
+	}
+
+	// Машиночитаемый прогресс выводится в stdout, обычная статистика отключается
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	stderr := newTailBuffer(stderrTailLines)
+
+	process, err := t.runner.Start(ctx, runner.Command{
+		Path:   t.ffmpegPath,
+		Args:   args,
+		Stdout: newLineWriter(tracker.ParseProgressLine),
+		Stderr: stderr,
+	})
+	if err != nil {
+		return newFFmpegError(args, err, stderr.String())
+	}
+
+	// Регистрируем процесс, чтобы задачу можно было приостановить
+	t.processesMu.Lock()
+	t.processes[job.ID] = process
+	t.processesMu.Unlock()
+
+	defer func() {
+		t.processesMu.Lock()
+		delete(t.processes, job.ID)
+		t.processesMu.Unlock()
+	}()
+
+	return newFFmpegError(args, process.Wait(), stderr.String())
+}
+
+// emit публикует событие о задаче в шину транскодера
+func (t *Transcoder) emit(eventType EventType, job *dto.Job) {
+	t.events.Publish(newJobEvent(eventType, job))
+}
+
+// finishEvent возвращает тип события для неуспешно завершенной задачи
+func finishEvent(status dto.JobStatus) EventType {
+	if status == dto.StatusCancelled {
+		return EventJobCancelled
+	}
+	return EventJobFailed
+}
+
+// terminalEvent возвращает тип события для завершенной задачи
+func terminalEvent(status dto.JobStatus) EventType {
+	if status == dto.StatusCompleted {
+		return EventJobCompleted
+	}
+	return finishEvent(status)
+}
+
+// failureStatus возвращает статус неуспешно завершенной задачи:
+// отмененной, если был отменен контекст, иначе failed
+func failureStatus(ctx context.Context) dto.JobStatus {
+	if ctx.Err() != nil {
+		return dto.StatusCancelled
+	}
+	return dto.StatusFailed
+}
+
+// pauseJob приостанавливает процесс FFmpeg выполняемой задачи
+func (t *Transcoder) pauseJob(jobID string) error {
+	process, err := t.process(jobID)
+	if err != nil {
+		return err
+	}
+	return process.Pause()
+}
+
+// resumeJob возобновляет приостановленный процесс FFmpeg задачи
+func (t *Transcoder) resumeJob(jobID string) error {
+	process, err := t.process(jobID)
+	if err != nil {
+		return err
+	}
+	return process.Resume()
+}
+
+// process возвращает запущенный процесс FFmpeg задачи
+func (t *Transcoder) process(jobID string) (runner.Process, error) {
+	t.processesMu.Lock()
+	defer t.processesMu.Unlock()
+
+	process, exists := t.processes[jobID]
+	if !exists {
+		return nil, fmt.Errorf("процесс FFmpeg задачи %s не запущен", jobID)
+	}
+	return process, nil
+}
+
 // GetInfo получает информацию о медиафайле
 func (t *Transcoder) GetInfo(filePath string) (map[string]interface{}, error) {
-	cmd := exec.Command("ffprobe",
+	output, err := runner.Output(context.Background(), t.runner, t.ffprobePath,
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
 		filePath,
 	)
-
-	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("ошибка получения информации о файле: %w", err)
 	}
@@ -163,20 +300,27 @@ func (t *Transcoder) CreateThumbnail(inputPath, outputPath string, timeOffset st
 		outputPath,
 	}
 
-	cmd := exec.Command(t.ffmpegPath, args...)
-	return cmd.Run()
+	stderr := newTailBuffer(stderrTailLines)
+	err := runner.Run(context.Background(), t.runner, runner.Command{
+		Path:   t.ffmpegPath,
+		Args:   args,
+		Stderr: stderr,
+	})
+	if err != nil {
+		t.logger.Error("Ошибка создания миниатюры: %v", err)
+		return newFFmpegError(args, err, stderr.String())
+	}
+	return nil
 }
 
 // GetDuration получает продолжительность медиафайла
 func (t *Transcoder) GetDuration(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe",
+	output, err := runner.Output(context.Background(), t.runner, t.ffprobePath,
 		"-v", "quiet",
 		"-show_entries", "format=duration",
 		"-of", "csv=p=0",
 		filePath,
 	)
-
-	output, err := cmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("ошибка получения продолжительности: %w", err)
 	}
@@ -201,21 +345,59 @@ func (t *Transcoder) DownloadHLSWithConfig(ctx context.Context, config dto.HLSCo
 	return t.hls.DownloadHLS(ctx, config)
 }
 
-// GetHLSInfo получает информацию о HLS плейлисте
+// DownloadDASH загружает VOD презентацию MPEG-DASH по MPD манифесту
+func (t *Transcoder) DownloadDASH(ctx context.Context, config dto.HLSConfig) error {
+	return t.hls.DownloadDASH(ctx, config)
+}
+
+// GetHLSInfo получает информацию о HLS плейлисте или MPD манифесте
 func (t *Transcoder) GetHLSInfo(playlistURL string) (*dto.PlaylistInfo, error) {
 	return t.hls.GetPlaylistInfo(playlistURL)
 }
 
+// GetHLSInfoWithConfig получает информацию о плейлисте config.URL с
+// заголовками, cookies, Referer, прокси и CA bundle из конфигурации
+func (t *Transcoder) GetHLSInfoWithConfig(ctx context.Context, config dto.HLSConfig) (*dto.PlaylistInfo, error) {
+	return t.hls.GetPlaylistInfoWithConfig(ctx, config)
+}
+
+// DiscoverPlaylists ищет манифесты HLS и DASH на странице config.URL,
+// включая iframe первого уровня
+func (t *Transcoder) DiscoverPlaylists(ctx context.Context, config dto.HLSConfig) ([]dto.PlaylistCandidate, error) {
+	return t.hls.DiscoverPlaylists(ctx, config)
+}
+
+// ValidateHLS проверяет плейлист из GetHLSInfo на соответствие спецификации
+// и доступность ресурсов
+func (t *Transcoder) ValidateHLS(ctx context.Context, info *dto.PlaylistInfo, config dto.ConformanceConfig) (*dto.ConformanceReport, error) {
+	return t.hls.ValidateHLS(ctx, info, config)
+}
+
 // RecordLiveStream записывает live стрим с ограничением по времени
 func (t *Transcoder) RecordLiveStream(ctx context.Context, streamURL, outputPath string, duration time.Duration) error {
 	return t.hls.RecordLiveStream(ctx, streamURL, outputPath, duration)
 }
 
+// RecordLive записывает live стрим с отслеживанием MEDIA-SEQUENCE и DVR смещением
+func (t *Transcoder) RecordLive(ctx context.Context, config dto.HLSConfig) (*dto.LiveRecordResult, error) {
+	return t.hls.RecordLive(ctx, config)
+}
+
 // ConvertHLSToFormat загружает HLS и конвертирует в указанный формат
 func (t *Transcoder) ConvertHLSToFormat(ctx context.Context, hlsURL, outputPath, format string) error {
 	return t.hls.ConvertHLSToFormat(ctx, hlsURL, outputPath, format)
 }
 
+// Subscribe подписывает на события задач (канал с буфером buffer) и возвращает функцию отписки
+func (t *Transcoder) Subscribe(buffer int) (<-chan Event, func()) {
+	return t.events.Subscribe(buffer)
+}
+
+// SubscribeFunc регистрирует обработчик событий задач и возвращает функцию отписки
+func (t *Transcoder) SubscribeFunc(fn func(Event)) func() {
+	return t.events.SubscribeFunc(fn)
+}
+
 // SetLogger устанавливает кастомный логгер
 func (t *Transcoder) SetLogger(logger Logger) {
 	t.logger = logger
@@ -1,11 +1,16 @@
 package transcoder
 
 import (
+	"context"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/Mirsadikovv/ffmpeg_research/dto"
 	"github.com/Mirsadikovv/ffmpeg_research/presets"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
 	"github.com/Mirsadikovv/ffmpeg_research/utils"
 )
 
@@ -241,3 +246,388 @@ func TestIntegration(t *testing.T) {
 		t.Error("Информация о файле не должна быть nil")
 	}
 }
+
+// newFakeTranscoder создает транскодер со сценарным runner вместо реального FFmpeg
+func newFakeTranscoder(t *testing.T) (*Transcoder, *runner.FakeRunner) {
+	t.Helper()
+
+	fake := runner.NewFakeRunner()
+	tc, err := NewWithRunner("ffmpeg", fake)
+	if err != nil {
+		t.Fatalf("Ошибка создания транскодера: %v", err)
+	}
+	tc.SetLogger(NoOpLogger{})
+	return tc, fake
+}
+
+// newTestInput создает пустой входной файл для прохождения валидации
+func newTestInput(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "input.mp4")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatalf("Ошибка создания входного файла: %v", err)
+	}
+	return path
+}
+
+func TestExecuteWithFakeRunner(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffprobe", runner.FakeResponse{
+		Stdout: `{"format": {"duration": "10.0"}, "streams": []}`,
+	})
+	fake.AddResponse("ffmpeg", runner.FakeResponse{
+		Stdout: "out_time_us=5000000\nspeed=2.0x\nprogress=continue\n" +
+			"out_time_us=10000000\nspeed=2.0x\nprogress=end\n",
+	})
+
+	input := newTestInput(t)
+	job := tc.CreateJob(dto.Config{
+		InputPath:  input,
+		OutputPath: filepath.Join(filepath.Dir(input), "output.mp4"),
+		VideoCodec: "libx264",
+	})
+
+	var reported []float64
+	job.OnProgress = func(progress float64, speed string, eta time.Duration) {
+		reported = append(reported, progress)
+		if progress == 50 && eta != 2500*time.Millisecond {
+			t.Errorf("Ожидался ETA 2.5s, получен %v", eta)
+		}
+	}
+
+	if err := tc.Execute(context.Background(), job); err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	if len(reported) != 2 || reported[0] != 50 || reported[1] != 100 {
+		t.Errorf("Неожиданные значения прогресса: %v", reported)
+	}
+
+	if job.Status != dto.StatusCompleted || job.Speed != "2.0x" {
+		t.Errorf("Неожиданное состояние задачи: статус %d, скорость %s", job.Status, job.Speed)
+	}
+
+	calls := fake.CallsTo("ffmpeg")
+	last := calls[len(calls)-1]
+	if last.Args[0] != "-progress" || last.Args[1] != "pipe:1" {
+		t.Errorf("Ожидался вывод прогресса в pipe, аргументы: %v", last.Args)
+	}
+}
+
+func TestExecuteFailureWithFakeRunner(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{
+		Stderr:   "Unknown encoder 'libx264'\n",
+		ExitCode: 1,
+	})
+
+	input := newTestInput(t)
+	job := tc.CreateJob(dto.Config{
+		InputPath:  input,
+		OutputPath: filepath.Join(filepath.Dir(input), "output.mp4"),
+		VideoCodec: "libx264",
+	})
+
+	err := tc.Execute(context.Background(), job)
+
+	var ffErr *FFmpegError
+	if !errors.As(err, &ffErr) {
+		t.Fatalf("Ожидалась ошибка *FFmpegError, получена %v", err)
+	}
+	if ffErr.ExitCode != 1 || ffErr.Cause != CauseCodecNotFound {
+		t.Errorf("Неожиданная ошибка: код %d, причина %s", ffErr.ExitCode, ffErr.Cause)
+	}
+	if job.Status != dto.StatusFailed {
+		t.Errorf("Ожидался статус %d, получен %d", dto.StatusFailed, job.Status)
+	}
+}
+
+func TestGetMediaInfoWithFakeRunner(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffprobe", runner.FakeResponse{
+		Stdout: `{
+			"format": {"duration": "12.5", "size": "2048", "bit_rate": "1000"},
+			"streams": [
+				{"codec_type": "video", "width": 1280, "height": 720, "r_frame_rate": "30000/1001"},
+				{"codec_type": "audio", "sample_rate": "48000", "channels": 2}
+			]
+		}`,
+	})
+
+	info, err := tc.GetMediaInfo("input.mp4")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+
+	if info.Duration != 12500*time.Millisecond || info.GetResolution() != "1280x720" {
+		t.Errorf("Неожиданная информация: %s", info.Summary())
+	}
+	if !info.HasVideo || !info.HasAudio {
+		t.Error("Ожидались видео и аудио потоки")
+	}
+}
+
+// waitForJobs ожидает, пока все задачи очереди не покинут статусы ожидания и выполнения
+func waitForJobs(t *testing.T, queue *Queue) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		done := true
+		for _, job := range queue.GetJobs() {
+			if job.Status == dto.StatusPending || job.Status == dto.StatusRunning {
+				done = false
+			}
+		}
+		if done {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Задачи очереди не завершились вовремя")
+}
+
+func TestQueuePriorityOrder(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	input := newTestInput(t)
+	dir := filepath.Dir(input)
+
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+
+	outputs := []struct {
+		name     string
+		priority int
+	}{
+		{"low.mp4", 0},
+		{"high.mp4", 10},
+		{"low2.mp4", 0},
+		{"mid.mp4", 5},
+	}
+
+	for _, output := range outputs {
+		job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(dir, output.name)})
+		queue.AddJobWithPriority(job, output.priority)
+	}
+
+	queue.Start()
+	waitForJobs(t, queue)
+
+	var order []string
+	for _, call := range fake.CallsTo("ffmpeg") {
+		if len(call.Args) > 1 && call.Args[0] == "-progress" {
+			order = append(order, filepath.Base(call.Args[len(call.Args)-1]))
+		}
+	}
+
+	expected := []string{"high.mp4", "mid.mp4", "low.mp4", "low2.mp4"}
+	if len(order) != len(expected) {
+		t.Fatalf("Ожидалось %d запусков, получено %v", len(expected), order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("Ожидался порядок %v, получен %v", expected, order)
+			break
+		}
+	}
+
+	jobs := queue.GetJobs()
+	if len(jobs) != len(outputs) {
+		t.Errorf("Реестр должен хранить все задачи, получено %d", len(jobs))
+	}
+	if job, ok := queue.GetJob(jobs[0].ID); !ok || job.Status != dto.StatusCompleted {
+		t.Error("Завершенная задача должна быть доступна через GetJob")
+	}
+}
+
+func TestQueueOwnsJobCopy(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Stdout: "out_time_us=0\nprogress=end\n"})
+
+	input := newTestInput(t)
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "out.mp4")})
+
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+	queue.AddJob(job)
+	queue.Start()
+
+	// Чтение переданной задачи во время выполнения не должно гоняться с воркером
+	for i := 0; i < 10; i++ {
+		if job.Status != dto.StatusPending || job.Attempts != 0 {
+			t.Fatalf("Переданная задача не должна изменяться очередью: статус %d", job.Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	waitForJobs(t, queue)
+
+	if owned, _ := queue.GetJob(job.ID); owned.Status != dto.StatusCompleted || owned.Attempts != 1 {
+		t.Errorf("Ожидалась завершенная задача в очереди, статус %d, попыток %d", owned.Status, owned.Attempts)
+	}
+	if job.Status != dto.StatusPending {
+		t.Errorf("Переданная задача не должна изменяться очередью: статус %d", job.Status)
+	}
+
+	// Приоритет задается копии в очереди, а не переданной задаче
+	prioritized := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "prio.mp4")})
+	queue.AddJobWithPriority(prioritized, 7)
+	if prioritized.Priority != 0 {
+		t.Errorf("Переданная задача не должна изменяться: приоритет %d", prioritized.Priority)
+	}
+	if owned, _ := queue.GetJob(prioritized.ID); owned.Priority != 7 {
+		t.Errorf("Ожидался приоритет 7 у задачи в очереди, получен %d", owned.Priority)
+	}
+	waitForJobs(t, queue)
+}
+
+func TestQueueCancelPauseResume(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Delay: time.Minute})
+
+	input := newTestInput(t)
+	dir := filepath.Dir(input)
+
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+
+	running := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(dir, "a.mp4")})
+	waiting := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(dir, "b.mp4")})
+	runningID, waitingID := running.ID, waiting.ID
+	queue.AddJob(running)
+	queue.AddJob(waiting)
+	queue.Start()
+
+	waitForProcess(t, tc, runningID)
+
+	if err := queue.Pause(runningID); err != nil {
+		t.Fatalf("Ошибка приостановки: %v", err)
+	}
+	if job, _ := queue.GetJob(runningID); job.Status != dto.StatusPaused {
+		t.Errorf("Ожидался статус %d, получен %d", dto.StatusPaused, job.Status)
+	}
+	if err := queue.Resume(runningID); err != nil {
+		t.Fatalf("Ошибка возобновления: %v", err)
+	}
+
+	if err := queue.Cancel(waitingID); err != nil {
+		t.Fatalf("Ошибка отмены ожидающей задачи: %v", err)
+	}
+	if err := queue.Cancel(runningID); err != nil {
+		t.Fatalf("Ошибка отмены выполняемой задачи: %v", err)
+	}
+
+	waitForJobs(t, queue)
+
+	for _, id := range []string{runningID, waitingID} {
+		if job, _ := queue.GetJob(id); job.Status != dto.StatusCancelled {
+			t.Errorf("Задача %s: ожидался статус %d, получен %d", id, dto.StatusCancelled, job.Status)
+		}
+	}
+
+	if err := queue.Cancel(runningID); !errors.Is(err, ErrJobNotActive) {
+		t.Errorf("Повторная отмена должна вернуть ErrJobNotActive, получено %v", err)
+	}
+	if err := queue.Cancel("unknown"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Ожидалась ErrJobNotFound, получено %v", err)
+	}
+}
+
+func TestQueueCancelBeforeStart(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+
+	input := newTestInput(t)
+	queue := NewQueue(tc, 1)
+	defer queue.Stop()
+
+	job := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(filepath.Dir(input), "out.mp4")})
+	queue.AddJob(job)
+
+	// Задача покинула очередь ожидания, но воркер еще не запустил FFmpeg
+	before := len(fake.CallsTo("ffmpeg"))
+	next, ctx := queue.getNextJob()
+	if err := queue.Cancel(next.ID); err != nil {
+		t.Fatalf("Ошибка отмены: %v", err)
+	}
+	queue.runJob(ctx, next)
+	queue.running.Done()
+
+	if got, _ := queue.GetJob(job.ID); got.Status != dto.StatusCancelled || got.Attempts != 0 {
+		t.Errorf("Ожидалась отмененная задача без попыток, статус %d, попыток %d", got.Status, got.Attempts)
+	}
+	if calls := fake.CallsTo("ffmpeg"); len(calls) != before {
+		t.Errorf("FFmpeg не должен запускаться для отмененной задачи: %d новых вызовов", len(calls)-before)
+	}
+}
+
+// waitForProcess ожидает запуска процесса FFmpeg задачи
+func waitForProcess(t *testing.T, tc *Transcoder, jobID string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := tc.process(jobID); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Процесс задачи %s не был запущен", jobID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueShutdown(t *testing.T) {
+	tc, fake := newFakeTranscoder(t)
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Delay: time.Minute})
+	fake.AddResponse("ffmpeg", runner.FakeResponse{Delay: 50 * time.Millisecond})
+
+	input := newTestInput(t)
+	dir := filepath.Dir(input)
+
+	queue := NewQueue(tc, 2)
+	queue.Start()
+
+	slowOutput := filepath.Join(dir, "slow.mp4")
+	slow := tc.CreateJob(dto.Config{InputPath: input, OutputPath: slowOutput})
+	fast := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(dir, "fast.mp4")})
+	waiting := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(dir, "waiting.mp4")})
+	slowID, fastID, waitingID := slow.ID, fast.ID, waiting.ID
+
+	queue.AddJob(slow)
+	waitForProcess(t, tc, slowID)
+	queue.AddJob(fast)
+	waitForProcess(t, tc, fastID)
+	queue.AddJob(waiting)
+
+	// Частично записанный выходной файл прерываемой задачи
+	if err := os.WriteFile(slowOutput, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	summary, err := queue.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ожидалась ошибка истечения срока, получено %v", err)
+	}
+
+	if len(summary.Completed) != 1 || summary.Completed[0] != fastID {
+		t.Errorf("Неожиданный список завершенных: %v", summary.Completed)
+	}
+	if len(summary.Interrupted) != 1 || summary.Interrupted[0] != slowID {
+		t.Errorf("Неожиданный список прерванных: %v", summary.Interrupted)
+	}
+	if len(summary.Pending) != 1 || summary.Pending[0] != waitingID {
+		t.Errorf("Неожиданный список ожидающих: %v", summary.Pending)
+	}
+
+	if _, err := os.Stat(slowOutput); !os.IsNotExist(err) {
+		t.Error("Частичный файл прерванной задачи должен быть удален")
+	}
+
+	extra := tc.CreateJob(dto.Config{InputPath: input, OutputPath: filepath.Join(dir, "extra.mp4")})
+	if err := queue.AddJob(extra); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("После остановки ожидалась ErrQueueClosed, получено %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
+)
+
+// ValidateMasterPlaylist проверяет мастер-плейлист: BANDWIDTH, согласованность
+// CODECS с RESOLUTION и группой AUDIO, ссылки на группы EXT-X-MEDIA
+func ValidateMasterPlaylist(p *m3u8.MasterPlaylist) []dto.ConformanceIssue {
+	var issues []dto.ConformanceIssue
+	add := func(severity, rule, format string, args ...any) {
+		issues = append(issues, dto.ConformanceIssue{Severity: severity, Rule: rule, URI: p.URL, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(p.Variants) == 0 {
+		add(dto.SeverityError, dto.RuleSyntax, "мастер-плейлист не содержит EXT-X-STREAM-INF")
+	}
+
+	variants := append(append([]m3u8.Variant(nil), p.Variants...), p.IFrameVariants...)
+	for _, variant := range variants {
+		name := variant.URI
+		if variant.Bandwidth <= 0 {
+			add(dto.SeverityError, dto.RuleBandwidth, "у варианта %s нет BANDWIDTH", name)
+		} else if variant.AverageBandwidth > variant.Bandwidth {
+			add(dto.SeverityWarning, dto.RuleBandwidth, "у варианта %s AVERAGE-BANDWIDTH (%d) больше BANDWIDTH (%d)", name, variant.AverageBandwidth, variant.Bandwidth)
+		}
+
+		if variant.Codecs == "" {
+			add(dto.SeverityWarning, dto.RuleCodecs, "у варианта %s нет CODECS", name)
+		} else {
+			if variant.Resolution != "" && VideoCodecFamily(variant.Codecs) == "" {
+				add(dto.SeverityError, dto.RuleCodecs, "у варианта %s указан RESOLUTION, но CODECS (%s) не содержит видеокодек", name, variant.Codecs)
+			}
+			if variant.Audio != "" && !hasAudioCodec(variant.Codecs) {
+				add(dto.SeverityError, dto.RuleCodecs, "у варианта %s указана группа AUDIO, но CODECS (%s) не содержит аудиокодек", name, variant.Codecs)
+			}
+		}
+
+		groups := []struct{ renditionType, groupID string }{
+			{m3u8.RenditionAudio, variant.Audio},
+			{m3u8.RenditionVideo, variant.Video},
+			{m3u8.RenditionSubtitles, variant.Subtitles},
+			{m3u8.RenditionClosedCaptions, variant.ClosedCaptions},
+		}
+		for _, group := range groups {
+			if group.groupID == "" || group.groupID == "NONE" {
+				continue
+			}
+			if len(p.Group(group.renditionType, group.groupID)) == 0 {
+				add(dto.SeverityError, dto.RuleRenditionGroup, "вариант %s ссылается на несуществующую группу %s %q", name, group.renditionType, group.groupID)
+			}
+		}
+	}
+
+	defaults := make(map[string]int)
+	for _, rendition := range p.Renditions {
+		if !rendition.Default {
+			continue
+		}
+		group := rendition.Type + " " + rendition.GroupID
+		if defaults[group]++; defaults[group] == 2 {
+			add(dto.SeverityError, dto.RuleRenditionGroup, "в группе %s несколько представлений с DEFAULT=YES", group)
+		}
+	}
+
+	return issues
+}
+
+// ValidateMediaPlaylist проверяет медиаплейлист: EXTINF не больше
+// TARGETDURATION, EXT-X-ENDLIST у VOD, длительности сегментов и частей
+func ValidateMediaPlaylist(p *m3u8.MediaPlaylist) []dto.ConformanceIssue {
+	var issues []dto.ConformanceIssue
+	add := func(severity, rule, format string, args ...any) {
+		issues = append(issues, dto.ConformanceIssue{Severity: severity, Rule: rule, URI: p.URL, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.TargetDuration <= 0 {
+		add(dto.SeverityError, dto.RuleTargetDuration, "нет EXT-X-TARGETDURATION")
+	}
+	if p.PlaylistType == "VOD" && !p.EndList {
+		add(dto.SeverityError, dto.RuleEndList, "плейлист VOD без EXT-X-ENDLIST")
+	}
+	if len(p.Segments) == 0 && p.EndList {
+		add(dto.SeverityError, dto.RuleSyntax, "завершенный плейлист не содержит сегментов")
+	}
+
+	for i, segment := range p.Segments {
+		// EXTINF, округленный до целых секунд, не должен превышать TARGETDURATION (RFC 8216, 4.3.3.1)
+		if p.TargetDuration > 0 && roundSeconds(segment.Duration) > roundSeconds(p.TargetDuration) {
+			add(dto.SeverityError, dto.RuleTargetDuration, "сегмент %d длиннее TARGETDURATION: %v > %v", segment.Sequence, segment.Duration, p.TargetDuration)
+		}
+
+		// Короткие сегменты допустимы в конце плейлиста и перед разрывом
+		last := i == len(p.Segments)-1
+		if !last && !p.Segments[i+1].Discontinuity && segment.Duration < p.TargetDuration/2 {
+			add(dto.SeverityWarning, dto.RuleSegmentDuration, "сегмент %d (%v) короче половины TARGETDURATION", segment.Sequence, segment.Duration)
+		}
+
+		issues = append(issues, validateParts(p, segment.Sequence, segment.Parts)...)
+	}
+	issues = append(issues, validateParts(p, p.MediaSequence+int64(len(p.Segments)), p.PendingParts)...)
+
+	return issues
+}
+
+// validateParts проверяет части сегмента по PART-TARGET
+func validateParts(p *m3u8.MediaPlaylist, sequence int64, parts []m3u8.PartialSegment) []dto.ConformanceIssue {
+	if len(parts) == 0 {
+		return nil
+	}
+	if p.PartTargetDuration <= 0 {
+		return []dto.ConformanceIssue{{
+			Severity: dto.SeverityError, Rule: dto.RulePartDuration, URI: p.URL,
+			Message: fmt.Sprintf("у сегмента %d есть EXT-X-PART, но нет EXT-X-PART-INF", sequence),
+		}}
+	}
+
+	var issues []dto.ConformanceIssue
+	for i, part := range parts {
+		if part.Duration > p.PartTargetDuration {
+			issues = append(issues, dto.ConformanceIssue{
+				Severity: dto.SeverityError, Rule: dto.RulePartDuration, URI: p.URL,
+				Message: fmt.Sprintf("часть %d сегмента %d длиннее PART-TARGET: %v > %v", i, sequence, part.Duration, p.PartTargetDuration),
+			})
+		}
+	}
+	return issues
+}
+
+// ValidatePlaylistReload сравнивает два последовательных обновления live
+// плейлиста: MEDIA-SEQUENCE и DISCONTINUITY-SEQUENCE не уменьшаются,
+// сегменты с одним номером не меняются (RFC 8216, 6.2.2)
+func ValidatePlaylistReload(prev, next *m3u8.MediaPlaylist) []dto.ConformanceIssue {
+	var issues []dto.ConformanceIssue
+	add := func(format string, args ...any) {
+		issues = append(issues, dto.ConformanceIssue{Severity: dto.SeverityError, Rule: dto.RuleMediaSequence, URI: next.URL, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if next.MediaSequence < prev.MediaSequence {
+		add("MEDIA-SEQUENCE уменьшился при обновлении: %d -> %d", prev.MediaSequence, next.MediaSequence)
+	}
+	if next.DiscontinuitySequence < prev.DiscontinuitySequence {
+		add("DISCONTINUITY-SEQUENCE уменьшился при обновлении: %d -> %d", prev.DiscontinuitySequence, next.DiscontinuitySequence)
+	}
+
+	previous := make(map[int64]string, len(prev.Segments))
+	for _, segment := range prev.Segments {
+		previous[segment.Sequence] = segment.URI
+	}
+	for _, segment := range next.Segments {
+		if uri, exists := previous[segment.Sequence]; exists && uri != segment.URI {
+			add("сегмент %d изменился при обновлении: %s -> %s", segment.Sequence, uri, segment.URI)
+		}
+	}
+
+	return issues
+}
+
+// hasAudioCodec проверяет, есть ли в CODECS аудиокодек
+func hasAudioCodec(codecs string) bool {
+	for _, codec := range strings.Split(codecs, ",") {
+		if audioCodecFamilies[codecFamily(codec)] {
+			return true
+		}
+	}
+	return false
+}
+
+// roundSeconds округляет длительность до целых секунд
+func roundSeconds(duration time.Duration) int64 {
+	return int64(math.Round(duration.Seconds()))
+}
@@ -0,0 +1,244 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// Ранги источников ссылок; ссылки из iframe получают штраф iframePenalty
+var sourceScores = map[string]int{
+	dto.SourceSourceTag: 100,
+	dto.SourceVideoTag:  90,
+	dto.SourceAttribute: 70,
+	dto.SourceScript:    50,
+	dto.SourceText:      30,
+}
+
+const iframePenalty = 20
+
+var (
+	tagPattern       = regexp.MustCompile(`(?s)<([a-zA-Z][\w-]*)\b([^>]*)>`)
+	attributePattern = regexp.MustCompile(`(?s)([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	quotedPattern    = regexp.MustCompile(`["']([^"'\s<>]+?\.(?:m3u8|mpd)(?:[?#][^"'\s<>]*)?)["']`)
+	absolutePattern  = regexp.MustCompile(`https?://[^\s"'<>\\]+?\.(?:m3u8|mpd)(?:[?#][^\s"'<>\\]*)?`)
+	jsonEscapes      = strings.NewReplacer(`\/`, "/", `\u002F`, "/", `\u002f`, "/", `\u0026`, "&", `\u003D`, "=", `\u003d`, "=")
+)
+
+// manifestTypes MIME типы манифестов в атрибуте type тега <source>
+var manifestTypes = map[string]string{
+	"application/x-mpegurl":         dto.ManifestHLS,
+	"application/vnd.apple.mpegurl": dto.ManifestHLS,
+	"audio/mpegurl":                 dto.ManifestHLS,
+	"application/dash+xml":          dto.ManifestDASH,
+}
+
+// FindPlaylistURL пытается найти плейлист по URL страницы: возвращает
+// лучший кандидат DiscoverPlaylists с переходом в iframe
+func FindPlaylistURL(pageURL string, client *http.Client) (string, error) {
+	fetch := func(ctx context.Context, pageURL string) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("ошибка HTTP: %d", resp.StatusCode)
+		}
+		content, err := io.ReadAll(resp.Body)
+		return string(content), err
+	}
+
+	candidates, err := DiscoverPlaylists(context.Background(), pageURL, fetch)
+	if err != nil {
+		return "", err
+	}
+	return candidates[0].URL, nil
+}
+
+// DiscoverPlaylists загружает страницу через fetch и возвращает все найденные
+// манифесты HLS и DASH по убыванию ранга. Iframe страницы загружаются на
+// один уровень вглубь; их ошибки загрузки пропускаются.
+func DiscoverPlaylists(ctx context.Context, pageURL string, fetch func(ctx context.Context, url string) (string, error)) ([]dto.PlaylistCandidate, error) {
+	content, err := fetch(ctx, pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки страницы: %w", err)
+	}
+
+	candidates, iframes := ParsePlaylistCandidates(content, pageURL)
+	for _, frameURL := range iframes {
+		frame, err := fetch(ctx, frameURL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+
+		found, _ := ParsePlaylistCandidates(frame, frameURL)
+		for _, candidate := range found {
+			candidate.Score -= iframePenalty
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	candidates = rankCandidates(candidates)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("плейлист не найден на странице")
+	}
+	return candidates, nil
+}
+
+// ParsePlaylistCandidates ищет ссылки на манифесты в HTML странице:
+// теги <source> и <video>, атрибуты, строки в скриптах (в том числе
+// JSON с экранированием \/) и абсолютные URL в тексте. Относительные ссылки
+// разрешаются относительно pageURL. Также возвращает адреса iframe.
+func ParsePlaylistCandidates(content, pageURL string) ([]dto.PlaylistCandidate, []string) {
+	var (
+		candidates []dto.PlaylistCandidate
+		iframes    []string
+	)
+	add := func(raw, source, kind string) {
+		resolved, ok := resolvePageURL(pageURL, raw)
+		if !ok {
+			return
+		}
+		if kind == "" {
+			if kind = manifestKind(resolved); kind == "" {
+				return
+			}
+		}
+		candidates = append(candidates, dto.PlaylistCandidate{
+			URL:    resolved,
+			Kind:   kind,
+			Source: source,
+			Page:   pageURL,
+			Score:  sourceScores[source],
+		})
+	}
+
+	for _, tag := range tagPattern.FindAllStringSubmatch(content, -1) {
+		name, attrs := strings.ToLower(tag[1]), parseTagAttributes(tag[2])
+
+		switch name {
+		case "iframe":
+			if resolved, ok := resolvePageURL(pageURL, attributeValue(attrs, "src")); ok {
+				iframes = append(iframes, resolved)
+			}
+		case "source":
+			add(attributeValue(attrs, "src"), dto.SourceSourceTag, manifestTypes[strings.ToLower(attributeValue(attrs, "type"))])
+		case "video":
+			add(attributeValue(attrs, "src"), dto.SourceVideoTag, "")
+		}
+		for _, attr := range attrs {
+			if attr.name != "src" || (name != "source" && name != "video") {
+				add(attr.value, dto.SourceAttribute, "")
+			}
+		}
+	}
+
+	unescaped := jsonEscapes.Replace(content)
+	for _, match := range quotedPattern.FindAllStringSubmatch(unescaped, -1) {
+		add(match[1], dto.SourceScript, "")
+	}
+	for _, match := range absolutePattern.FindAllString(unescaped, -1) {
+		add(match, dto.SourceText, "")
+	}
+
+	return candidates, UniqueStrings(iframes)
+}
+
+// tagAttribute атрибут HTML тега
+type tagAttribute struct {
+	name  string // Имя в нижнем регистре
+	value string
+}
+
+// parseTagAttributes разбирает атрибуты тега с раскрытием HTML сущностей
+// в порядке их следования, чтобы порядок кандидатов был детерминированным
+func parseTagAttributes(attributes string) []tagAttribute {
+	var attrs []tagAttribute
+	for _, match := range attributePattern.FindAllStringSubmatch(attributes, -1) {
+		attrs = append(attrs, tagAttribute{
+			name:  strings.ToLower(match[1]),
+			value: html.UnescapeString(match[2] + match[3] + match[4]),
+		})
+	}
+	return attrs
+}
+
+// attributeValue возвращает значение первого атрибута с именем name,
+// как это делает браузер при повторах
+func attributeValue(attrs []tagAttribute, name string) string {
+	for _, attr := range attrs {
+		if attr.name == name {
+			return attr.value
+		}
+	}
+	return ""
+}
+
+// resolvePageURL разрешает ссылку относительно страницы; подходят только http(s)
+func resolvePageURL(pageURL, raw string) (string, bool) {
+	raw = strings.TrimSpace(html.UnescapeString(raw))
+	if raw == "" {
+		return "", false
+	}
+
+	resolved, err := url.Parse(ResolveURL(pageURL, raw))
+	if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") || resolved.Host == "" {
+		return "", false
+	}
+	resolved.Fragment = ""
+	return resolved.String(), true
+}
+
+// manifestKind определяет тип манифеста по расширению пути
+func manifestKind(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	switch strings.ToLower(path.Ext(parsed.Path)) {
+	case ".m3u8":
+		return dto.ManifestHLS
+	case ".mpd":
+		return dto.ManifestDASH
+	}
+	return ""
+}
+
+// rankCandidates убирает повторы, оставляя лучший ранг, и сортирует по
+// убыванию ранга с сохранением порядка на странице
+func rankCandidates(candidates []dto.PlaylistCandidate) []dto.PlaylistCandidate {
+	best := make(map[string]int)
+	var ranked []dto.PlaylistCandidate
+	for _, candidate := range candidates {
+		if index, exists := best[candidate.URL]; exists {
+			if candidate.Score > ranked[index].Score {
+				ranked[index] = candidate
+			}
+			continue
+		}
+		best[candidate.URL] = len(ranked)
+		ranked = append(ranked, candidate)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	return ranked
+}
@@ -1,16 +1,26 @@
 package utils
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"strconv"
+	"strings"
 
 	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/runner"
 )
 
 // CheckFFmpeg проверяет доступность FFmpeg
 func CheckFFmpeg(path string) error {
-	cmd := exec.Command(path, "-version")
-	return cmd.Run()
+	return CheckFFmpegWithRunner(runner.NewExecRunner(), path)
+}
+
+// CheckFFmpegWithRunner проверяет доступность FFmpeg через указанный runner
+func CheckFFmpegWithRunner(r runner.CommandRunner, path string) error {
+	return runner.Run(context.Background(), r, runner.Command{
+		Path: path,
+		Args: []string{"-version"},
+	})
 }
 
 // BuildFFmpegArgs строит аргументы для FFmpeg
@@ -64,6 +74,27 @@ func BuildFFmpegArgs(config dto.Config) []string {
 	return args
 }
 
+// ParseBitrate преобразует битрейт в формате FFmpeg ("2500k", "2M", "128000") в бит/с
+func ParseBitrate(bitrate string) (int64, error) {
+	value := strings.TrimSpace(bitrate)
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(value, "k"), strings.HasSuffix(value, "K"):
+		multiplier = 1000
+	case strings.HasSuffix(value, "m"), strings.HasSuffix(value, "M"):
+		multiplier = 1000000
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("некорректный битрейт '%s'", bitrate)
+	}
+	return number * multiplier, nil
+}
+
 // GetCodecsForFormat возвращает подходящие кодеки для формата
 func GetCodecsForFormat(format string) (videoCodec, audioCodec, audioBitrate string) {
 	switch format {
@@ -86,29 +117,15 @@ func GetCodecsForFormat(format string) (videoCodec, audioCodec, audioBitrate str
 	}
 }
 
-// BuildHLSArgs строит аргументы для загрузки HLS
+// BuildHLSArgs строит аргументы для загрузки HLS. Опции HTTP
+// (BuildHTTPInputArgs) стоят перед -i, иначе FFmpeg применяет их к выходу.
 func BuildHLSArgs(ffmpegPath, streamURL string, config dto.HLSConfig) []string {
-	args := []string{
+	args := BuildHTTPInputArgs(config)
+	args = append(args,
 		"-i", streamURL,
 		"-c", "copy", // копируем без перекодирования для скорости
 		"-y", // перезаписывать файл
-	}
-
-	// Добавляем заголовки если есть
-	if len(config.Headers) > 0 {
-		headers := make([]string, 0)
-		for key, value := range config.Headers {
-			headers = append(headers, fmt.Sprintf("%s: %s", key, value))
-		}
-		args = append(args, "-headers", fmt.Sprintf("%s", headers))
-	}
-
-	// User-Agent
-	userAgent := config.UserAgent
-	if userAgent == "" {
-		userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
-	}
-	args = append(args, "-user_agent", userAgent)
+	)
 
 	// Ограничение по времени
 	if config.Duration > 0 {
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// DefaultUserAgent User-Agent для HTTP запросов по умолчанию
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"
+
+// DecorateRequest добавляет к запросу User-Agent, Referer, заголовки и
+// cookies из конфигурации. Те же параметры FFmpeg получает через
+// BuildHTTPInputArgs.
+func DecorateRequest(req *http.Request, config dto.HLSConfig) {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	if config.Referer != "" {
+		req.Header.Set("Referer", config.Referer)
+	}
+	for key, value := range config.Headers {
+		req.Header.Set(key, value)
+	}
+	if config.Cookies != "" {
+		req.Header.Set("Cookie", config.Cookies)
+	}
+}
+
+// NewHTTPClient создает HTTP клиент с прокси, корневыми сертификатами и
+// ограничениями нагрузки из конфигурации. Сертификаты CABundle дополняют
+// системные. При ограничениях нагрузки timeout ограничивает ожидание
+// заголовков ответа и паузу между порциями тела, а не чтение тела целиком,
+// которое замедляется намеренно.
+func NewHTTPClient(config dto.HLSConfig, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный адрес прокси: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if config.CABundle != "" {
+		pool, err := loadCABundle(config.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	client := CreateHTTPClient(timeout)
+	client.Transport = transport
+	if HasHostLimits(config) {
+		transport.ResponseHeaderTimeout = client.Timeout
+		client.Timeout = 0
+		client.Transport = NewThrottledTransport(transport, config, timeout)
+	}
+	return client, nil
+}
+
+// loadCABundle добавляет сертификаты из PEM файла к системным
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения CA bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("CA bundle %s не содержит сертификатов PEM", path)
+	}
+	return pool, nil
+}
+
+// BuildHTTPInputArgs строит опции HTTP входа FFmpeg (User-Agent, Referer,
+// заголовки, cookies, прокси, CA bundle). Опции должны стоять перед
+// соответствующим -i.
+func BuildHTTPInputArgs(config dto.HLSConfig) []string {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	args := []string{"-user_agent", userAgent}
+
+	if config.Referer != "" {
+		args = append(args, "-referer", config.Referer)
+	}
+
+	keys := make([]string, 0, len(config.Headers))
+	for key := range config.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var headers strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&headers, "%s: %s\r\n", key, config.Headers[key])
+	}
+	if config.Cookies != "" {
+		fmt.Fprintf(&headers, "Cookie: %s\r\n", config.Cookies)
+	}
+	if headers.Len() > 0 {
+		args = append(args, "-headers", headers.String())
+	}
+
+	if config.Proxy != "" {
+		args = append(args, "-http_proxy", config.Proxy)
+	}
+	if config.CABundle != "" {
+		args = append(args, "-ca_file", config.CABundle, "-tls_verify", "1")
+	}
+
+	return args
+}
+
+// CheckFFmpegProxy проверяет, что прокси из конфигурации поддерживается
+// FFmpeg: протокол http FFmpeg работает только через HTTP прокси
+func CheckFFmpegProxy(config dto.HLSConfig) error {
+	if config.Proxy == "" {
+		return nil
+	}
+
+	proxyURL, err := url.Parse(config.Proxy)
+	if err != nil {
+		return fmt.Errorf("некорректный адрес прокси: %w", err)
+	}
+	if !strings.EqualFold(proxyURL.Scheme, "http") {
+		return fmt.Errorf("FFmpeg не поддерживает прокси %s://, используйте http:// или нативную загрузку VOD", proxyURL.Scheme)
+	}
+	return nil
+}
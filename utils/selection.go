@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// codecAliases приводит названия кодеков к семействам из атрибута CODECS
+var codecAliases = map[string]string{
+	"h264": "avc1", "avc": "avc1", "avc3": "avc1",
+	"h265": "hvc1", "hevc": "hvc1", "hev1": "hvc1",
+	"av1":  "av01",
+	"vp9":  "vp09",
+	"dvhe": "dvh1",
+}
+
+// audioCodecFamilies семейства аудиокодеков, которые пропускаются при определении видеокодека
+var audioCodecFamilies = map[string]bool{
+	"mp4a": true, "ac-3": true, "ec-3": true, "ac-4": true,
+	"opus": true, "flac": true, "alac": true, "mp3": true,
+}
+
+// SelectVariant выбирает поток по политикам конфигурации (см. SelectVariantIndex)
+func SelectVariant(info *dto.PlaylistInfo, config dto.HLSConfig) (string, error) {
+	if len(info.Streams) == 0 {
+		return info.URL, nil // Возвращаем исходный URL если нет вариантов
+	}
+
+	index, err := SelectVariantIndex(info.Streams, config)
+	if err != nil {
+		return "", err
+	}
+	return info.Streams[index].URL, nil
+}
+
+// SelectVariantIndex возвращает индекс потока с учетом политик конфигурации:
+// StreamSelector, если задан; иначе ограничения MaxWidth, MaxHeight и
+// MaxBandwidth (если им не соответствует ни один поток, берется самый
+// низкий по битрейту), затем предпочтения PreferCodecs и PreferFrameRate
+// и, наконец, Quality среди оставшихся потоков.
+func SelectVariantIndex(streams []dto.StreamInfo, config dto.HLSConfig) (int, error) {
+	if len(streams) == 0 {
+		return 0, fmt.Errorf("нет доступных потоков")
+	}
+
+	if config.StreamSelector != nil {
+		index, err := config.StreamSelector(streams)
+		if err != nil {
+			return 0, fmt.Errorf("ошибка выбора потока: %w", err)
+		}
+		if index < 0 || index >= len(streams) {
+			return 0, fmt.Errorf("выбран несуществующий поток %d из %d", index, len(streams))
+		}
+		return index, nil
+	}
+
+	candidates := make([]int, len(streams))
+	for i := range streams {
+		candidates[i] = i
+	}
+
+	candidates = filterStreams(candidates, func(i int) bool { return withinLimits(streams[i], config) })
+	if len(candidates) == 0 {
+		index, _ := SelectStreamIndex(streams, "worst")
+		return index, nil
+	}
+
+	for _, codec := range config.PreferCodecs {
+		family := codecFamily(codec)
+		if preferred := filterStreams(candidates, func(i int) bool {
+			return VideoCodecFamily(streams[i].Codecs) == family
+		}); len(preferred) > 0 {
+			candidates = preferred
+			break
+		}
+	}
+
+	if config.PreferFrameRate > 0 {
+		candidates = nearestFrameRate(streams, candidates, config.PreferFrameRate)
+	}
+
+	subset := make([]dto.StreamInfo, len(candidates))
+	for i, index := range candidates {
+		subset[i] = streams[index]
+	}
+
+	index, err := SelectStreamIndex(subset, config.Quality)
+	if err != nil && config.NearestResolution {
+		index, err = nearestResolution(subset, config.Quality)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return candidates[index], nil
+}
+
+// VideoCodecFamily возвращает семейство видеокодека из атрибута CODECS
+// ("avc1.64001f,mp4a.40.2" -> "avc1") или пустую строку
+func VideoCodecFamily(codecs string) string {
+	for _, codec := range strings.Split(codecs, ",") {
+		if family := codecFamily(codec); family != "" && !audioCodecFamilies[family] {
+			return family
+		}
+	}
+	return ""
+}
+
+// codecFamily приводит кодек к семейству: "hev1.1.6.L93" -> "hvc1", "h264" -> "avc1"
+func codecFamily(codec string) string {
+	family, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(codec)), ".")
+	if alias, exists := codecAliases[family]; exists {
+		return alias
+	}
+	return family
+}
+
+// withinLimits проверяет ограничения разрешения и битрейта.
+// Потоки без RESOLUTION ограничениям разрешения не подлежат.
+func withinLimits(stream dto.StreamInfo, config dto.HLSConfig) bool {
+	if config.MaxBandwidth > 0 && stream.Bandwidth > config.MaxBandwidth {
+		return false
+	}
+
+	width, height, ok := parseResolution(stream.Resolution)
+	if !ok {
+		return true
+	}
+	if config.MaxWidth > 0 && width > config.MaxWidth {
+		return false
+	}
+	return config.MaxHeight == 0 || height <= config.MaxHeight
+}
+
+// nearestFrameRate оставляет потоки с частотой кадров, ближайшей к желаемой.
+// Потоки без FRAME-RATE остаются, только если частота не указана ни у одного.
+func nearestFrameRate(streams []dto.StreamInfo, candidates []int, fps float64) []int {
+	best := math.Inf(1)
+	for _, i := range candidates {
+		if streams[i].FrameRate > 0 {
+			best = math.Min(best, math.Abs(streams[i].FrameRate-fps))
+		}
+	}
+	if math.IsInf(best, 1) {
+		return candidates
+	}
+
+	return filterStreams(candidates, func(i int) bool {
+		// Допуск на округление (29.97 и 30000/1001)
+		return streams[i].FrameRate > 0 && math.Abs(streams[i].FrameRate-fps)-best < 0.01
+	})
+}
+
+// nearestResolution выбирает поток с площадью кадра, ближайшей к разрешению
+// quality; при равенстве - с большим битрейтом
+func nearestResolution(streams []dto.StreamInfo, quality string) (int, error) {
+	width, height, ok := parseResolution(quality)
+	if !ok {
+		return 0, fmt.Errorf("поток с качеством %s не найден", quality)
+	}
+	target := float64(width * height)
+
+	best, bestDistance := -1, math.Inf(1)
+	for i, stream := range streams {
+		w, h, ok := parseResolution(stream.Resolution)
+		if !ok {
+			continue
+		}
+
+		distance := math.Abs(float64(w*h) - target)
+		if distance < bestDistance || (distance == bestDistance && stream.Bandwidth > streams[best].Bandwidth) {
+			best, bestDistance = i, distance
+		}
+	}
+	if best < 0 {
+		return 0, fmt.Errorf("поток с качеством %s не найден: у потоков не указано разрешение", quality)
+	}
+	return best, nil
+}
+
+// parseResolution разбирает разрешение вида WIDTHxHEIGHT
+func parseResolution(resolution string) (int, int, bool) {
+	var width, height int
+	if _, err := fmt.Sscanf(resolution, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// filterStreams возвращает индексы, удовлетворяющие условию
+func filterStreams(indexes []int, keep func(int) bool) []int {
+	var kept []int
+	for _, i := range indexes {
+		if keep(i) {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,265 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mirsadikovv/ffmpeg_research/dto"
+)
+
+// DefaultMaxRetryAfter предел ожидания по Retry-After, если MaxRetryAfter не задан
+const DefaultMaxRetryAfter = time.Minute
+
+// ThrottledTransport ограничивает нагрузку на каждый хост: скорость чтения
+// тела ответа, частоту запросов и число одновременных соединений. Ответ
+// 429 или 503 с Retry-After приостанавливает все запросы к хосту.
+// Соединение считается занятым до закрытия тела ответа.
+type ThrottledTransport struct {
+	base              http.RoundTripper
+	bytesPerSecond    int64
+	requestsPerSecond float64
+	maxConnections    int
+	maxRetryAfter     time.Duration
+	idleTimeout       time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+// hostLimiter состояние ограничений одного хоста
+type hostLimiter struct {
+	slots chan struct{} // nil - без ограничения соединений
+
+	mu          sync.Mutex
+	nextRequest time.Time // Не раньше этого момента начинается следующий запрос
+	nextByte    time.Time // Момент, когда прочитанные байты укладываются в лимит
+	pausedUntil time.Time // Retry-After
+}
+
+// HasHostLimits сообщает, заданы ли в конфигурации ограничения нагрузки
+func HasHostLimits(config dto.HLSConfig) bool {
+	return config.RateLimit > 0 || config.RequestsPerSecond > 0 || config.MaxConnections > 0
+}
+
+// NewThrottledTransport оборачивает base ограничениями из конфигурации
+// (RateLimit, RequestsPerSecond, MaxConnections, MaxRetryAfter). Если данные
+// тела ответа не приходят дольше idleTimeout, чтение завершается ошибкой
+// (0 = без ограничения).
+func NewThrottledTransport(base http.RoundTripper, config dto.HLSConfig, idleTimeout time.Duration) *ThrottledTransport {
+	maxRetryAfter := config.MaxRetryAfter
+	if maxRetryAfter <= 0 {
+		maxRetryAfter = DefaultMaxRetryAfter
+	}
+
+	return &ThrottledTransport{
+		base:              base,
+		bytesPerSecond:    config.RateLimit,
+		requestsPerSecond: config.RequestsPerSecond,
+		maxConnections:    config.MaxConnections,
+		maxRetryAfter:     maxRetryAfter,
+		idleTimeout:       idleTimeout,
+		hosts:             make(map[string]*hostLimiter),
+	}
+}
+
+// RoundTrip выполняет запрос после ожидания свободного соединения,
+// Retry-After и интервала между запросами
+func (t *ThrottledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	limiter := t.host(req.URL.Host)
+
+	if limiter.slots != nil {
+		select {
+		case limiter.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if limiter.slots != nil {
+			<-limiter.slots
+		}
+	}
+
+	if err := sleepUntil(ctx, limiter.reserveRequest(t.requestsPerSecond)); err != nil {
+		release()
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if delay, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			limiter.pause(time.Now().Add(min(delay, t.maxRetryAfter)))
+		}
+	}
+
+	resp.Body = &throttledBody{
+		ReadCloser:     resp.Body,
+		ctx:            ctx,
+		limiter:        limiter,
+		bytesPerSecond: t.bytesPerSecond,
+		idleTimeout:    t.idleTimeout,
+		release:        release,
+	}
+	return resp, nil
+}
+
+// host возвращает состояние хоста, создавая его при первом запросе
+func (t *ThrottledTransport) host(host string) *hostLimiter {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limiter, exists := t.hosts[host]
+	if !exists {
+		limiter = &hostLimiter{}
+		if t.maxConnections > 0 {
+			limiter.slots = make(chan struct{}, t.maxConnections)
+		}
+		t.hosts[host] = limiter
+	}
+	return limiter
+}
+
+// reserveRequest резервирует момент начала запроса с учетом частоты и паузы
+func (l *hostLimiter) reserveRequest(requestsPerSecond float64) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := time.Now()
+	if l.pausedUntil.After(start) {
+		start = l.pausedUntil
+	}
+	if requestsPerSecond > 0 {
+		if l.nextRequest.After(start) {
+			start = l.nextRequest
+		}
+		l.nextRequest = start.Add(time.Duration(float64(time.Second) / requestsPerSecond))
+	}
+	return start
+}
+
+// reserveBytes учитывает прочитанные байты и возвращает момент, когда
+// скорость чтения укладывается в лимит
+func (l *hostLimiter) reserveBytes(n int, bytesPerSecond int64) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.nextByte.Before(now) {
+		l.nextByte = now
+	}
+	l.nextByte = l.nextByte.Add(time.Duration(int64(n) * int64(time.Second) / bytesPerSecond))
+	return l.nextByte
+}
+
+// pause приостанавливает новые запросы к хосту до until
+func (l *hostLimiter) pause(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// throttledBody ограничивает скорость чтения тела ответа и освобождает
+// соединение хоста при закрытии
+type throttledBody struct {
+	io.ReadCloser
+	ctx            context.Context
+	limiter        *hostLimiter
+	bytesPerSecond int64
+	idleTimeout    time.Duration
+	release        func()
+	closeOnce      sync.Once
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if b.bytesPerSecond <= 0 {
+		return b.read(p)
+	}
+
+	// Чтение порциями не больше 1/10 секундного лимита сглаживает скорость
+	if chunk := max(b.bytesPerSecond/10, 1); int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.read(p)
+	if n > 0 {
+		if waitErr := sleepUntil(b.ctx, b.limiter.reserveBytes(n, b.bytesPerSecond)); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// read читает тело ответа. Общий таймаут клиента при ограничениях нагрузки
+// отключен, поэтому зависшее соединение закрывается, если очередная порция
+// данных не пришла за idleTimeout. Ожидание лимита скорости не учитывается.
+func (b *throttledBody) read(p []byte) (int, error) {
+	if b.idleTimeout <= 0 {
+		return b.ReadCloser.Read(p)
+	}
+
+	timer := time.AfterFunc(b.idleTimeout, func() { b.ReadCloser.Close() })
+	n, err := b.ReadCloser.Read(p)
+	if !timer.Stop() {
+		return n, fmt.Errorf("нет данных от сервера дольше %v", b.idleTimeout)
+	}
+	return n, err
+}
+
+func (b *throttledBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.closeOnce.Do(b.release)
+	return err
+}
+
+// ParseRetryAfter разбирает заголовок Retry-After: число секунд или HTTP дату
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
+
+// sleepUntil ожидает наступления момента или отмены ctx
+func sleepUntil(ctx context.Context, at time.Time) error {
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,16 +1,14 @@
 package utils
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"regexp"
-	"strings"
 	"time"
 
+	"github.com/Mirsadikovv/ffmpeg_research/dash"
 	"github.com/Mirsadikovv/ffmpeg_research/dto"
+	"github.com/Mirsadikovv/ffmpeg_research/m3u8"
 )
 
 // ResolveURL разрешает относительные URL
@@ -28,87 +26,122 @@ func ResolveURL(baseURL, relativeURL string) string {
 	return base.ResolveReference(rel).String()
 }
 
-// FindPlaylistURL пытается найти плейлист по URL страницы
-func FindPlaylistURL(pageURL string, client *http.Client) (string, error) {
-	resp, err := client.Get(pageURL)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	// Ищем ссылки на .m3u8 файлы
-	re := regexp.MustCompile(`(https?://[^\s"']+\.m3u8[^\s"']*)`)
-	matches := re.FindAllString(string(content), -1)
-
-	if len(matches) > 0 {
-		return matches[0], nil
+// UniqueStrings возвращает значения без повторов, сохраняя порядок.
+// Исходный срез не изменяется.
+func UniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
 	}
-
-	return "", fmt.Errorf("плейлист не найден на странице")
+	return unique
 }
 
 // ParsePlaylist парсит содержимое плейлиста
 func ParsePlaylist(content, baseURL string) (*dto.PlaylistInfo, error) {
+	master, media, err := m3u8.Parse(content, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка разбора плейлиста: %w", err)
+	}
+
 	info := &dto.PlaylistInfo{
 		URL:     baseURL,
 		Streams: make([]dto.StreamInfo, 0),
+		Master:  master,
+		Media:   media,
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	var currentStream dto.StreamInfo
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-
-		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
-			// Парсим информацию о потоке
-			currentStream = parseStreamInfo(line)
-		} else if strings.HasPrefix(line, "#EXT-X-TARGETDURATION:") {
-			// Это live стрим
-			info.IsLive = true
-		} else if !strings.HasPrefix(line, "#") && line != "" {
-			// Это URL потока
-			if currentStream.URL == "" {
-				currentStream.URL = ResolveURL(baseURL, line)
-				info.Streams = append(info.Streams, currentStream)
-				currentStream = dto.StreamInfo{}
-			}
+	if master != nil {
+		for _, variant := range master.Variants {
+			info.Streams = append(info.Streams, StreamInfoFromVariant(variant))
+		}
+		for _, key := range master.SessionKeys {
+			info.Keys = append(info.Keys, keyInfo(key))
+		}
+		return info, nil
+	}
+
+	info.IsLive = media.IsLive()
+	info.Duration = media.TotalDuration().String()
+
+	// Ключ повторяется у всех сегментов до следующего EXT-X-KEY
+	var lastKey *m3u8.Key
+	for _, segment := range media.Segments {
+		if segment.Key != nil && segment.Key != lastKey {
+			info.Keys = append(info.Keys, keyInfo(*segment.Key))
 		}
+		lastKey = segment.Key
 	}
 
 	return info, nil
 }
 
-// parseStreamInfo парсит информацию о потоке из строки EXT-X-STREAM-INF
-func parseStreamInfo(line string) dto.StreamInfo {
-	stream := dto.StreamInfo{}
+// StreamInfoFromVariant преобразует вариант мастер-плейлиста в dto.StreamInfo
+func StreamInfoFromVariant(variant m3u8.Variant) dto.StreamInfo {
+	return dto.StreamInfo{
+		URL:              variant.URI,
+		Resolution:       variant.Resolution,
+		Bandwidth:        variant.Bandwidth,
+		AverageBandwidth: variant.AverageBandwidth,
+		Codecs:           variant.Codecs,
+		FrameRate:        variant.FrameRate,
+		HDCPLevel:        variant.HDCPLevel,
+		VideoRange:       variant.VideoRange,
+		Audio:            variant.Audio,
+		Subtitles:        variant.Subtitles,
+		ClosedCaptions:   variant.ClosedCaptions,
+	}
+}
 
-	// Парсим bandwidth
-	if match := regexp.MustCompile(`BANDWIDTH=(\d+)`).FindStringSubmatch(line); len(match) > 1 {
-		fmt.Sscanf(match[1], "%d", &stream.Bandwidth)
+// keyInfo преобразует ключ шифрования в dto.KeyInfo
+func keyInfo(key m3u8.Key) dto.KeyInfo {
+	return dto.KeyInfo{
+		Method:            key.Method,
+		URI:               key.URI,
+		IV:                key.IV,
+		KeyFormat:         key.KeyFormat,
+		KeyFormatVersions: key.KeyFormatVersions,
 	}
+}
 
-	// Парсим разрешение
-	if match := regexp.MustCompile(`RESOLUTION=(\d+x\d+)`).FindStringSubmatch(line); len(match) > 1 {
-		stream.Resolution = match[1]
+// ParseMPD парсит MPD манифест MPEG-DASH. Streams содержит видео
+// представления первого периода в порядке манифеста.
+func ParseMPD(content, baseURL string) (*dto.PlaylistInfo, error) {
+	mpd, err := dash.Parse([]byte(content))
+	if err != nil {
+		return nil, err
 	}
 
-	// Парсим кодеки
-	if match := regexp.MustCompile(`CODECS="([^"]+)"`).FindStringSubmatch(line); len(match) > 1 {
-		stream.Codecs = match[1]
+	info := &dto.PlaylistInfo{
+		URL:     baseURL,
+		Streams: make([]dto.StreamInfo, 0),
+		IsLive:  mpd.IsLive(),
+		MPD:     mpd,
+	}
+	if duration := mpd.MediaPresentationDuration; duration > 0 {
+		info.Duration = time.Duration(duration).String()
 	}
 
-	// Парсим frame rate
-	if match := regexp.MustCompile(`FRAME-RATE=([\d.]+)`).FindStringSubmatch(line); len(match) > 1 {
-		fmt.Sscanf(match[1], "%f", &stream.FrameRate)
+	for _, stream := range mpd.Periods[0].Streams(dash.ContentVideo) {
+		info.Streams = append(info.Streams, StreamInfoFromRepresentation(stream))
 	}
 
-	return stream
+	return info, nil
+}
+
+// StreamInfoFromRepresentation преобразует представление MPD в dto.StreamInfo.
+// URL - идентификатор представления.
+func StreamInfoFromRepresentation(stream dash.Stream) dto.StreamInfo {
+	return dto.StreamInfo{
+		URL:        stream.Representation.ID,
+		Resolution: stream.Resolution(),
+		Bandwidth:  stream.Representation.Bandwidth,
+		Codecs:     stream.Codecs(),
+		FrameRate:  stream.FrameRate(),
+	}
 }
 
 // SelectStream выбирает поток по качеству
@@ -117,35 +150,49 @@ func SelectStream(info *dto.PlaylistInfo, quality string) (string, error) {
 		return info.URL, nil // Возвращаем исходный URL если нет вариантов
 	}
 
+	index, err := SelectStreamIndex(info.Streams, quality)
+	if err != nil {
+		return "", err
+	}
+	return info.Streams[index].URL, nil
+}
+
+// SelectStreamIndex возвращает индекс потока по качеству: best, worst
+// или конкретное разрешение. Используется для HLS вариантов и DASH представлений.
+func SelectStreamIndex(streams []dto.StreamInfo, quality string) (int, error) {
+	if len(streams) == 0 {
+		return 0, fmt.Errorf("нет доступных потоков")
+	}
+
 	switch quality {
 	case "best", "":
 		// Выбираем поток с максимальным bandwidth
-		var bestStream dto.StreamInfo
-		for _, stream := range info.Streams {
-			if stream.Bandwidth > bestStream.Bandwidth {
-				bestStream = stream
+		best := 0
+		for i, stream := range streams {
+			if stream.Bandwidth > streams[best].Bandwidth {
+				best = i
 			}
 		}
-		return bestStream.URL, nil
+		return best, nil
 
 	case "worst":
 		// Выбираем поток с минимальным bandwidth
-		bestStream := info.Streams[0]
-		for _, stream := range info.Streams {
-			if stream.Bandwidth < bestStream.Bandwidth {
-				bestStream = stream
+		worst := 0
+		for i, stream := range streams {
+			if stream.Bandwidth < streams[worst].Bandwidth {
+				worst = i
 			}
 		}
-		return bestStream.URL, nil
+		return worst, nil
 
 	default:
 		// Ищем поток с конкретным разрешением
-		for _, stream := range info.Streams {
+		for i, stream := range streams {
 			if stream.Resolution == quality {
-				return stream.URL, nil
+				return i, nil
 			}
 		}
-		return "", fmt.Errorf("поток с качеством %s не найден", quality)
+		return 0, fmt.Errorf("поток с качеством %s не найден", quality)
 	}
 }
 